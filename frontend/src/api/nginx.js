@@ -25,9 +25,14 @@ export const nginxAPI = {
     return api.post('/nginx/start')
   },
 
-  // 停止nginx
+  // 优雅停止nginx，需等待现有请求处理完成
   stop() {
-    return api.post('/nginx/stop')
+    return api.post('/nginx/stop', null, { timeout: 60000 })
+  },
+
+  // 快速停止nginx
+  fastStop() {
+    return api.post('/nginx/fast-stop', null, { timeout: 30000 })
   },
 
   // 重启nginx
@@ -38,6 +43,38 @@ export const nginxAPI = {
   // 重新加载配置
   reload() {
     return api.post('/nginx/reload')
+  },
+
+  // 重新打开日志文件
+  reopen() {
+    return api.post('/nginx/reopen')
+  },
+
+  // 优雅关闭所有worker（WINCH）
+  retireWorkers() {
+    return api.post('/nginx/workers/retire', null, { timeout: 60000 })
+  },
+
+  // 通过HUP重新加载worker
+  reloadWorkers() {
+    return api.post('/nginx/workers/reload', null, { timeout: 60000 })
+  }
+}
+
+export const systemAPI = {
+  // 获取主机和nginx进程资源占用
+  getSystem() {
+    return api.get('/system')
+  },
+
+  // 获取可查询的指标序列
+  getSeries() {
+    return api.get('/metrics/series')
+  },
+
+  // 查询指标历史
+  getHistory(series, params = {}) {
+    return api.get('/metrics/history', { params: { series: series.join(','), ...params } })
   }
 }
 
@@ -57,9 +94,155 @@ export const configAPI = {
     return api.post('/config/validate', { content })
   },
 
-  // 获取配置模板
-  getTemplate() {
-    return api.get('/config/template')
+  // 格式化配置内容，options可包含indent、use_tabs、align
+  formatConfig(content, options = {}) {
+    return api.post('/config/format', { content, ...options })
+  },
+
+  // 静态检查，content为空时检查当前配置
+  lintConfig(content) {
+    return api.post('/config/lint', { content })
+  },
+
+  // 静态检查规则列表
+  lintRules() {
+    return api.get('/lint-rules')
+  },
+
+  // 安全检查报告
+  securityReport() {
+    return api.get('/config/security')
+  },
+
+  // 安全检查报告下载地址，format为json或html
+  securityReportUrl(format = 'html') {
+    return `/api/config/security?format=${format}&download=true`
+  },
+
+  // 模拟请求的路由：request包含host、port、uri、address、scheme
+  resolve(request) {
+    return api.post('/config/resolve', request)
+  }
+}
+
+export const templateAPI = {
+  // 获取模板列表
+  list() {
+    return api.get('/templates')
+  },
+
+  // 获取单个模板
+  get(name) {
+    return api.get(`/templates/${name}`)
+  },
+
+  // 用参数渲染模板
+  render(name, params = {}) {
+    return api.post(`/templates/${name}/render`, { params })
+  },
+
+  // 保存用户模板
+  save(name, template) {
+    return api.put(`/templates/${name}`, template)
+  },
+
+  // 删除用户模板
+  remove(name) {
+    return api.delete(`/templates/${name}`)
+  }
+}
+
+export const siteAPI = {
+  // 获取站点列表
+  list() {
+    return api.get('/sites')
+  },
+
+  // 获取单个站点
+  get(id) {
+    return api.get(`/sites/${id}`)
+  },
+
+  // 创建站点
+  create(site, reload = true) {
+    return api.post('/sites', site, { params: { reload } })
+  },
+
+  // 修改站点
+  update(id, site, reload = true) {
+    return api.put(`/sites/${id}`, site, { params: { reload } })
+  },
+
+  // 删除站点
+  remove(id, reload = true) {
+    return api.delete(`/sites/${id}`, { params: { reload } })
+  },
+
+  // 启用或停用站点
+  setEnabled(id, enabled, reload = true) {
+    return api.post(`/sites/${id}/${enabled ? 'enable' : 'disable'}`, null, { params: { reload } })
+  },
+
+  // 获取location预设
+  getLocationPresets() {
+    return api.get('/location-presets')
+  },
+
+  // 添加location，preview为true时只返回生成的配置
+  addLocation(id, location, { preview = false, reload = true } = {}) {
+    return api.post(`/sites/${id}/locations`, location, { params: { preview, reload } })
+  },
+
+  // 修改location
+  updateLocation(id, index, location, { preview = false, reload = true } = {}) {
+    return api.put(`/sites/${id}/locations/${index}`, location, { params: { preview, reload } })
+  },
+
+  // 删除location
+  removeLocation(id, index, { preview = false, reload = true } = {}) {
+    return api.delete(`/sites/${id}/locations/${index}`, { params: { preview, reload } })
+  },
+
+  // 调整location顺序，order为原序号的新顺序
+  reorderLocations(id, order, { preview = false, reload = true } = {}) {
+    return api.post(`/sites/${id}/locations/reorder`, { order }, { params: { preview, reload } })
+  }
+}
+
+export const upstreamAPI = {
+  // 获取upstream列表
+  list() {
+    return api.get('/upstreams')
+  },
+
+  // 获取单个upstream
+  get(name) {
+    return api.get(`/upstreams/${name}`)
+  },
+
+  // 添加server
+  addServer(name, server) {
+    return api.post(`/upstreams/${name}/servers`, server)
+  },
+
+  // 删除server
+  removeServer(name, address) {
+    return api.delete(`/upstreams/${name}/servers`, { params: { address } })
+  },
+
+  // 获取server健康检查结果
+  health() {
+    return api.get('/upstreams/health')
+  },
+
+  // 修改server状态：up、down或drain
+  setServerState(name, address, state, force = false) {
+    return api.post(`/upstreams/${name}/servers/${state}`, { address, force })
+  },
+
+  // 获取审计日志
+  getAudit(params = {}) {
+    return api.get('/audit', { params })
   }
 }
 
@@ -79,3 +262,129 @@ export const backupAPI = {
     return api.delete(`/backup/${backupId}`)
   }
 }
+
+export const logAPI = {
+  // 获取日志归档列表
+  getArchives() {
+    return api.get('/logs/archives')
+  },
+
+  // 立即轮转日志
+  rotate() {
+    return api.post('/logs/rotate')
+  },
+
+  // 日志导出地址（浏览器直接下载）
+  downloadUrl(name, params = {}) {
+    const query = new URLSearchParams(params).toString()
+    return `/api/logs/${name}/download${query ? `?${query}` : ''}`
+  }
+}
+
+export const alertAPI = {
+  // 获取当前告警
+  getAlerts() {
+    return api.get('/alerts')
+  },
+
+  // 获取告警历史
+  getHistory(limit = 100) {
+    return api.get('/alerts/history', { params: { limit } })
+  },
+
+  // 获取告警规则
+  getRules() {
+    return api.get('/alerts/rules')
+  },
+
+  // 测试通知渠道
+  testNotifier(name) {
+    return api.post(`/alerts/notifiers/${name}/test`)
+  },
+
+  // 获取静默窗口
+  getSilences() {
+    return api.get('/alerts/silences')
+  },
+
+  // 创建静默窗口
+  createSilence(silence) {
+    return api.post('/alerts/silences', silence)
+  },
+
+  // 删除静默窗口
+  deleteSilence(id) {
+    return api.delete(`/alerts/silences/${id}`)
+  }
+}
+
+export const instanceAPI = {
+  // 获取所有nginx实例
+  list() {
+    return api.get('/instances')
+  },
+
+  // 获取指定实例的状态
+  getStatus(name) {
+    return api.get(`/instances/${name}/nginx/status`)
+  }
+}
+
+export const fleetAPI = {
+  // 获取所有agent及其状态
+  list() {
+    return api.get('/agents')
+  },
+
+  // 获取单个agent
+  get(name) {
+    return api.get(`/agents/${name}`)
+  },
+
+  // 注册agent
+  register(agent) {
+    return api.post('/agents', agent)
+  },
+
+  // 删除agent
+  remove(name) {
+    return api.delete(`/agents/${name}`)
+  },
+
+  // 调用指定agent的API，例如 call('web-1', 'post', '/nginx/reload')
+  call(name, method, path, data) {
+    return api.request({ method, url: `/agents/${name}/proxy${path}`, data })
+  }
+}
+
+export const rolloutAPI = {
+  // 获取发布列表
+  list() {
+    return api.get('/rollouts')
+  },
+
+  // 获取发布详情
+  get(id) {
+    return api.get(`/rollouts/${id}`)
+  },
+
+  // 创建并开始发布
+  create(plan) {
+    return api.post('/rollouts', plan)
+  },
+
+  // 批准继续
+  approve(id) {
+    return api.post(`/rollouts/${id}/approve`)
+  },
+
+  // 当前批次完成后暂停
+  pause(id) {
+    return api.post(`/rollouts/${id}/pause`)
+  },
+
+  // 中止发布
+  abort(id, rollback = false) {
+    return api.post(`/rollouts/${id}/abort`, { rollback })
+  }
+}
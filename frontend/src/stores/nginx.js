@@ -7,7 +7,11 @@ export const useNginxStore = defineStore('nginx', () => {
   const status = ref({
     is_running: false,
     pid: 0,
+    started_at: null,
+    uptime_seconds: 0,
     uptime: '',
+    reload_count: 0,
+    last_reload_at: null,
     version: '',
     config_valid: false,
     updated_at: null
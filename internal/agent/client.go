@@ -0,0 +1,161 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"nginx_manager/internal/instance"
+	"strings"
+	"time"
+)
+
+// ForwardedUserHeader 控制端转发请求时携带的原始用户，agent据此记录操作者
+const ForwardedUserHeader = "X-Forwarded-User"
+
+// Info agent的基本信息，由agent的 /api/agent 接口返回
+type Info struct {
+	Name      string          `json:"name"`
+	Hostname  string          `json:"hostname"`
+	OS        string          `json:"os"`
+	Arch      string          `json:"arch"`
+	Instances []instance.Info `json:"instances"`
+}
+
+// Endpoint 控制端管理的一个agent
+type Endpoint struct {
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+	Token string `json:"token,omitempty"`
+}
+
+// Client 调用agent API的客户端
+type Client struct {
+	Name  string
+	URL   *url.URL
+	token string
+	http  *http.Client
+	proxy *httputil.ReverseProxy
+}
+
+// response agent接口统一的响应格式
+type response struct {
+	Success bool            `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// NewClient 创建agent客户端，timeout只作用于Call，代理请求不限时长（升级等操作可能持续较久）
+func NewClient(endpoint Endpoint, tlsConfig *tls.Config, timeout time.Duration) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(endpoint.URL, "/"))
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("invalid agent url %q", endpoint.URL)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	c := &Client{
+		Name:  endpoint.Name,
+		URL:   base,
+		token: endpoint.Token,
+		http:  &http.Client{Transport: transport, Timeout: timeout},
+	}
+	c.proxy = &httputil.ReverseProxy{
+		Transport: transport,
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.Out.URL.Scheme = base.Scheme
+			r.Out.URL.Host = base.Host
+			r.Out.Host = base.Host
+			// 不把控制端的登录凭据转发给agent
+			r.Out.Header.Del("Authorization")
+			r.Out.Header.Del("Cookie")
+			c.authorize(r.Out)
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			w.Header().Set("Content-Type", "application/json; charset=utf-8")
+			w.WriteHeader(http.StatusBadGateway)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"success": false,
+				"message": fmt.Sprintf("agent %s unreachable: %v", c.Name, err),
+			})
+		},
+	}
+	return c, nil
+}
+
+// Info 获取agent信息
+func (c *Client) Info() (*Info, error) {
+	var info Info
+	if err := c.Call(http.MethodGet, "/api/agent", nil, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// Call 调用agent API，body和out为JSON，out为nil时忽略data；
+// agent返回success为false或非2xx状态码时返回其message
+func (c *Client) Call(method, path string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, c.URL.String()+path, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	c.authorize(req)
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("agent %s unreachable: %w", c.Name, err)
+	}
+	defer resp.Body.Close()
+
+	var result response
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("agent %s returned %s", c.Name, resp.Status)
+	}
+	if resp.StatusCode >= 300 || !result.Success {
+		if result.Message == "" {
+			result.Message = resp.Status
+		}
+		return fmt.Errorf("agent %s: %s", c.Name, result.Message)
+	}
+	if out != nil && len(result.Data) > 0 {
+		if err := json.Unmarshal(result.Data, out); err != nil {
+			return fmt.Errorf("agent %s returned invalid data: %w", c.Name, err)
+		}
+	}
+	return nil
+}
+
+// Proxy 将请求转发到agent的path，user为控制端登录用户，用于agent记录操作者
+func (c *Client) Proxy(w http.ResponseWriter, r *http.Request, path, user string) {
+	out := r.Clone(r.Context())
+	out.URL.Path = c.URL.Path + path
+	out.URL.RawPath = ""
+	out.Header.Del(ForwardedUserHeader)
+	if user != "" {
+		out.Header.Set(ForwardedUserHeader, user)
+	}
+	c.proxy.ServeHTTP(w, out)
+}
+
+func (c *Client) authorize(req *http.Request) {
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+}
@@ -0,0 +1,300 @@
+package agent
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	SourceConfig = "config" // 在配置文件中声明
+	SourceAPI    = "api"    // 通过API注册
+)
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// Status agent的连接状态
+type Status struct {
+	Name      string     `json:"name"`
+	URL       string     `json:"url"`
+	Source    string     `json:"source"`
+	Online    bool       `json:"online"`
+	LastCheck *time.Time `json:"last_check,omitempty"`
+	LastSeen  *time.Time `json:"last_seen,omitempty"`
+	Error     string     `json:"error,omitempty"`
+	Info      *Info      `json:"info,omitempty"`
+}
+
+type member struct {
+	endpoint Endpoint
+	source   string
+	client   *Client
+	status   Status
+}
+
+// Fleet 控制端管理的所有agent
+type Fleet struct {
+	mu        sync.RWMutex
+	members   map[string]*member
+	order     []string
+	token     string
+	tlsConfig *tls.Config
+	timeout   time.Duration
+	dataFile  string
+}
+
+// NewFleet 创建agent集合，endpoints为配置文件中声明的agent，token为其中未单独配置token的agent使用的默认值；
+// 通过API注册的agent必须提供自己的token或使用客户端证书，保存在dataFile中
+func NewFleet(endpoints []Endpoint, token string, tlsConfig *tls.Config, timeout time.Duration, dataFile string) (*Fleet, error) {
+	f := &Fleet{
+		members:   make(map[string]*member),
+		token:     token,
+		tlsConfig: tlsConfig,
+		timeout:   timeout,
+		dataFile:  dataFile,
+	}
+	for _, endpoint := range endpoints {
+		if err := f.add(endpoint, SourceConfig); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.load(); err != nil {
+		logrus.Warn("Failed to load registered agents: ", err)
+	}
+	return f, nil
+}
+
+// Run 定期检查所有agent的连接状态，阻塞运行
+func (f *Fleet) Run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	f.Poll()
+	for range ticker.C {
+		f.Poll()
+	}
+}
+
+// Poll 并发检查所有agent
+func (f *Fleet) Poll() {
+	f.mu.RLock()
+	members := make([]*member, 0, len(f.members))
+	for _, m := range f.members {
+		members = append(members, m)
+	}
+	f.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, m := range members {
+		wg.Add(1)
+		go func(m *member) {
+			defer wg.Done()
+			f.check(m)
+		}(m)
+	}
+	wg.Wait()
+}
+
+// check 获取agent信息并更新状态
+func (f *Fleet) check(m *member) {
+	info, err := m.client.Info()
+	now := time.Now()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m.status.LastCheck = &now
+	if err != nil {
+		if m.status.Online {
+			logrus.Warnf("Agent %s went offline: %v", m.endpoint.Name, err)
+		}
+		m.status.Online = false
+		m.status.Error = err.Error()
+		return
+	}
+	if !m.status.Online {
+		logrus.Infof("Agent %s is online", m.endpoint.Name)
+	}
+	m.status.Online = true
+	m.status.Error = ""
+	m.status.LastSeen = &now
+	m.status.Info = info
+}
+
+// Register 通过API注册agent，并立即检查连接
+func (f *Fleet) Register(endpoint Endpoint) (Status, error) {
+	f.mu.Lock()
+	if err := f.add(endpoint, SourceAPI); err != nil {
+		f.mu.Unlock()
+		return Status{}, err
+	}
+	f.save()
+	m := f.members[endpoint.Name]
+	f.mu.Unlock()
+
+	f.check(m)
+	status, _ := f.Get(endpoint.Name)
+	return status, nil
+}
+
+// Remove 删除通过API注册的agent，配置文件中声明的agent不能删除
+func (f *Fleet) Remove(name string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	m, ok := f.members[name]
+	if !ok {
+		return fmt.Errorf("agent %s not found", name)
+	}
+	if m.source == SourceConfig {
+		return fmt.Errorf("agent %s is declared in the config file and cannot be removed", name)
+	}
+
+	delete(f.members, name)
+	for i, n := range f.order {
+		if n == name {
+			f.order = append(f.order[:i], f.order[i+1:]...)
+			break
+		}
+	}
+	f.save()
+	return nil
+}
+
+// Client 返回指定agent的客户端
+func (f *Fleet) Client(name string) (*Client, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	m, ok := f.members[name]
+	if !ok {
+		return nil, false
+	}
+	return m.client, true
+}
+
+// Get 返回指定agent的状态
+func (f *Fleet) Get(name string) (Status, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	m, ok := f.members[name]
+	if !ok {
+		return Status{}, false
+	}
+	return m.status, true
+}
+
+// List 按注册顺序返回所有agent的状态
+func (f *Fleet) List() []Status {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	statuses := make([]Status, 0, len(f.order))
+	for _, name := range f.order {
+		statuses = append(statuses, f.members[name].status)
+	}
+	return statuses
+}
+
+// add 添加agent，调用方需持有锁（构造时除外）
+func (f *Fleet) add(endpoint Endpoint, source string) error {
+	if !namePattern.MatchString(endpoint.Name) {
+		return fmt.Errorf("invalid agent name %q", endpoint.Name)
+	}
+	if _, exists := f.members[endpoint.Name]; exists {
+		return fmt.Errorf("agent %s already exists", endpoint.Name)
+	}
+
+	// 默认令牌只用于配置文件中声明的agent，否则任何能调用注册API的人都可以让控制端把它发往任意地址
+	withToken := endpoint
+	if withToken.Token == "" {
+		switch {
+		case source == SourceConfig:
+			withToken.Token = f.token
+		case !f.clientCertificate(endpoint.URL):
+			return fmt.Errorf("agent %s requires a token, or an https url with a client certificate configured", endpoint.Name)
+		}
+	}
+	client, err := NewClient(withToken, f.tlsConfig, f.timeout)
+	if err != nil {
+		return err
+	}
+
+	f.members[endpoint.Name] = &member{
+		endpoint: endpoint,
+		source:   source,
+		client:   client,
+		status:   Status{Name: endpoint.Name, URL: endpoint.URL, Source: source},
+	}
+	f.order = append(f.order, endpoint.Name)
+	return nil
+}
+
+// clientCertificate 连接该地址时是否会出示客户端证书
+func (f *Fleet) clientCertificate(rawURL string) bool {
+	if f.tlsConfig == nil || (len(f.tlsConfig.Certificates) == 0 && f.tlsConfig.GetClientCertificate == nil) {
+		return false
+	}
+	return strings.HasPrefix(strings.ToLower(rawURL), "https://")
+}
+
+// save 保存通过API注册的agent，调用方需持有锁
+func (f *Fleet) save() {
+	if f.dataFile == "" {
+		return
+	}
+
+	endpoints := []Endpoint{}
+	for _, name := range f.order {
+		if m := f.members[name]; m.source == SourceAPI {
+			endpoints = append(endpoints, m.endpoint)
+		}
+	}
+	data, err := json.MarshalIndent(endpoints, "", "  ")
+	if err != nil {
+		logrus.Warn("Failed to encode agents: ", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(f.dataFile), 0755); err != nil {
+		logrus.Warn("Failed to create agent data directory: ", err)
+		return
+	}
+	// 文件中包含agent令牌，仅所有者可读
+	if err := os.WriteFile(f.dataFile, data, 0600); err != nil {
+		logrus.Warn("Failed to save agents: ", err)
+	}
+}
+
+func (f *Fleet) load() error {
+	if f.dataFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(f.dataFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var endpoints []Endpoint
+	if err := json.Unmarshal(data, &endpoints); err != nil {
+		return err
+	}
+	for _, endpoint := range endpoints {
+		if err := f.add(endpoint, SourceAPI); err != nil {
+			logrus.Warn("Skipping registered agent: ", err)
+		}
+	}
+	return nil
+}
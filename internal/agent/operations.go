@@ -0,0 +1,46 @@
+package agent
+
+import (
+	"net/http"
+	"nginx_manager/internal/nginx"
+)
+
+// 以下方法调用agent上的nginx操作，instance为空时作用于agent的默认实例
+
+// Status 获取nginx状态
+func (c *Client) Status(instance string) (*nginx.Status, error) {
+	var status nginx.Status
+	if err := c.Call(http.MethodGet, instancePath(instance, "/nginx/status"), nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// ReadConfig 读取配置文件内容
+func (c *Client) ReadConfig(instance string) (string, error) {
+	var content string
+	err := c.Call(http.MethodGet, instancePath(instance, "/config"), nil, &content)
+	return content, err
+}
+
+// ValidateConfig 在agent上用nginx -t验证配置内容，不改变当前配置
+func (c *Client) ValidateConfig(instance, content string) error {
+	return c.Call(http.MethodPost, instancePath(instance, "/config/validate"), map[string]string{"content": content}, nil)
+}
+
+// SaveConfig 保存配置文件，agent会先备份当前配置
+func (c *Client) SaveConfig(instance, content string) error {
+	return c.Call(http.MethodPut, instancePath(instance, "/config"), map[string]string{"content": content}, nil)
+}
+
+// Reload 测试配置并重新加载nginx
+func (c *Client) Reload(instance string) error {
+	return c.Call(http.MethodPost, instancePath(instance, "/nginx/reload"), nil, nil)
+}
+
+func instancePath(instance, path string) string {
+	if instance == "" {
+		return "/api" + path
+	}
+	return "/api/instances/" + instance + path
+}
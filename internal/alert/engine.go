@@ -0,0 +1,541 @@
+package alert
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	StatusPending  = "pending"
+	StatusFiring   = "firing"
+	StatusResolved = "resolved"
+	StatusEvent    = "event" // 不由规则触发的一次性事件，如自动重启
+
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+
+	maxHistory = 500
+)
+
+// Rule 告警规则：Metric Op Threshold 持续 For 时长后触发；
+// 恢复时需越过 Threshold ± Hysteresis，避免在阈值附近来回抖动
+type Rule struct {
+	Name        string        `json:"name"`
+	Metric      string        `json:"metric"`
+	Op          string        `json:"op"`
+	Threshold   float64       `json:"threshold"`
+	Hysteresis  float64       `json:"hysteresis"`
+	For         time.Duration `json:"for"`
+	Severity    string        `json:"severity"`
+	Description string        `json:"description,omitempty"`
+	Notifiers   []string      `json:"notifiers,omitempty"` // 为空时发送给所有通知渠道
+}
+
+// Alert 当前处于pending或firing状态的告警
+type Alert struct {
+	Rule        string     `json:"rule"`
+	Status      string     `json:"status"`
+	Severity    string     `json:"severity"`
+	Metric      string     `json:"metric"`
+	Value       float64    `json:"value"`
+	Threshold   float64    `json:"threshold"`
+	Message     string     `json:"message"`
+	ActiveSince time.Time  `json:"active_since"`
+	FiringSince *time.Time `json:"firing_since,omitempty"`
+	Silenced    bool       `json:"silenced"`
+}
+
+// Event 告警历史记录
+type Event struct {
+	ID        string    `json:"id"`
+	Rule      string    `json:"rule"`
+	Status    string    `json:"status"`
+	Severity  string    `json:"severity"`
+	Metric    string    `json:"metric,omitempty"`
+	Value     float64   `json:"value"`
+	Threshold float64   `json:"threshold"`
+	Message   string    `json:"message"`
+	At        time.Time `json:"at"`
+	Silenced  bool      `json:"silenced"`
+	Notified  []string  `json:"notified,omitempty"`
+	Errors    []string  `json:"errors,omitempty"`
+}
+
+// Silence 静默窗口，窗口内匹配的告警照常记录但不发送通知
+type Silence struct {
+	ID        string    `json:"id"`
+	Rule      string    `json:"rule"` // 为空或 * 表示所有规则
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Comment   string    `json:"comment,omitempty"`
+	CreatedBy string    `json:"created_by,omitempty"`
+}
+
+type ruleState struct {
+	alert *Alert
+}
+
+// delivery 一次待发送的通知
+type delivery struct {
+	event   Event
+	targets []Notifier
+}
+
+// Engine 告警规则引擎
+type Engine struct {
+	mu        sync.Mutex
+	rules     []Rule
+	notifiers map[string]Notifier
+	states    map[string]*ruleState
+	silences  []Silence
+	history   []Event
+	dataFile  string
+	seq       int64
+	queue     chan delivery
+}
+
+// persisted 持久化文件格式
+type persisted struct {
+	Silences []Silence `json:"silences"`
+	History  []Event   `json:"history"`
+}
+
+func NewEngine(rules []Rule, notifiers []Notifier, dataFile string) *Engine {
+	e := &Engine{
+		rules:     rules,
+		notifiers: make(map[string]Notifier),
+		states:    make(map[string]*ruleState),
+		dataFile:  dataFile,
+		queue:     make(chan delivery, 100),
+	}
+	for _, n := range notifiers {
+		e.notifiers[n.Name()] = n
+	}
+	if err := e.load(); err != nil {
+		logrus.Warn("Failed to load alert history: ", err)
+	}
+
+	// 单个协程按顺序发送，保证同一告警的firing先于resolved送达
+	go e.deliver()
+	return e
+}
+
+// Rules 返回所有规则
+func (e *Engine) Rules() []Rule {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]Rule(nil), e.rules...)
+}
+
+// Evaluate 用最新的指标值评估所有规则；缺少数据的规则保持原状态
+func (e *Engine) Evaluate(values map[string]float64, now time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for _, rule := range e.rules {
+		value, ok := values[rule.Metric]
+		if !ok {
+			continue
+		}
+
+		state, ok := e.states[rule.Name]
+		if !ok {
+			state = &ruleState{}
+			e.states[rule.Name] = state
+		}
+
+		if state.alert == nil {
+			if !compare(rule.Op, value, rule.Threshold) {
+				continue
+			}
+			state.alert = &Alert{
+				Rule:        rule.Name,
+				Status:      StatusPending,
+				Severity:    rule.Severity,
+				Metric:      rule.Metric,
+				Threshold:   rule.Threshold,
+				ActiveSince: now,
+			}
+		}
+
+		current := state.alert
+		current.Value = value
+		current.Message = describe(rule, value)
+		current.Silenced = e.silenced(rule.Name, now)
+
+		// pending的告警条件一旦不满足就取消，滞回区间只用于firing告警的恢复
+		if current.Status == StatusPending && !compare(rule.Op, value, rule.Threshold) {
+			state.alert = nil
+			continue
+		}
+		if current.Status == StatusFiring && resolved(rule, value) {
+			e.record(rule, StatusResolved, value, now, current.Silenced)
+			state.alert = nil
+			continue
+		}
+
+		if current.Status == StatusPending && now.Sub(current.ActiveSince) >= rule.For {
+			firingSince := now
+			current.Status = StatusFiring
+			current.FiringSince = &firingSince
+			e.record(rule, StatusFiring, value, now, current.Silenced)
+		}
+	}
+}
+
+// Emit 记录并通知一次性事件（如自动重启），不经过规则评估
+func (e *Engine) Emit(name, severity, message string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	event := e.appendEvent(Event{
+		Rule:     name,
+		Status:   StatusEvent,
+		Severity: severity,
+		Message:  message,
+		At:       now,
+		Silenced: e.silenced(name, now),
+	})
+	e.dispatch(event, nil)
+}
+
+// Active 返回当前pending和firing的告警
+func (e *Engine) Active() []Alert {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	alerts := []Alert{}
+	for _, state := range e.states {
+		if state.alert != nil {
+			alerts = append(alerts, *state.alert)
+		}
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].ActiveSince.Before(alerts[j].ActiveSince)
+	})
+	return alerts
+}
+
+// History 返回最近的告警事件，按时间倒序
+func (e *Engine) History(limit int) []Event {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	events := []Event{}
+	for i := len(e.history) - 1; i >= 0 && (limit <= 0 || len(events) < limit); i-- {
+		events = append(events, e.history[i])
+	}
+	return events
+}
+
+// Silences 返回未过期的静默窗口
+func (e *Engine) Silences() []Silence {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	silences := []Silence{}
+	for _, s := range e.silences {
+		if s.EndsAt.After(now) {
+			silences = append(silences, s)
+		}
+	}
+	return silences
+}
+
+// AddSilence 添加静默窗口
+func (e *Engine) AddSilence(s Silence) (Silence, error) {
+	if s.StartsAt.IsZero() {
+		s.StartsAt = time.Now()
+	}
+	if !s.EndsAt.After(s.StartsAt) {
+		return s, fmt.Errorf("silence must end after it starts")
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if s.Rule != "" && s.Rule != "*" && e.findRule(s.Rule) == nil {
+		return s, fmt.Errorf("unknown rule: %s", s.Rule)
+	}
+
+	e.seq++
+	s.ID = fmt.Sprintf("silence-%d-%d", s.StartsAt.Unix(), e.seq)
+	e.silences = append(e.silences, s)
+	e.save()
+	return s, nil
+}
+
+// DeleteSilence 删除静默窗口
+func (e *Engine) DeleteSilence(id string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for i, s := range e.silences {
+		if s.ID == id {
+			e.silences = append(e.silences[:i], e.silences[i+1:]...)
+			e.save()
+			return nil
+		}
+	}
+	return fmt.Errorf("silence not found: %s", id)
+}
+
+// TestNotifier 向指定通知渠道发送测试消息
+func (e *Engine) TestNotifier(name string) error {
+	e.mu.Lock()
+	notifier, ok := e.notifiers[name]
+	e.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("unknown notifier: %s", name)
+	}
+
+	return notifier.Notify(Event{
+		ID:       "test",
+		Rule:     "test",
+		Status:   StatusEvent,
+		Severity: SeverityInfo,
+		Message:  "This is a test notification from nginx manager",
+		At:       time.Now(),
+	})
+}
+
+// NotifierNames 返回所有通知渠道名称
+func (e *Engine) NotifierNames() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	names := make([]string, 0, len(e.notifiers))
+	for name := range e.notifiers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// record 记录规则状态变化并发送通知，调用方需持有锁
+func (e *Engine) record(rule Rule, status string, value float64, now time.Time, silenced bool) {
+	event := e.appendEvent(Event{
+		Rule:      rule.Name,
+		Status:    status,
+		Severity:  rule.Severity,
+		Metric:    rule.Metric,
+		Value:     value,
+		Threshold: rule.Threshold,
+		Message:   describe(rule, value),
+		At:        now,
+		Silenced:  silenced,
+	})
+	logrus.Infof("Alert %s %s: %s", rule.Name, status, event.Message)
+	e.dispatch(event, rule.Notifiers)
+}
+
+// appendEvent 追加历史事件，调用方需持有锁
+func (e *Engine) appendEvent(event Event) Event {
+	e.seq++
+	event.ID = fmt.Sprintf("%d-%d", event.At.Unix(), e.seq)
+	e.history = append(e.history, event)
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+	e.save()
+	return event
+}
+
+// dispatch 将通知放入发送队列，调用方需持有锁
+func (e *Engine) dispatch(event Event, names []string) {
+	if event.Silenced {
+		return
+	}
+
+	var targets []Notifier
+	if len(names) == 0 {
+		for _, n := range e.notifiers {
+			targets = append(targets, n)
+		}
+	} else {
+		for _, name := range names {
+			if n, ok := e.notifiers[name]; ok {
+				targets = append(targets, n)
+			} else {
+				logrus.Warnf("Alert rule %s references unknown notifier %s", event.Rule, name)
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	select {
+	case e.queue <- delivery{event: event, targets: targets}:
+	default:
+		logrus.Warnf("Alert notification queue is full, dropping %s", event.Rule)
+	}
+}
+
+// deliver 发送通知并回写发送结果
+func (e *Engine) deliver() {
+	for d := range e.queue {
+		var notified, errs []string
+		for _, n := range d.targets {
+			if err := n.Notify(d.event); err != nil {
+				logrus.Warnf("Failed to send alert via %s: %v", n.Name(), err)
+				errs = append(errs, fmt.Sprintf("%s: %v", n.Name(), err))
+				continue
+			}
+			notified = append(notified, n.Name())
+		}
+
+		e.mu.Lock()
+		for i := range e.history {
+			if e.history[i].ID == d.event.ID {
+				e.history[i].Notified = notified
+				e.history[i].Errors = errs
+				break
+			}
+		}
+		e.save()
+		e.mu.Unlock()
+	}
+}
+
+// silenced 判断规则当前是否处于静默窗口，调用方需持有锁
+func (e *Engine) silenced(rule string, now time.Time) bool {
+	for _, s := range e.silences {
+		if (s.Rule == "" || s.Rule == "*" || s.Rule == rule) && !now.Before(s.StartsAt) && now.Before(s.EndsAt) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Engine) findRule(name string) *Rule {
+	for i := range e.rules {
+		if e.rules[i].Name == name {
+			return &e.rules[i]
+		}
+	}
+	return nil
+}
+
+// save 持久化静默窗口和历史，调用方需持有锁
+func (e *Engine) save() {
+	if e.dataFile == "" {
+		return
+	}
+
+	// 过期的静默窗口不再保留
+	now := time.Now()
+	active := e.silences[:0]
+	for _, s := range e.silences {
+		if s.EndsAt.After(now) {
+			active = append(active, s)
+		}
+	}
+	e.silences = active
+
+	data, err := json.MarshalIndent(persisted{Silences: e.silences, History: e.history}, "", "  ")
+	if err != nil {
+		logrus.Warn("Failed to encode alert data: ", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(e.dataFile), 0755); err != nil {
+		logrus.Warn("Failed to create alert data directory: ", err)
+		return
+	}
+	if err := os.WriteFile(e.dataFile, data, 0644); err != nil {
+		logrus.Warn("Failed to save alert data: ", err)
+	}
+}
+
+func (e *Engine) load() error {
+	if e.dataFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(e.dataFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var p persisted
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	e.silences = p.Silences
+	e.history = p.History
+	e.seq = int64(len(p.History))
+	return nil
+}
+
+// compare 按运算符比较
+func compare(op string, value, threshold float64) bool {
+	switch op {
+	case ">":
+		return value > threshold
+	case ">=":
+		return value >= threshold
+	case "<":
+		return value < threshold
+	case "<=":
+		return value <= threshold
+	case "==":
+		return value == threshold
+	case "!=":
+		return value != threshold
+	}
+	return false
+}
+
+// resolved 判断firing告警是否已恢复：值需越过阈值加滞回区间
+func resolved(rule Rule, value float64) bool {
+	switch rule.Op {
+	case ">", ">=":
+		return value < rule.Threshold-rule.Hysteresis
+	case "<", "<=":
+		return value > rule.Threshold+rule.Hysteresis
+	}
+	return !compare(rule.Op, value, rule.Threshold)
+}
+
+// ValidateRule 检查规则配置
+func ValidateRule(rule Rule) error {
+	if rule.Name == "" || rule.Metric == "" {
+		return fmt.Errorf("alert rule requires name and metric")
+	}
+	switch rule.Op {
+	case ">", ">=", "<", "<=", "==", "!=":
+	default:
+		return fmt.Errorf("alert rule %s has invalid op: %s", rule.Name, rule.Op)
+	}
+	if rule.Hysteresis < 0 {
+		return fmt.Errorf("alert rule %s has negative hysteresis", rule.Name)
+	}
+	return nil
+}
+
+func describe(rule Rule, value float64) string {
+	desc := rule.Description
+	if desc == "" {
+		desc = rule.Name
+	}
+	return fmt.Sprintf("%s: %s = %s (threshold %s %s)",
+		desc, rule.Metric, formatValue(value), rule.Op, formatValue(rule.Threshold))
+}
+
+func formatValue(v float64) string {
+	return strings.TrimRight(strings.TrimRight(fmt.Sprintf("%.4f", v), "0"), ".")
+}
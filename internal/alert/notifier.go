@@ -0,0 +1,211 @@
+package alert
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	NotifierWebhook  = "webhook"
+	NotifierEmail    = "email"
+	NotifierSlack    = "slack"
+	NotifierDingTalk = "dingtalk"
+	NotifierWeCom    = "wecom"
+	NotifierFeishu   = "feishu"
+)
+
+// Notifier 告警通知渠道
+type Notifier interface {
+	Name() string
+	Notify(event Event) error
+}
+
+// NotifierConfig 通知渠道配置
+type NotifierConfig struct {
+	Name     string
+	Type     string
+	URL      string
+	Headers  map[string]string
+	SMTPHost string
+	SMTPPort int
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// NewNotifier 根据配置创建通知渠道
+func NewNotifier(cfg NotifierConfig) (Notifier, error) {
+	if cfg.Name == "" {
+		cfg.Name = cfg.Type
+	}
+
+	switch cfg.Type {
+	case NotifierWebhook, NotifierSlack, NotifierDingTalk, NotifierWeCom, NotifierFeishu:
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("notifier %s requires url", cfg.Name)
+		}
+		return &WebhookNotifier{
+			name:    cfg.Name,
+			kind:    cfg.Type,
+			url:     cfg.URL,
+			headers: cfg.Headers,
+			client:  &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	case NotifierEmail:
+		if cfg.SMTPHost == "" || cfg.From == "" || len(cfg.To) == 0 {
+			return nil, fmt.Errorf("notifier %s requires smtp_host, from and to", cfg.Name)
+		}
+		if cfg.SMTPPort == 0 {
+			cfg.SMTPPort = 25
+		}
+		return &EmailNotifier{
+			name:     cfg.Name,
+			addr:     net.JoinHostPort(cfg.SMTPHost, strconv.Itoa(cfg.SMTPPort)),
+			host:     cfg.SMTPHost,
+			username: cfg.Username,
+			password: cfg.Password,
+			from:     cfg.From,
+			to:       cfg.To,
+		}, nil
+	}
+	return nil, fmt.Errorf("unsupported notifier type: %s", cfg.Type)
+}
+
+// WebhookNotifier 以HTTP POST发送告警；kind决定请求体格式
+type WebhookNotifier struct {
+	name    string
+	kind    string
+	url     string
+	headers map[string]string
+	client  *http.Client
+}
+
+func (n *WebhookNotifier) Name() string {
+	return n.name
+}
+
+func (n *WebhookNotifier) Notify(event Event) error {
+	body, err := json.Marshal(n.payload(event))
+	if err != nil {
+		return fmt.Errorf("failed to encode payload: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range n.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(respBody)))
+	}
+
+	// 钉钉、企业微信、飞书出错时仍返回200，需检查响应中的错误码
+	var result struct {
+		ErrCode *int   `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+		Code    *int   `json:"code"`
+		Msg     string `json:"msg"`
+	}
+	if json.Unmarshal(respBody, &result) == nil {
+		if result.ErrCode != nil && *result.ErrCode != 0 {
+			return fmt.Errorf("webhook error %d: %s", *result.ErrCode, result.ErrMsg)
+		}
+		if result.Code != nil && *result.Code != 0 {
+			return fmt.Errorf("webhook error %d: %s", *result.Code, result.Msg)
+		}
+	}
+	return nil
+}
+
+// payload 按渠道类型构造请求体
+func (n *WebhookNotifier) payload(event Event) interface{} {
+	text := FormatText(event)
+	switch n.kind {
+	case NotifierSlack:
+		return map[string]interface{}{"text": text}
+	case NotifierDingTalk, NotifierWeCom:
+		return map[string]interface{}{
+			"msgtype": "text",
+			"text":    map[string]string{"content": text},
+		}
+	case NotifierFeishu:
+		return map[string]interface{}{
+			"msg_type": "text",
+			"content":  map[string]string{"text": text},
+		}
+	}
+	return event
+}
+
+// EmailNotifier 通过SMTP发送告警邮件
+type EmailNotifier struct {
+	name     string
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+	to       []string
+}
+
+func (n *EmailNotifier) Name() string {
+	return n.name
+}
+
+func (n *EmailNotifier) Notify(event Event) error {
+	var auth smtp.Auth
+	if n.username != "" {
+		auth = smtp.PlainAuth("", n.username, n.password, n.host)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(n.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", subject(event))
+	fmt.Fprintf(&msg, "Date: %s\r\n", event.At.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(FormatText(event), "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	if err := smtp.SendMail(n.addr, auth, n.from, n.to, msg.Bytes()); err != nil {
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+	return nil
+}
+
+// FormatText 生成告警的纯文本描述，供聊天和邮件通知使用
+func FormatText(event Event) string {
+	var b strings.Builder
+	b.WriteString(subject(event))
+	b.WriteString("\n")
+	b.WriteString(event.Message)
+	b.WriteString("\n")
+	fmt.Fprintf(&b, "Time: %s", event.At.Format("2006-01-02 15:04:05"))
+	return b.String()
+}
+
+func subject(event Event) string {
+	return fmt.Sprintf("[%s] [%s] nginx manager: %s",
+		strings.ToUpper(event.Status), strings.ToUpper(event.Severity), event.Rule)
+}
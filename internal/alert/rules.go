@@ -0,0 +1,58 @@
+package alert
+
+import "time"
+
+// 规则可引用的指标
+const (
+	MetricNginxUp           = "nginx_up"            // 1运行 0停止
+	MetricConfigValid       = "config_valid"        // 1有效 0无效
+	MetricErrorRate5xx      = "error_rate_5xx"      // 评估周期内5xx响应占比
+	MetricCertExpiryDays    = "cert_expiry_days"    // 最早过期证书的剩余天数
+	MetricConnectionsActive = "connections_active"  // stub_status活跃连接数
+	MetricRequestsRate      = "requests_rate"       // 每秒请求数
+	MetricHostCPU           = "host_cpu_percent"    // 主机CPU占用率
+	MetricHostMemory        = "host_memory_percent" // 主机内存占用率
+	MetricDiskUsed          = "disk_used_percent"   // nginx相关磁盘中最高的占用率
+)
+
+// DefaultRules 内置规则：nginx停止、配置无效、5xx比例过高、证书即将过期
+func DefaultRules() []Rule {
+	return []Rule{
+		{
+			Name:        "nginx_down",
+			Metric:      MetricNginxUp,
+			Op:          "<",
+			Threshold:   1,
+			For:         30 * time.Second,
+			Severity:    SeverityCritical,
+			Description: "nginx is not running",
+		},
+		{
+			Name:        "config_invalid",
+			Metric:      MetricConfigValid,
+			Op:          "<",
+			Threshold:   1,
+			Severity:    SeverityCritical,
+			Description: "nginx configuration test failed",
+		},
+		{
+			Name:        "high_5xx_rate",
+			Metric:      MetricErrorRate5xx,
+			Op:          ">",
+			Threshold:   0.05,
+			Hysteresis:  0.02,
+			For:         2 * time.Minute,
+			Severity:    SeverityWarning,
+			Description: "5xx response rate is high",
+		},
+		{
+			Name:        "cert_expiring",
+			Metric:      MetricCertExpiryDays,
+			Op:          "<",
+			Threshold:   14,
+			Hysteresis:  1,
+			Severity:    SeverityWarning,
+			Description: "SSL certificate expires soon",
+		},
+	}
+}
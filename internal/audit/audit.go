@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// maxEntries 保留的审计记录数量
+const maxEntries = 1000
+
+// Entry 一次修改操作的审计记录
+type Entry struct {
+	At       time.Time `json:"at"`
+	Actor    string    `json:"actor"`
+	Instance string    `json:"instance"`
+	Action   string    `json:"action"`           // 如 upstream.server.down
+	Target   string    `json:"target"`           // 如 backend/10.0.0.1:8080
+	Detail   string    `json:"detail,omitempty"` // 操作参数
+	Success  bool      `json:"success"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Log 持久化的审计日志
+type Log struct {
+	mu       sync.Mutex
+	dataFile string
+	entries  []Entry
+}
+
+// NewLog 创建审计日志，dataFile为空时只保存在内存中
+func NewLog(dataFile string) *Log {
+	l := &Log{dataFile: dataFile}
+	if err := l.load(); err != nil {
+		logrus.Warn("Failed to load audit log: ", err)
+	}
+	return l
+}
+
+// Record 追加一条记录
+func (l *Log) Record(entry Entry) {
+	if entry.At.IsZero() {
+		entry.At = time.Now()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = append(l.entries, entry)
+	if len(l.entries) > maxEntries {
+		l.entries = l.entries[len(l.entries)-maxEntries:]
+	}
+	l.save()
+}
+
+// List 按时间倒序返回记录，instance为空时不过滤，limit<=0时返回全部
+func (l *Log) List(instance string, limit int) []Entry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	entries := []Entry{}
+	for i := len(l.entries) - 1; i >= 0; i-- {
+		if instance != "" && l.entries[i].Instance != instance {
+			continue
+		}
+		entries = append(entries, l.entries[i])
+		if limit > 0 && len(entries) == limit {
+			break
+		}
+	}
+	return entries
+}
+
+func (l *Log) save() {
+	if l.dataFile == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(l.entries, "", "  ")
+	if err != nil {
+		logrus.Warn("Failed to encode audit log: ", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(l.dataFile), 0755); err != nil {
+		logrus.Warn("Failed to create audit log directory: ", err)
+		return
+	}
+	if err := os.WriteFile(l.dataFile, data, 0644); err != nil {
+		logrus.Warn("Failed to save audit log: ", err)
+	}
+}
+
+func (l *Log) load() error {
+	if l.dataFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(l.dataFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &l.entries)
+}
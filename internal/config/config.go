@@ -3,21 +3,43 @@ package config
 import (
 	"fmt"
 	"path/filepath"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	Nginx    NginxConfig    `mapstructure:"nginx"`
-	Security SecurityConfig `mapstructure:"security"`
-	Backup   BackupConfig   `mapstructure:"backup"`
+	Server      ServerConfig      `mapstructure:"server"`
+	Nginx       NginxConfig       `mapstructure:"nginx"`
+	Instances   []InstanceConfig  `mapstructure:"instances"`
+	Security    SecurityConfig    `mapstructure:"security"`
+	Backup      BackupConfig      `mapstructure:"backup"`
+	Logs        LogsConfig        `mapstructure:"logs"`
+	Metrics     MetricsConfig     `mapstructure:"metrics"`
+	History     HistoryConfig     `mapstructure:"history"`
+	Alerting    AlertingConfig    `mapstructure:"alerting"`
+	Supervisor  SupervisorConfig  `mapstructure:"supervisor"`
+	HealthCheck HealthCheckConfig `mapstructure:"health_check"`
+	Audit       AuditConfig       `mapstructure:"audit"`
+	Templates   TemplatesConfig   `mapstructure:"templates"`
+	Format      FormatConfig      `mapstructure:"format"`
+	Upgrade     UpgradeConfig     `mapstructure:"upgrade"`
+	Agent       AgentConfig       `mapstructure:"agent"`
+	Controller  ControllerConfig  `mapstructure:"controller"`
 }
 
+// 运行模式
+const (
+	ModeStandalone = "standalone" // 管理本机nginx并提供Web界面
+	ModeAgent      = "agent"      // 只通过认证的API暴露本机nginx操作，由控制端管理
+	ModeController = "controller" // 管理多个agent，不管理本机nginx
+)
+
 type ServerConfig struct {
 	Host  string `mapstructure:"host"`
 	Port  int    `mapstructure:"port"`
 	Debug bool   `mapstructure:"debug"`
+	Mode  string `mapstructure:"mode"`
 }
 
 type NginxConfig struct {
@@ -27,6 +49,22 @@ type NginxConfig struct {
 	PidFile        string `mapstructure:"pid_file"`
 }
 
+// InstanceConfig 一个命名的nginx实例；未配置instances时使用nginx段作为default实例
+type InstanceConfig struct {
+	Name           string `mapstructure:"name"`
+	ExecutablePath string `mapstructure:"executable_path"`
+	ConfigPath     string `mapstructure:"config_path"`
+	LogPath        string `mapstructure:"log_path"`
+	PidFile        string `mapstructure:"pid_file"`
+	BackupDir      string `mapstructure:"backup_dir"`      // 默认为 backup.backup_dir/<name>
+	StubStatusURL  string `mapstructure:"stub_status_url"` // 第一个实例默认使用 metrics.stub_status_url
+}
+
+// UpgradeConfig 二进制升级只接受dir目录中的可执行文件，为空时禁用升级
+type UpgradeConfig struct {
+	Dir string `mapstructure:"dir"`
+}
+
 type SecurityConfig struct {
 	EnableAuth bool   `mapstructure:"enable_auth"`
 	Username   string `mapstructure:"username"`
@@ -39,6 +77,151 @@ type BackupConfig struct {
 	MaxBackups int    `mapstructure:"max_backups"`
 }
 
+// LogsConfig 内置日志轮转配置，用于没有logrotate的平台（Windows、精简容器）
+type LogsConfig struct {
+	Rotate        bool          `mapstructure:"rotate"`
+	MaxSizeMB     int           `mapstructure:"max_size_mb"`
+	Interval      time.Duration `mapstructure:"interval"`
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+	Compress      bool          `mapstructure:"compress"`
+	MaxFiles      int           `mapstructure:"max_files"`
+	MaxAge        time.Duration `mapstructure:"max_age"`
+}
+
+// MetricsConfig nginx stub_status指标配置
+type MetricsConfig struct {
+	StubStatusURL  string        `mapstructure:"stub_status_url"`
+	AutoInject     bool          `mapstructure:"auto_inject"`
+	AccessLog      string        `mapstructure:"access_log"`
+	SystemInterval time.Duration `mapstructure:"system_interval"`
+}
+
+// HistoryConfig 指标历史存储配置
+type HistoryConfig struct {
+	Enable       bool          `mapstructure:"enable"`
+	Interval     time.Duration `mapstructure:"interval"`
+	SaveInterval time.Duration `mapstructure:"save_interval"`
+	DataFile     string        `mapstructure:"data_file"`
+}
+
+// AlertingConfig 告警配置；未配置规则时使用内置规则
+type AlertingConfig struct {
+	Enable      bool                  `mapstructure:"enable"`
+	Interval    time.Duration         `mapstructure:"interval"`
+	DataFile    string                `mapstructure:"data_file"`
+	MinRequests int                   `mapstructure:"min_requests"` // 评估周期内请求数少于该值时不计算5xx比例
+	Notifiers   []AlertNotifierConfig `mapstructure:"notifiers"`
+	Rules       []AlertRuleConfig     `mapstructure:"rules"`
+}
+
+// AlertNotifierConfig 告警通知渠道：webhook、email、slack、dingtalk、wecom、feishu
+type AlertNotifierConfig struct {
+	Name     string            `mapstructure:"name"`
+	Type     string            `mapstructure:"type"`
+	URL      string            `mapstructure:"url"`
+	Headers  map[string]string `mapstructure:"headers"`
+	SMTPHost string            `mapstructure:"smtp_host"`
+	SMTPPort int               `mapstructure:"smtp_port"`
+	Username string            `mapstructure:"username"`
+	Password string            `mapstructure:"password"`
+	From     string            `mapstructure:"from"`
+	To       []string          `mapstructure:"to"`
+}
+
+// AlertRuleConfig 告警规则
+type AlertRuleConfig struct {
+	Name        string        `mapstructure:"name"`
+	Metric      string        `mapstructure:"metric"`
+	Op          string        `mapstructure:"op"`
+	Threshold   float64       `mapstructure:"threshold"`
+	Hysteresis  float64       `mapstructure:"hysteresis"`
+	For         time.Duration `mapstructure:"for"`
+	Severity    string        `mapstructure:"severity"`
+	Description string        `mapstructure:"description"`
+	Notifiers   []string      `mapstructure:"notifiers"`
+}
+
+// AuditConfig 配置修改审计日志
+type AuditConfig struct {
+	DataFile string `mapstructure:"data_file"`
+}
+
+// TemplatesConfig 配置模板库，用户保存的模板存放在Dir中
+type TemplatesConfig struct {
+	Dir string `mapstructure:"dir"`
+}
+
+// FormatConfig 配置格式化选项，on_save开启时编辑器保存的配置先格式化再写入
+type FormatConfig struct {
+	OnSave  bool `mapstructure:"on_save"`
+	Indent  int  `mapstructure:"indent"`   // 每级缩进的空格数
+	UseTabs bool `mapstructure:"use_tabs"` // 使用tab缩进，忽略indent
+	Align   bool `mapstructure:"align"`    // 对齐连续简单指令的参数
+}
+
+// SupervisorConfig nginx异常退出后的自动重启配置
+type SupervisorConfig struct {
+	Enable         bool          `mapstructure:"enable"`
+	CheckInterval  time.Duration `mapstructure:"check_interval"`
+	BackoffInitial time.Duration `mapstructure:"backoff_initial"`
+	BackoffMax     time.Duration `mapstructure:"backoff_max"`
+	MaxRestarts    int           `mapstructure:"max_restarts"`
+	Window         time.Duration `mapstructure:"window"`
+	ErrorLogLines  int           `mapstructure:"error_log_lines"`
+}
+
+// HealthCheckConfig upstream server的主动健康检查配置
+type HealthCheckConfig struct {
+	Enable     bool                `mapstructure:"enable"`
+	Interval   time.Duration       `mapstructure:"interval"`
+	Timeout    time.Duration       `mapstructure:"timeout"`
+	Rise       int                 `mapstructure:"rise"`      // 连续成功多少次视为恢复
+	Fall       int                 `mapstructure:"fall"`      // 连续失败多少次视为故障
+	AutoDown   bool                `mapstructure:"auto_down"` // 自动标记故障server为down，恢复后去掉
+	FlapWindow time.Duration       `mapstructure:"flap_window"`
+	MaxFlaps   int                 `mapstructure:"max_flaps"` // flap_window内状态变化达到该次数时暂停自动操作
+	Checks     []HealthCheckTarget `mapstructure:"checks"`
+}
+
+// HealthCheckTarget 一个upstream的探测方式，upstream为空时作为默认
+type HealthCheckTarget struct {
+	Upstream       string `mapstructure:"upstream"`
+	Type           string `mapstructure:"type"` // tcp、http或https
+	Path           string `mapstructure:"path"`
+	Host           string `mapstructure:"host"`
+	ExpectedStatus []int  `mapstructure:"expected_status"`
+}
+
+// AgentConfig agent模式的认证配置：配置client_ca_file时要求控制端提供该CA签发的客户端证书，
+// 配置token时要求请求携带 Authorization: Bearer <token>，两者可同时使用
+type AgentConfig struct {
+	Name         string `mapstructure:"name"` // 默认为主机名
+	Token        string `mapstructure:"token"`
+	CertFile     string `mapstructure:"cert_file"`
+	KeyFile      string `mapstructure:"key_file"`
+	ClientCAFile string `mapstructure:"client_ca_file"`
+}
+
+// ControllerConfig controller模式的配置
+type ControllerConfig struct {
+	Token         string                `mapstructure:"token"`     // agent未单独配置token时使用
+	CertFile      string                `mapstructure:"cert_file"` // 连接agent时出示的客户端证书
+	KeyFile       string                `mapstructure:"key_file"`
+	CAFile        string                `mapstructure:"ca_file"` // 校验agent服务端证书的CA，为空时使用系统CA
+	CheckInterval time.Duration         `mapstructure:"check_interval"`
+	Timeout       time.Duration         `mapstructure:"timeout"`
+	DataFile      string                `mapstructure:"data_file"`    // 通过API注册的agent
+	RolloutFile   string                `mapstructure:"rollout_file"` // 发布记录
+	Agents        []AgentEndpointConfig `mapstructure:"agents"`
+}
+
+// AgentEndpointConfig 控制端管理的一个agent
+type AgentEndpointConfig struct {
+	Name  string `mapstructure:"name"`
+	URL   string `mapstructure:"url"`
+	Token string `mapstructure:"token"`
+}
+
 var AppConfig *Config
 
 func LoadConfig(configPath string) error {
@@ -68,6 +251,13 @@ func LoadConfig(configPath string) error {
 	AppConfig.Nginx.ConfigPath = filepath.Clean(AppConfig.Nginx.ConfigPath)
 	AppConfig.Nginx.LogPath = filepath.Clean(AppConfig.Nginx.LogPath)
 	AppConfig.Nginx.PidFile = filepath.Clean(AppConfig.Nginx.PidFile)
+	for i := range AppConfig.Instances {
+		inst := &AppConfig.Instances[i]
+		inst.ExecutablePath = filepath.Clean(inst.ExecutablePath)
+		inst.ConfigPath = filepath.Clean(inst.ConfigPath)
+		inst.LogPath = filepath.Clean(inst.LogPath)
+		inst.PidFile = filepath.Clean(inst.PidFile)
+	}
 
 	return nil
 }
@@ -76,12 +266,58 @@ func setDefaults() {
 	viper.SetDefault("server.host", "127.0.0.1")
 	viper.SetDefault("server.port", 8080)
 	viper.SetDefault("server.debug", true)
+	viper.SetDefault("server.mode", ModeStandalone)
 	viper.SetDefault("nginx.executable_path", "C:/nginx/nginx.exe")
 	viper.SetDefault("nginx.config_path", "C:/nginx/conf/nginx.conf")
 	viper.SetDefault("nginx.log_path", "C:/nginx/logs")
 	viper.SetDefault("nginx.pid_file", "C:/nginx/logs/nginx.pid")
 	viper.SetDefault("security.enable_auth", false)
+	viper.SetDefault("upgrade.dir", "")
 	viper.SetDefault("backup.enable", true)
 	viper.SetDefault("backup.backup_dir", "./backups")
 	viper.SetDefault("backup.max_backups", 10)
+	viper.SetDefault("logs.rotate", false)
+	viper.SetDefault("logs.max_size_mb", 100)
+	viper.SetDefault("logs.interval", "24h")
+	viper.SetDefault("logs.check_interval", "1m")
+	viper.SetDefault("logs.compress", true)
+	viper.SetDefault("logs.max_files", 7)
+	viper.SetDefault("logs.max_age", "720h")
+	viper.SetDefault("metrics.stub_status_url", "")
+	viper.SetDefault("metrics.auto_inject", false)
+	viper.SetDefault("metrics.access_log", "access.log")
+	viper.SetDefault("metrics.system_interval", "10s")
+	viper.SetDefault("history.enable", true)
+	viper.SetDefault("history.interval", "10s")
+	viper.SetDefault("history.save_interval", "1m")
+	viper.SetDefault("history.data_file", "./data/metrics_history.json")
+	viper.SetDefault("alerting.enable", true)
+	viper.SetDefault("alerting.interval", "30s")
+	viper.SetDefault("alerting.data_file", "./data/alerts.json")
+	viper.SetDefault("alerting.min_requests", 20)
+	viper.SetDefault("supervisor.enable", false)
+	viper.SetDefault("supervisor.check_interval", "5s")
+	viper.SetDefault("supervisor.backoff_initial", "2s")
+	viper.SetDefault("supervisor.backoff_max", "2m")
+	viper.SetDefault("supervisor.max_restarts", 5)
+	viper.SetDefault("supervisor.window", "10m")
+	viper.SetDefault("supervisor.error_log_lines", 20)
+	viper.SetDefault("health_check.enable", false)
+	viper.SetDefault("health_check.interval", "10s")
+	viper.SetDefault("health_check.timeout", "3s")
+	viper.SetDefault("health_check.rise", 2)
+	viper.SetDefault("health_check.fall", 3)
+	viper.SetDefault("health_check.auto_down", false)
+	viper.SetDefault("health_check.flap_window", "10m")
+	viper.SetDefault("health_check.max_flaps", 4)
+	viper.SetDefault("audit.data_file", "./data/audit.json")
+	viper.SetDefault("templates.dir", "./data/templates")
+	viper.SetDefault("format.on_save", false)
+	viper.SetDefault("format.indent", 4)
+	viper.SetDefault("format.use_tabs", false)
+	viper.SetDefault("format.align", false)
+	viper.SetDefault("controller.check_interval", "15s")
+	viper.SetDefault("controller.timeout", "10s")
+	viper.SetDefault("controller.data_file", "./data/agents.json")
+	viper.SetDefault("controller.rollout_file", "./data/rollouts.json")
 }
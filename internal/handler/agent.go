@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"net/http"
+	"nginx_manager/internal/agent"
+	"nginx_manager/internal/instance"
+	"os"
+	"runtime"
+
+	"github.com/gin-gonic/gin"
+	"nginx_manager/internal/config"
+)
+
+type AgentHandler struct {
+	registry *instance.Registry
+	name     string
+	hostname string
+}
+
+// NewAgentHandler 创建agent信息处理器，未配置名称时使用主机名
+func NewAgentHandler(registry *instance.Registry) *AgentHandler {
+	hostname, _ := os.Hostname()
+	name := config.AppConfig.Agent.Name
+	if name == "" {
+		name = hostname
+	}
+
+	return &AgentHandler{
+		registry: registry,
+		name:     name,
+		hostname: hostname,
+	}
+}
+
+// GetInfo 获取agent信息，控制端用于检查连接和展示集群状态
+func (h *AgentHandler) GetInfo(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": agent.Info{
+			Name:      h.name,
+			Hostname:  h.hostname,
+			OS:        runtime.GOOS,
+			Arch:      runtime.GOARCH,
+			Instances: h.registry.List(),
+		},
+	})
+}
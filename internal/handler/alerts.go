@@ -0,0 +1,346 @@
+package handler
+
+import (
+	"net/http"
+	"nginx_manager/internal/alert"
+	"nginx_manager/internal/instance"
+	"nginx_manager/internal/nginx"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"nginx_manager/internal/config"
+)
+
+type AlertHandler struct {
+	service       *nginx.Service
+	configManager *nginx.ConfigManager
+	engine        *alert.Engine
+	accessTailer  *nginx.LogTailer
+	interval      time.Duration
+	minRequests   int
+}
+
+// NewAlertHandler 创建告警处理器，告警规则基于默认实例的指标评估
+func NewAlertHandler(registry *instance.Registry) *AlertHandler {
+	cfg := config.AppConfig
+	inst := registry.Default()
+	interval := cfg.Alerting.Interval
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	var notifiers []alert.Notifier
+	for _, n := range cfg.Alerting.Notifiers {
+		notifier, err := alert.NewNotifier(alert.NotifierConfig{
+			Name:     n.Name,
+			Type:     n.Type,
+			URL:      n.URL,
+			Headers:  n.Headers,
+			SMTPHost: n.SMTPHost,
+			SMTPPort: n.SMTPPort,
+			Username: n.Username,
+			Password: n.Password,
+			From:     n.From,
+			To:       n.To,
+		})
+		if err != nil {
+			logrus.Error("Invalid alert notifier: ", err)
+			continue
+		}
+		notifiers = append(notifiers, notifier)
+	}
+
+	rules := alert.DefaultRules()
+	if len(cfg.Alerting.Rules) > 0 {
+		rules = nil
+		for _, r := range cfg.Alerting.Rules {
+			rule := alert.Rule{
+				Name:        r.Name,
+				Metric:      r.Metric,
+				Op:          r.Op,
+				Threshold:   r.Threshold,
+				Hysteresis:  r.Hysteresis,
+				For:         r.For,
+				Severity:    r.Severity,
+				Description: r.Description,
+				Notifiers:   r.Notifiers,
+			}
+			if rule.Severity == "" {
+				rule.Severity = alert.SeverityWarning
+			}
+			if err := alert.ValidateRule(rule); err != nil {
+				logrus.Error("Invalid alert rule: ", err)
+				continue
+			}
+			rules = append(rules, rule)
+		}
+	}
+
+	handler := &AlertHandler{
+		service:       inst.Service,
+		configManager: inst.ConfigManager,
+		engine:        alert.NewEngine(rules, notifiers, cfg.Alerting.DataFile),
+		accessTailer:  nginx.NewLogTailer(filepath.Join(inst.Config.LogPath, cfg.Metrics.AccessLog)),
+		interval:      interval,
+		minRequests:   cfg.Alerting.MinRequests,
+	}
+
+	// 启动告警评估协程
+	if cfg.Alerting.Enable {
+		go handler.evaluate()
+	}
+
+	return handler
+}
+
+// Engine 返回告警引擎，供其他模块发送事件通知
+func (h *AlertHandler) Engine() *alert.Engine {
+	return h.engine
+}
+
+// GetAlerts 获取当前活动的告警
+func (h *AlertHandler) GetAlerts(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.engine.Active(),
+	})
+}
+
+// GetHistory 获取告警历史
+func (h *AlertHandler) GetHistory(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.engine.History(limit),
+	})
+}
+
+// GetRules 获取告警规则
+func (h *AlertHandler) GetRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.engine.Rules(),
+	})
+}
+
+// GetNotifiers 获取通知渠道
+func (h *AlertHandler) GetNotifiers(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.engine.NotifierNames(),
+	})
+}
+
+// TestNotifier 向通知渠道发送测试消息
+func (h *AlertHandler) TestNotifier(c *gin.Context) {
+	name := c.Param("name")
+	if err := h.engine.TestNotifier(name); err != nil {
+		logrus.Error("Failed to send test notification: ", err)
+		c.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Test notification sent",
+	})
+}
+
+// GetSilences 获取未过期的静默窗口
+func (h *AlertHandler) GetSilences(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.engine.Silences(),
+	})
+}
+
+// CreateSilence 创建静默窗口，可指定结束时间或持续时长
+func (h *AlertHandler) CreateSilence(c *gin.Context) {
+	var req struct {
+		Rule     string `json:"rule"`
+		StartsAt string `json:"starts_at"`
+		EndsAt   string `json:"ends_at"`
+		Duration string `json:"duration"`
+		Comment  string `json:"comment"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	startsAt, err := parseTimeParam(req.StartsAt, false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "invalid starts_at: " + err.Error(),
+		})
+		return
+	}
+	if startsAt.IsZero() {
+		startsAt = time.Now()
+	}
+
+	endsAt, err := parseTimeParam(req.EndsAt, true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "invalid ends_at: " + err.Error(),
+		})
+		return
+	}
+	if endsAt.IsZero() && req.Duration != "" {
+		duration, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "invalid duration: " + err.Error(),
+			})
+			return
+		}
+		endsAt = startsAt.Add(duration)
+	}
+
+	silence, err := h.engine.AddSilence(alert.Silence{
+		Rule:      req.Rule,
+		StartsAt:  startsAt,
+		EndsAt:    endsAt,
+		Comment:   req.Comment,
+		CreatedBy: actorOf(c),
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    silence,
+	})
+}
+
+// DeleteSilence 删除静默窗口
+func (h *AlertHandler) DeleteSilence(c *gin.Context) {
+	if err := h.engine.DeleteSilence(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Silence deleted",
+	})
+}
+
+// GetCertificates 获取配置中引用的证书及剩余有效期
+func (h *AlertHandler) GetCertificates(c *gin.Context) {
+	certs, err := h.configManager.Certificates()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    certs,
+	})
+}
+
+// evaluate 定期采集指标并评估告警规则
+func (h *AlertHandler) evaluate() {
+	// 定位到访问日志末尾，之后只统计新增请求
+	if err := h.accessTailer.ReadNew(func(string) {}); err != nil {
+		logrus.Debug("Access log not available for alerting: ", err)
+	}
+
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		h.engine.Evaluate(h.collect(), now)
+	}
+}
+
+// collect 采集规则可引用的指标；采集失败的指标不出现在结果中
+func (h *AlertHandler) collect() map[string]float64 {
+	values := make(map[string]float64)
+
+	running := h.service.IsRunning()
+	values[alert.MetricNginxUp] = boolValue(running)
+	values[alert.MetricConfigValid] = boolValue(h.service.ConfigValid())
+
+	var total, errors int
+	err := h.accessTailer.ReadNew(func(line string) {
+		entry, err := nginx.ParseAccessLine(line)
+		if err != nil {
+			return
+		}
+		total++
+		if entry.Status >= 500 {
+			errors++
+		}
+	})
+	// 请求太少时比例没有意义，不提供该指标，规则保持原状态
+	if err == nil && total > 0 && total >= h.minRequests {
+		values[alert.MetricErrorRate5xx] = float64(errors) / float64(total)
+	}
+
+	if certs, err := h.configManager.Certificates(); err == nil {
+		found := false
+		var minDays float64
+		for _, cert := range certs {
+			if cert.Error != "" {
+				continue
+			}
+			if !found || cert.DaysLeft < minDays {
+				minDays = cert.DaysLeft
+				found = true
+			}
+		}
+		if found {
+			values[alert.MetricCertExpiryDays] = minDays
+		}
+	}
+
+	if collector := h.service.Metrics(); collector != nil && running {
+		if conn, err := collector.Scrape(nginx.ScrapeAlerts); err == nil {
+			values[alert.MetricConnectionsActive] = float64(conn.Active)
+			// 第一次抓取或nginx重启后没有速率，不提供该指标
+			if conn.RatesValid {
+				values[alert.MetricRequestsRate] = conn.RequestsRate
+			}
+		}
+	}
+
+	info := h.service.GetSystemInfo()
+	values[alert.MetricHostCPU] = info.Host.CPUPercent
+	values[alert.MetricHostMemory] = info.Host.MemoryPercent
+	if len(info.Host.Disks) > 0 {
+		var used float64
+		for _, disk := range info.Host.Disks {
+			if disk.UsedPercent > used {
+				used = disk.UsedPercent
+			}
+		}
+		values[alert.MetricDiskUsed] = used
+	}
+
+	return values
+}
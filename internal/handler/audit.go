@@ -0,0 +1,32 @@
+package handler
+
+import (
+	"net/http"
+	"nginx_manager/internal/audit"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuditHandler struct {
+	log *audit.Log
+}
+
+func NewAuditHandler(log *audit.Log) *AuditHandler {
+	return &AuditHandler{
+		log: log,
+	}
+}
+
+// GetAudit 获取审计日志，支持 instance 和 limit 参数
+func (h *AuditHandler) GetAudit(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil {
+		limit = 100
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.log.List(c.Query("instance"), limit),
+	})
+}
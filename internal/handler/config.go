@@ -1,48 +1,57 @@
 package handler
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
-	nginx2 "nginx_manager/internal/nginx"
+	"nginx_manager/internal/config"
+	"nginx_manager/internal/instance"
+	"nginx_manager/internal/nginx"
+	"nginx_manager/internal/nginxconf"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
-	"nginx_manager/internal/config"
 )
 
 type ConfigHandler struct {
-	configManager *nginx2.ConfigManager
-	nginxService  *nginx2.Service
+	registry *instance.Registry
+	format   config.FormatConfig
 }
 
 type ConfigRequest struct {
 	Content string `json:"content" binding:"required"`
+	Format  *bool  `json:"format,omitempty"` // 保存前是否格式化，为空时按format.on_save
 }
 
-func NewConfigHandler() *ConfigHandler {
-	cfg := config.AppConfig
-	configManager := nginx2.NewConfigManager(
-		cfg.Nginx.ConfigPath,
-		cfg.Backup.BackupDir,
-		cfg.Backup.MaxBackups,
-	)
+// FormatRequest 格式化请求，content为空时格式化当前主配置；未提供的选项使用format段的配置
+type FormatRequest struct {
+	Content string `json:"content"`
+	Indent  *int   `json:"indent,omitempty"`
+	UseTabs *bool  `json:"use_tabs,omitempty"`
+	Align   *bool  `json:"align,omitempty"`
+}
 
-	nginxService := nginx2.NewService(
-		cfg.Nginx.ExecutablePath,
-		cfg.Nginx.ConfigPath,
-		cfg.Nginx.LogPath,
-		cfg.Nginx.PidFile,
-	)
+// LintRequest 静态检查请求，content为空时检查当前配置
+type LintRequest struct {
+	Content string `json:"content"`
+}
 
+func NewConfigHandler(registry *instance.Registry) *ConfigHandler {
 	return &ConfigHandler{
-		configManager: configManager,
-		nginxService:  nginxService,
+		registry: registry,
+		format:   config.AppConfig.Format,
 	}
 }
 
 // GetConfig 获取nginx配置文件内容
 func (h *ConfigHandler) GetConfig(c *gin.Context) {
-	content, err := h.configManager.ReadConfig()
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	content, err := inst.ConfigManager.ReadConfig()
 	if err != nil {
 		logrus.Error("Failed to read config: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -60,6 +69,11 @@ func (h *ConfigHandler) GetConfig(c *gin.Context) {
 
 // SaveConfig 保存nginx配置文件
 func (h *ConfigHandler) SaveConfig(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
 	var req ConfigRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -69,7 +83,17 @@ func (h *ConfigHandler) SaveConfig(c *gin.Context) {
 		return
 	}
 
-	if err := h.configManager.WriteConfig(req.Content); err != nil {
+	content, formatted := req.Content, false
+	if (req.Format == nil && h.format.OnSave) || (req.Format != nil && *req.Format) {
+		// 格式化失败（通常是语法错误）时按原样保存，由验证和测试报告错误
+		if out, err := nginxconf.FormatString(inst.ConfigManager.ConfigPath, content, formatOptions(h.format)); err != nil {
+			logrus.Warn("Config saved without formatting: ", err)
+		} else {
+			content, formatted = out, true
+		}
+	}
+
+	if err := inst.ConfigManager.WriteConfig(content); err != nil {
 		logrus.Error("Failed to save config: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -78,14 +102,218 @@ func (h *ConfigHandler) SaveConfig(c *gin.Context) {
 		return
 	}
 
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"message":   "Configuration saved successfully",
+		"formatted": formatted,
+	})
+}
+
+// FormatConfig 格式化配置内容并返回结果，不写入文件
+func (h *ConfigHandler) FormatConfig(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	var req FormatRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid request body",
+			})
+			return
+		}
+	}
+
+	content := req.Content
+	if content == "" {
+		var err error
+		if content, err = inst.ConfigManager.ReadConfig(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+	}
+
+	opts := h.format
+	if req.Indent != nil {
+		opts.Indent = *req.Indent
+	}
+	if req.UseTabs != nil {
+		opts.UseTabs = *req.UseTabs
+	}
+	if req.Align != nil {
+		opts.Align = *req.Align
+	}
+	if opts.Indent < 1 || opts.Indent > 8 {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "indent must be between 1 and 8",
+		})
+		return
+	}
+
+	formatted, err := nginxconf.FormatString(inst.ConfigManager.ConfigPath, content, formatOptions(opts))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"content": formatted,
+			"changed": formatted != content,
+		},
+	})
+}
+
+// LintConfig 静态检查配置，请求体可以提供content检查未保存的内容
+func (h *ConfigHandler) LintConfig(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	var req LintRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid request body",
+			})
+			return
+		}
+	}
+
+	report, err := inst.ConfigManager.Lint(req.Content)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    report,
+	})
+}
+
+// GetLintRules 获取所有静态检查规则
+func (h *ConfigHandler) GetLintRules(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    nginx.LintRules,
+	})
+}
+
+// GetSecurityReport 生成配置的安全检查报告，format=html时返回HTML，download=true时作为附件下载
+func (h *ConfigHandler) GetSecurityReport(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "html" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "format must be json or html",
+		})
+		return
+	}
+
+	report, err := inst.ConfigManager.SecurityAudit(inst.Service.Version())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	report.Instance = inst.Name
+
+	if c.Query("download") == "true" {
+		filename := fmt.Sprintf("security_%s_%s.%s", inst.Name, report.GeneratedAt.Format("20060102_150405"), format)
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	}
+
+	switch {
+	case format == "html":
+		c.Header("Content-Type", "text/html; charset=utf-8")
+		c.Status(http.StatusOK)
+		if err := report.WriteHTML(c.Writer); err != nil {
+			logrus.Error("Failed to write security report: ", err)
+		}
+	case c.Query("download") == "true":
+		c.IndentedJSON(http.StatusOK, report)
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    report,
+		})
+	}
+}
+
+// ResolveConfig 模拟nginx为请求选择server和location，返回继承后生效的指令
+func (h *ConfigHandler) ResolveConfig(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	var req nginx.ResolveRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "host is required",
+		})
+		return
+	}
+
+	result, err := inst.ConfigManager.Resolve(req)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, nginx.ErrNoServer) {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
-		"message": "Configuration saved successfully",
+		"data":    result,
 	})
 }
 
+func formatOptions(cfg config.FormatConfig) nginxconf.FormatOptions {
+	indent := strings.Repeat(" ", cfg.Indent)
+	if cfg.UseTabs {
+		indent = "\t"
+	}
+	return nginxconf.FormatOptions{Indent: indent, Align: cfg.Align}
+}
+
 // ValidateConfig 验证nginx配置文件语法
 func (h *ConfigHandler) ValidateConfig(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
 	var req ConfigRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -96,13 +324,13 @@ func (h *ConfigHandler) ValidateConfig(c *gin.Context) {
 	}
 
 	// 先保存当前配置作为临时备份
-	originalContent, err := h.configManager.ReadConfig()
+	originalContent, err := inst.ConfigManager.ReadConfig()
 	if err != nil {
 		logrus.Error("Failed to read original config: ", err)
 	}
 
 	// 写入新配置进行测试
-	if err := h.configManager.WriteConfig(req.Content); err != nil {
+	if err := inst.ConfigManager.WriteConfig(req.Content); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
 			"message": "Failed to write test config",
@@ -111,34 +339,47 @@ func (h *ConfigHandler) ValidateConfig(c *gin.Context) {
 	}
 
 	// 测试配置
-	err = h.nginxService.TestConfig()
+	err = inst.Service.TestConfig()
 
 	// 恢复原配置
 	if originalContent != "" {
-		if restoreErr := h.configManager.WriteConfig(originalContent); restoreErr != nil {
+		if restoreErr := inst.ConfigManager.WriteConfig(originalContent); restoreErr != nil {
 			logrus.Error("Failed to restore original config: ", restoreErr)
 		}
 	}
 
+	// nginx -t 不检查的引用路径，配置无法解析时没有结果
+	dependencies, depErr := inst.ConfigManager.Dependencies(req.Content, inst.Service.Prefix())
+	if depErr != nil {
+		logrus.Debug("Failed to check config dependencies: ", depErr)
+	}
+
 	if err != nil {
 		c.JSON(http.StatusOK, gin.H{
-			"success": false,
-			"valid":   false,
-			"message": err.Error(),
+			"success":      false,
+			"valid":        false,
+			"message":      err.Error(),
+			"dependencies": dependencies,
 		})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"valid":   true,
-		"message": "Configuration is valid",
+		"success":      true,
+		"valid":        true,
+		"message":      "Configuration is valid",
+		"dependencies": dependencies,
 	})
 }
 
 // GetBackups 获取备份列表
 func (h *ConfigHandler) GetBackups(c *gin.Context) {
-	backups, err := h.configManager.ListBackups()
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	backups, err := inst.ConfigManager.ListBackups()
 	if err != nil {
 		logrus.Error("Failed to list backups: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -156,6 +397,11 @@ func (h *ConfigHandler) GetBackups(c *gin.Context) {
 
 // RestoreBackup 恢复指定备份
 func (h *ConfigHandler) RestoreBackup(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
 	backupID := c.Param("id")
 	if backupID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -165,7 +411,7 @@ func (h *ConfigHandler) RestoreBackup(c *gin.Context) {
 		return
 	}
 
-	if err := h.configManager.RestoreBackup(backupID); err != nil {
+	if err := inst.ConfigManager.RestoreBackup(backupID); err != nil {
 		logrus.Error("Failed to restore backup: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -182,6 +428,11 @@ func (h *ConfigHandler) RestoreBackup(c *gin.Context) {
 
 // DeleteBackup 删除指定备份
 func (h *ConfigHandler) DeleteBackup(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
 	backupID := c.Param("id")
 	if backupID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -191,7 +442,7 @@ func (h *ConfigHandler) DeleteBackup(c *gin.Context) {
 		return
 	}
 
-	if err := h.configManager.DeleteBackup(backupID); err != nil {
+	if err := inst.ConfigManager.DeleteBackup(backupID); err != nil {
 		logrus.Error("Failed to delete backup: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -208,6 +459,11 @@ func (h *ConfigHandler) DeleteBackup(c *gin.Context) {
 
 // DownloadBackup 下载指定备份文件
 func (h *ConfigHandler) DownloadBackup(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
 	backupID := c.Param("id")
 	if backupID == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -218,7 +474,7 @@ func (h *ConfigHandler) DownloadBackup(c *gin.Context) {
 	}
 
 	// 获取备份文件路径
-	backupPath, err := h.configManager.GetBackupPath(backupID)
+	backupPath, err := inst.ConfigManager.GetBackupPath(backupID)
 	if err != nil {
 		logrus.Error("Failed to get backup path: ", err)
 		c.JSON(http.StatusNotFound, gin.H{
@@ -236,12 +492,3 @@ func (h *ConfigHandler) DownloadBackup(c *gin.Context) {
 	// 发送文件
 	c.File(backupPath)
 }
-
-// GetTemplate 获取nginx配置模板
-func (h *ConfigHandler) GetTemplate(c *gin.Context) {
-	template := h.configManager.GetConfigTemplate()
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    template,
-	})
-}
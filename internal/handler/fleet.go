@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"nginx_manager/internal/agent"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type FleetHandler struct {
+	fleet *agent.Fleet
+}
+
+func NewFleetHandler(fleet *agent.Fleet) *FleetHandler {
+	return &FleetHandler{
+		fleet: fleet,
+	}
+}
+
+// GetAgents 获取所有agent及其连接状态
+func (h *FleetHandler) GetAgents(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.fleet.List(),
+	})
+}
+
+// GetAgent 获取单个agent的状态和实例信息
+func (h *FleetHandler) GetAgent(c *gin.Context) {
+	status, ok := h.fleet.Get(c.Param("agent"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("agent %s not found", c.Param("agent")),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    status,
+	})
+}
+
+// RegisterAgent 注册agent
+func (h *FleetHandler) RegisterAgent(c *gin.Context) {
+	var req agent.Endpoint
+	if err := c.ShouldBindJSON(&req); err != nil || req.Name == "" || req.URL == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "name and url are required",
+		})
+		return
+	}
+
+	status, err := h.fleet.Register(req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	logrus.Infof("Agent %s registered by %s", req.Name, actorOf(c))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Agent registered successfully",
+		"data":    status,
+	})
+}
+
+// DeleteAgent 删除通过API注册的agent
+func (h *FleetHandler) DeleteAgent(c *gin.Context) {
+	if err := h.fleet.Remove(c.Param("agent")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Agent removed successfully",
+	})
+}
+
+// Proxy 将 /api/agents/:agent/proxy/* 转发到agent的 /api/*，
+// 例如 /api/agents/web-1/proxy/nginx/reload 调用web-1的 /api/nginx/reload
+func (h *FleetHandler) Proxy(c *gin.Context) {
+	client, ok := h.fleet.Client(c.Param("agent"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("agent %s not found", c.Param("agent")),
+		})
+		return
+	}
+
+	client.Proxy(c.Writer, c.Request, "/api"+c.Param("path"), actorOf(c))
+}
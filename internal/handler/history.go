@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"net/http"
+	"nginx_manager/internal/instance"
+	"nginx_manager/internal/nginx"
+	"nginx_manager/internal/timeseries"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"nginx_manager/internal/config"
+)
+
+type HistoryHandler struct {
+	service  *nginx.Service
+	store    *timeseries.Store
+	interval time.Duration
+}
+
+// NewHistoryHandler 创建指标历史处理器，采样默认实例
+func NewHistoryHandler(registry *instance.Registry) *HistoryHandler {
+	cfg := config.AppConfig
+	interval := cfg.History.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	saveInterval := cfg.History.SaveInterval
+	if saveInterval <= 0 {
+		saveInterval = time.Minute
+	}
+
+	store := timeseries.NewStore(cfg.History.DataFile, timeseries.DefaultTiers(interval))
+	if err := store.Load(); err != nil {
+		logrus.Warn("Failed to load metrics history: ", err)
+	}
+
+	handler := &HistoryHandler{
+		service:  registry.Default().Service,
+		store:    store,
+		interval: interval,
+	}
+
+	// 启动采样和持久化协程
+	if cfg.History.Enable {
+		go handler.record()
+		go handler.persist(saveInterval)
+	}
+
+	return handler
+}
+
+// GetHistory 查询指标历史，用于仪表盘图表
+func (h *HistoryHandler) GetHistory(c *gin.Context) {
+	names := strings.Split(c.Query("series"), ",")
+	if c.Query("series") == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "series is required",
+		})
+		return
+	}
+
+	now := time.Now()
+	from, err := parseTimeParam(c.Query("from"), false)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "invalid from: " + err.Error(),
+		})
+		return
+	}
+	if from.IsZero() {
+		from = now.Add(-time.Hour)
+	}
+
+	to, err := parseTimeParam(c.Query("to"), true)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "invalid to: " + err.Error(),
+		})
+		return
+	}
+	if to.IsZero() {
+		to = now
+	}
+
+	step, err := parseStep(c.Query("step"), from, to)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "invalid step: " + err.Error(),
+		})
+		return
+	}
+
+	result := make(map[string][]timeseries.Point, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		points, err := h.store.Query(name, from, to, step)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": err.Error(),
+			})
+			return
+		}
+		result[name] = points
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"from":   from.Unix(),
+			"to":     to.Unix(),
+			"step":   int64(step.Seconds()),
+			"series": result,
+		},
+	})
+}
+
+// GetSeries 列出可查询的序列
+func (h *HistoryHandler) GetSeries(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.store.Names(),
+	})
+}
+
+// record 按采样周期记录状态、连接、请求速率和进程资源
+func (h *HistoryHandler) record() {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		h.sample(now)
+	}
+}
+
+func (h *HistoryHandler) sample(now time.Time) {
+	running := h.service.IsRunning()
+	h.store.Add("nginx_up", now, boolValue(running))
+
+	if collector := h.service.Metrics(); collector != nil && running {
+		if conn, err := collector.Scrape(nginx.ScrapeHistory); err == nil {
+			h.store.Add("connections_active", now, float64(conn.Active))
+			h.store.Add("connections_reading", now, float64(conn.Reading))
+			h.store.Add("connections_writing", now, float64(conn.Writing))
+			h.store.Add("connections_waiting", now, float64(conn.Waiting))
+			// 第一次抓取或nginx重启后没有可比较的计数，空闲时速率为0也要记录
+			if conn.RatesValid {
+				h.store.Add("requests_rate", now, conn.RequestsRate)
+				h.store.Add("accepts_rate", now, conn.AcceptsRate)
+			}
+		}
+	}
+
+	info := h.service.GetSystemInfo()
+	h.store.Add("host_cpu_percent", now, info.Host.CPUPercent)
+	h.store.Add("host_memory_percent", now, info.Host.MemoryPercent)
+	if info.Host.Load != nil {
+		h.store.Add("host_load1", now, info.Host.Load.Load1)
+	}
+
+	if running {
+		var cpu float64
+		var rss uint64
+		workers := 0
+		for _, proc := range info.Processes {
+			cpu += proc.CPUPercent
+			rss += proc.RSS
+			if proc.Type == nginx.ProcessWorker {
+				workers++
+			}
+		}
+		h.store.Add("nginx_cpu_percent", now, cpu)
+		h.store.Add("nginx_rss_bytes", now, float64(rss))
+		h.store.Add("nginx_workers", now, float64(workers))
+	}
+}
+
+// persist 定期将历史数据写入磁盘
+func (h *HistoryHandler) persist(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := h.store.Save(); err != nil {
+			logrus.Warn("Failed to save metrics history: ", err)
+		}
+	}
+}
+
+// parseStep 解析聚合步长，支持时长字符串和秒数；未指定时按约300个点自动计算
+func parseStep(value string, from, to time.Time) (time.Duration, error) {
+	if value == "" {
+		step := to.Sub(from) / 300
+		if step < time.Second {
+			step = time.Second
+		}
+		return step.Round(time.Second), nil
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+	return time.ParseDuration(value)
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
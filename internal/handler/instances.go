@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"nginx_manager/internal/instance"
+
+	"github.com/gin-gonic/gin"
+)
+
+type InstanceHandler struct {
+	registry *instance.Registry
+}
+
+func NewInstanceHandler(registry *instance.Registry) *InstanceHandler {
+	return &InstanceHandler{
+		registry: registry,
+	}
+}
+
+// GetInstances 获取所有nginx实例及其运行状态
+func (h *InstanceHandler) GetInstances(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.registry.List(),
+	})
+}
+
+// instanceOf 按路由参数instance查找实例，旧路由没有该参数时使用默认实例；
+// 找不到时直接返回404
+func instanceOf(c *gin.Context, registry *instance.Registry) (*instance.Instance, bool) {
+	name := c.Param("instance")
+	inst, ok := registry.Get(name)
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("instance %s not found", name),
+		})
+	}
+	return inst, ok
+}
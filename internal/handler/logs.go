@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"nginx_manager/internal/instance"
+	"nginx_manager/internal/nginx"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"nginx_manager/internal/config"
+)
+
+type LogHandler struct {
+	registry *instance.Registry
+	rotators map[string]*nginx.LogRotator
+}
+
+func NewLogHandler(registry *instance.Registry) *LogHandler {
+	cfg := config.AppConfig
+	policy := nginx.RotatePolicy{
+		MaxSize:       int64(cfg.Logs.MaxSizeMB) * 1024 * 1024,
+		Interval:      cfg.Logs.Interval,
+		CheckInterval: cfg.Logs.CheckInterval,
+		Compress:      cfg.Logs.Compress,
+		MaxFiles:      cfg.Logs.MaxFiles,
+		MaxAge:        cfg.Logs.MaxAge,
+	}
+
+	// 每个实例各自轮转自己的日志目录
+	rotators := make(map[string]*nginx.LogRotator)
+	for _, inst := range registry.All() {
+		rotator := nginx.NewLogRotator(inst.Service, policy)
+		if cfg.Logs.Rotate {
+			go rotator.Run()
+		}
+		rotators[inst.Name] = rotator
+	}
+
+	return &LogHandler{
+		registry: registry,
+		rotators: rotators,
+	}
+}
+
+// Rotate 立即轮转所有日志
+func (h *LogHandler) Rotate(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	archives, err := h.rotators[inst.Name].RotateAll()
+	if err != nil {
+		logrus.Error("Failed to rotate logs: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Logs rotated successfully",
+		"data":    archives,
+	})
+}
+
+// GetArchives 获取日志归档列表
+func (h *LogHandler) GetArchives(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	archives, err := h.rotators[inst.Name].ListArchives()
+	if err != nil {
+		logrus.Error("Failed to list log archives: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    archives,
+	})
+}
+
+// Download 按时间范围和过滤条件导出日志
+func (h *LogHandler) Download(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	name := c.Param("name")
+
+	query, err := parseLogQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	files, err := inst.Service.ResolveLogFiles(name, c.Query("archives") == "true")
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	logType := c.DefaultQuery("type", nginx.DetectLogType(name))
+	exporter, err := nginx.NewLogExporter(c.Writer, c.DefaultQuery("format", nginx.ExportText))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	// 设置响应头
+	base := strings.TrimSuffix(name, ".log")
+	filename := fmt.Sprintf("%s_%s%s", base, time.Now().Format("20060102_150405"), exporter.FileExt())
+	c.Header("Content-Type", exporter.ContentType())
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	c.Status(http.StatusOK)
+
+	// 流式写出，每批条目刷新一次
+	count := 0
+	err = nginx.ScanLog(files, logType, query, func(entry *nginx.LogEntry) error {
+		if err := exporter.Write(entry); err != nil {
+			return err
+		}
+		count++
+		if count%500 == 0 {
+			if err := exporter.Flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if closeErr := exporter.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		// 响应头已发送，只能记录错误
+		logrus.Error("Failed to export log: ", err)
+		return
+	}
+
+	logrus.Infof("Log exported: %s (%d entries)", name, count)
+}
+
+// parseLogQuery 解析日志过滤参数
+func parseLogQuery(c *gin.Context) (nginx.LogQuery, error) {
+	query := nginx.LogQuery{
+		Status:     c.Query("status"),
+		Method:     c.Query("method"),
+		Level:      c.Query("level"),
+		RemoteAddr: c.Query("ip"),
+		Contains:   c.Query("q"),
+	}
+
+	var err error
+	if query.From, err = parseTimeParam(c.Query("from"), false); err != nil {
+		return query, fmt.Errorf("invalid from: %w", err)
+	}
+	if query.To, err = parseTimeParam(c.Query("to"), true); err != nil {
+		return query, fmt.Errorf("invalid to: %w", err)
+	}
+	if !query.From.IsZero() && !query.To.IsZero() && query.To.Before(query.From) {
+		return query, fmt.Errorf("to must not be earlier than from")
+	}
+	return query, nil
+}
+
+// parseTimeParam 解析时间参数，支持RFC3339、本地时间、日期和Unix时间戳；
+// 只有日期时，作为上限（endOfDay）取当天的最后时刻，使该日整天都包括在内
+func parseTimeParam(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02 15:04:05", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		if endOfDay {
+			t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+		}
+		return t, nil
+	}
+	if sec, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("unrecognized time format: %s", value)
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"net/http"
+	"nginx_manager/internal/instance"
+	"nginx_manager/internal/metrics"
+	"nginx_manager/internal/nginx"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"nginx_manager/internal/config"
+)
+
+type MetricsHandler struct {
+	service       *nginx.Service
+	configManager *nginx.ConfigManager
+	accessTailer  *nginx.LogTailer
+	mu            sync.Mutex
+}
+
+// NewMetricsHandler 创建指标处理器，nginx相关指标来自默认实例
+func NewMetricsHandler(registry *instance.Registry) *MetricsHandler {
+	cfg := config.AppConfig
+	inst := registry.Default()
+
+	handler := &MetricsHandler{
+		service:       inst.Service,
+		configManager: inst.ConfigManager,
+		accessTailer:  nginx.NewLogTailer(filepath.Join(inst.Config.LogPath, cfg.Metrics.AccessLog)),
+	}
+
+	// 定位到访问日志末尾，之后只统计新增请求
+	if err := handler.accessTailer.ReadNew(func(string) {}); err != nil {
+		logrus.Debug("Access log not available for metrics: ", err)
+	}
+
+	return handler
+}
+
+// Prometheus 以Prometheus文本格式输出指标
+func (h *MetricsHandler) Prometheus(c *gin.Context) {
+	h.collect()
+
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := metrics.DefaultRegistry.Write(c.Writer); err != nil {
+		logrus.Error("Failed to write metrics: ", err)
+	}
+}
+
+// collect 在每次抓取时刷新nginx相关的瞬时指标
+func (h *MetricsHandler) collect() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.collectProcesses()
+	h.collectBackups()
+	h.collectStubStatus()
+	h.collectAccessLog()
+
+	if h.service.ConfigValid() {
+		metrics.NginxConfigValid.Set(1)
+	} else {
+		metrics.NginxConfigValid.Set(0)
+	}
+}
+
+func (h *MetricsHandler) collectProcesses() {
+	metrics.NginxWorkers.Reset()
+	metrics.NginxProcessCPU.Reset()
+	metrics.NginxProcessMemory.Reset()
+	metrics.NginxStartTime.Reset()
+	metrics.NginxUptime.Reset()
+
+	procs, err := h.service.Processes()
+	if err != nil {
+		metrics.NginxUp.Set(0)
+		return
+	}
+	metrics.NginxUp.Set(1)
+
+	workers := make(map[string]int)
+	for _, proc := range procs {
+		pid := strconv.Itoa(int(proc.PID))
+		metrics.NginxProcessCPU.Set(proc.CPUPercent, pid, proc.Type)
+		metrics.NginxProcessMemory.Set(float64(proc.RSS), pid, proc.Type)
+
+		if proc.Type == nginx.ProcessMaster {
+			if !proc.CreateTime.IsZero() {
+				metrics.NginxStartTime.Set(float64(proc.CreateTime.Unix()))
+				metrics.NginxUptime.Set(time.Since(proc.CreateTime).Seconds())
+			}
+			continue
+		}
+		workers[proc.Type]++
+	}
+	for procType, count := range workers {
+		metrics.NginxWorkers.Set(float64(count), procType)
+	}
+}
+
+func (h *MetricsHandler) collectBackups() {
+	backups, err := h.configManager.ListBackups()
+	if err != nil {
+		return
+	}
+
+	var size int64
+	for _, backup := range backups {
+		size += backup.Size
+	}
+	metrics.BackupCount.Set(float64(len(backups)))
+	metrics.BackupSize.Set(float64(size))
+}
+
+func (h *MetricsHandler) collectStubStatus() {
+	collector := h.service.Metrics()
+	if collector == nil {
+		return
+	}
+
+	conn, err := collector.Scrape(nginx.ScrapeMetrics)
+	if err != nil {
+		logrus.Debug("Failed to scrape stub_status for metrics: ", err)
+		return
+	}
+
+	metrics.ConnectionsActive.Set(float64(conn.Active))
+	metrics.ConnectionsState.Set(float64(conn.Reading), "reading")
+	metrics.ConnectionsState.Set(float64(conn.Writing), "writing")
+	metrics.ConnectionsState.Set(float64(conn.Waiting), "waiting")
+	metrics.ConnectionsAccepted.Set(float64(conn.Accepts))
+	metrics.ConnectionsHandled.Set(float64(conn.Handled))
+	metrics.StubRequests.Set(float64(conn.Requests))
+}
+
+func (h *MetricsHandler) collectAccessLog() {
+	err := h.accessTailer.ReadNew(func(line string) {
+		entry, err := nginx.ParseAccessLine(line)
+		if err != nil {
+			return
+		}
+		metrics.AccessRequests.Inc(entry.Method, strconv.Itoa(entry.Status))
+		metrics.AccessResponseSize.Observe(float64(entry.BodyBytes))
+		if entry.RequestTime > 0 {
+			metrics.AccessRequestTime.Observe(entry.RequestTime)
+		}
+	})
+	if err != nil {
+		logrus.Debug("Failed to read access log for metrics: ", err)
+	}
+}
@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"io"
 	"net/http"
+	"nginx_manager/internal/instance"
 	"nginx_manager/internal/nginx"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -10,26 +13,35 @@ import (
 )
 
 type NginxHandler struct {
-	service *nginx.Service
+	registry *instance.Registry
 }
 
-func NewNginxHandler() *NginxHandler {
-	cfg := config.AppConfig.Nginx
-	service := nginx.NewService(
-		cfg.ExecutablePath,
-		cfg.ConfigPath,
-		cfg.LogPath,
-		cfg.PidFile,
-	)
+func NewNginxHandler(registry *instance.Registry) *NginxHandler {
+	// 为启用了stub_status的实例自动注入配置
+	if config.AppConfig.Metrics.AutoInject {
+		for _, inst := range registry.All() {
+			if inst.Service.Metrics() == nil {
+				continue
+			}
+			if _, err := inst.Service.InjectStubStatus(inst.ConfigManager); err != nil {
+				logrus.Warnf("Failed to inject stub_status location for %s: %v", inst.Name, err)
+			}
+		}
+	}
 
 	return &NginxHandler{
-		service: service,
+		registry: registry,
 	}
 }
 
 // GetStatus 获取nginx状态
 func (h *NginxHandler) GetStatus(c *gin.Context) {
-	status := h.service.GetStatus()
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	status := inst.Service.GetStatus()
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"data":    status,
@@ -38,7 +50,12 @@ func (h *NginxHandler) GetStatus(c *gin.Context) {
 
 // Start 启动nginx服务
 func (h *NginxHandler) Start(c *gin.Context) {
-	if err := h.service.Start(); err != nil {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	if err := inst.Service.StartAs(actorOf(c)); err != nil {
 		logrus.Error("Failed to start nginx: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -53,9 +70,14 @@ func (h *NginxHandler) Start(c *gin.Context) {
 	})
 }
 
-// Stop 停止nginx服务
+// Stop 优雅停止nginx服务，等待worker处理完现有请求
 func (h *NginxHandler) Stop(c *gin.Context) {
-	if err := h.service.Stop(); err != nil {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	if err := inst.Service.StopAs(actorOf(c)); err != nil {
 		logrus.Error("Failed to stop nginx: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -72,7 +94,12 @@ func (h *NginxHandler) Stop(c *gin.Context) {
 
 // Restart 重启nginx服务
 func (h *NginxHandler) Restart(c *gin.Context) {
-	if err := h.service.Restart(); err != nil {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	if err := inst.Service.RestartAs(actorOf(c)); err != nil {
 		logrus.Error("Failed to restart nginx: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -89,7 +116,12 @@ func (h *NginxHandler) Restart(c *gin.Context) {
 
 // Reload 重新加载nginx配置
 func (h *NginxHandler) Reload(c *gin.Context) {
-	if err := h.service.Reload(); err != nil {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	if err := inst.Service.Reload(); err != nil {
 		logrus.Error("Failed to reload nginx: ", err)
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"success": false,
@@ -103,3 +135,170 @@ func (h *NginxHandler) Reload(c *gin.Context) {
 		"message": "Nginx configuration reloaded successfully",
 	})
 }
+
+// FastStop 快速停止nginx服务，立即关闭所有连接
+func (h *NginxHandler) FastStop(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	if err := inst.Service.FastStopAs(actorOf(c)); err != nil {
+		logrus.Error("Failed to fast stop nginx: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Nginx stopped successfully",
+	})
+}
+
+// Reopen 重新打开nginx日志文件
+func (h *NginxHandler) Reopen(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	if err := inst.Service.Reopen(); err != nil {
+		logrus.Error("Failed to reopen nginx logs: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Nginx log files reopened",
+	})
+}
+
+// RetireWorkers 向master发送WINCH，优雅关闭所有worker
+func (h *NginxHandler) RetireWorkers(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	if err := inst.Service.RetireWorkers(); err != nil {
+		logrus.Error("Failed to retire nginx workers: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Nginx workers retired",
+	})
+}
+
+// ReloadWorkers 向master发送HUP，重新加载配置并启动新worker
+func (h *NginxHandler) ReloadWorkers(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	if err := inst.Service.ReloadWorkers(); err != nil {
+		logrus.Error("Failed to reload nginx workers: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Nginx workers reloaded",
+	})
+}
+
+// Upgrade 平滑升级nginx二进制；Accept为text/event-stream时以SSE实时推送进度，
+// 否则在完成后一次性返回所有进度事件。executable必须位于upgrade.dir中，可附带sha256校验
+func (h *NginxHandler) Upgrade(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		Executable string `json:"executable" binding:"required"`
+		SHA256     string `json:"sha256"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "executable is required",
+		})
+		return
+	}
+	actor := actorOf(c)
+
+	if strings.Contains(c.GetHeader("Accept"), "text/event-stream") {
+		events := make(chan nginx.UpgradeEvent, 64)
+		result := make(chan error, 1)
+		go func() {
+			// 客户端断开后不能阻塞升级流程，缓冲区满时丢弃进度
+			result <- inst.Service.UpgradeAs(actor, req.Executable, req.SHA256, func(event nginx.UpgradeEvent) {
+				select {
+				case events <- event:
+				default:
+				}
+			})
+			close(events)
+		}()
+
+		c.Stream(func(w io.Writer) bool {
+			if event, ok := <-events; ok {
+				c.SSEvent("progress", event)
+				return true
+			}
+			if err := <-result; err != nil {
+				c.SSEvent("error", gin.H{"success": false, "message": err.Error()})
+			} else {
+				c.SSEvent("done", gin.H{"success": true, "message": "Nginx upgraded successfully"})
+			}
+			return false
+		})
+		return
+	}
+
+	var events []nginx.UpgradeEvent
+	err := inst.Service.UpgradeAs(actor, req.Executable, req.SHA256, func(event nginx.UpgradeEvent) {
+		events = append(events, event)
+	})
+	if err != nil {
+		logrus.Error("Failed to upgrade nginx: ", err)
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+			"data":    events,
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Nginx upgraded successfully",
+		"data":    events,
+	})
+}
+
+// actorOf 识别发起操作的用户，未启用认证时使用客户端IP
+func actorOf(c *gin.Context) string {
+	if user := c.GetString(gin.AuthUserKey); user != "" {
+		return user
+	}
+	return "api@" + c.ClientIP()
+}
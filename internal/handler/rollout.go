@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"nginx_manager/internal/rollout"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RolloutHandler struct {
+	manager *rollout.Manager
+}
+
+func NewRolloutHandler(manager *rollout.Manager) *RolloutHandler {
+	return &RolloutHandler{
+		manager: manager,
+	}
+}
+
+// GetRollouts 获取发布列表
+func (h *RolloutHandler) GetRollouts(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.manager.List(),
+	})
+}
+
+// GetRollout 获取发布详情，包括每台主机的进度和事件
+func (h *RolloutHandler) GetRollout(c *gin.Context) {
+	r, ok := h.manager.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"message": fmt.Sprintf("rollout %s not found", c.Param("id")),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    r,
+	})
+}
+
+// CreateRollout 创建并开始发布
+func (h *RolloutHandler) CreateRollout(c *gin.Context) {
+	var plan rollout.Plan
+	if err := c.ShouldBindJSON(&plan); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	r, err := h.manager.Create(plan, actorOf(c))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Rollout started",
+		"data":    r,
+	})
+}
+
+// Approve 批准暂停中的发布继续
+func (h *RolloutHandler) Approve(c *gin.Context) {
+	h.control(c, "Rollout approved", func(id string) error {
+		return h.manager.Approve(id, actorOf(c))
+	})
+}
+
+// Pause 在当前批次完成后暂停发布
+func (h *RolloutHandler) Pause(c *gin.Context) {
+	h.control(c, "Rollout will pause after the current batch", func(id string) error {
+		return h.manager.Pause(id, actorOf(c))
+	})
+}
+
+// Abort 中止发布，rollback为true时恢复已更新的主机
+func (h *RolloutHandler) Abort(c *gin.Context) {
+	var req struct {
+		Rollback bool `json:"rollback"`
+	}
+	_ = c.ShouldBindJSON(&req)
+
+	h.control(c, "Rollout abort requested", func(id string) error {
+		return h.manager.Abort(id, req.Rollback, actorOf(c))
+	})
+}
+
+func (h *RolloutHandler) control(c *gin.Context, message string, action func(id string) error) {
+	if err := action(c.Param("id")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": message,
+	})
+}
@@ -0,0 +1,311 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"nginx_manager/internal/instance"
+	"nginx_manager/internal/nginx"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type SiteHandler struct {
+	registry *instance.Registry
+}
+
+// LocationRequest 添加或修改location的请求。preset不为空时按预设生成指令，
+// directives中的指令追加在预设指令之后
+type LocationRequest struct {
+	nginx.Location
+	Preset   *nginx.LocationPreset `json:"preset,omitempty"`
+	Position *int                  `json:"position,omitempty"` // 添加时插入的位置，为空时添加在最后
+}
+
+// ReorderRequest 调整location顺序的请求，order为原序号的新顺序
+type ReorderRequest struct {
+	Order []int `json:"order" binding:"required"`
+}
+
+func NewSiteHandler(registry *instance.Registry) *SiteHandler {
+	return &SiteHandler{
+		registry: registry,
+	}
+}
+
+// GetSites 获取所有站点（server块），包括已停用的
+func (h *SiteHandler) GetSites(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	sites, err := inst.ConfigManager.ListSites()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    sites,
+	})
+}
+
+// GetSite 获取单个站点
+func (h *SiteHandler) GetSite(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	site, err := inst.ConfigManager.GetSite(c.Param("id"))
+	if err != nil {
+		siteError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    site,
+	})
+}
+
+// CreateSite 添加站点，配置通过nginx -t验证后才会保留
+func (h *SiteHandler) CreateSite(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	var site nginx.Site
+	if err := c.ShouldBindJSON(&site); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	created, err := inst.ConfigManager.CreateSite(site, inst.Service.TestConfig)
+	h.respond(c, inst, created, err, "Site created successfully")
+}
+
+// UpdateSite 修改站点，server块中未涉及的指令和注释保持不变
+func (h *SiteHandler) UpdateSite(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	var site nginx.Site
+	if err := c.ShouldBindJSON(&site); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	updated, err := inst.ConfigManager.UpdateSite(c.Param("id"), site, inst.Service.TestConfig)
+	h.respond(c, inst, updated, err, "Site updated successfully")
+}
+
+// EnableSite 启用站点
+func (h *SiteHandler) EnableSite(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	site, err := inst.ConfigManager.SetSiteEnabled(c.Param("id"), true, inst.Service.TestConfig)
+	h.respond(c, inst, site, err, "Site enabled successfully")
+}
+
+// DisableSite 停用站点，server块被注释掉
+func (h *SiteHandler) DisableSite(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	site, err := inst.ConfigManager.SetSiteEnabled(c.Param("id"), false, inst.Service.TestConfig)
+	h.respond(c, inst, site, err, "Site disabled successfully")
+}
+
+// DeleteSite 删除站点
+func (h *SiteHandler) DeleteSite(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	err := inst.ConfigManager.DeleteSite(c.Param("id"), inst.Service.TestConfig)
+	h.respond(c, inst, nil, err, "Site deleted successfully")
+}
+
+// GetLocationPresets 获取可用的location预设
+func (h *SiteHandler) GetLocationPresets(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    nginx.LocationPresets,
+	})
+}
+
+// AddLocation 在站点中添加location，?preview=true时只返回生成的配置
+func (h *SiteHandler) AddLocation(c *gin.Context) {
+	var req LocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	loc, err := req.location()
+	if err != nil {
+		siteError(c, err)
+		return
+	}
+	h.changeLocations(c, nginx.LocationChange{Action: nginx.LocationAdd, Location: &loc, Position: req.Position}, "Location added successfully")
+}
+
+// UpdateLocation 修改站点中的location，嵌套的块保持不变
+func (h *SiteHandler) UpdateLocation(c *gin.Context) {
+	index, ok := locationIndex(c)
+	if !ok {
+		return
+	}
+
+	var req LocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	loc, err := req.location()
+	if err != nil {
+		siteError(c, err)
+		return
+	}
+	h.changeLocations(c, nginx.LocationChange{Action: nginx.LocationUpdate, Index: index, Location: &loc}, "Location updated successfully")
+}
+
+// DeleteLocation 删除站点中的location
+func (h *SiteHandler) DeleteLocation(c *gin.Context) {
+	index, ok := locationIndex(c)
+	if !ok {
+		return
+	}
+	h.changeLocations(c, nginx.LocationChange{Action: nginx.LocationDelete, Index: index}, "Location deleted successfully")
+}
+
+// ReorderLocations 调整站点中location的顺序
+func (h *SiteHandler) ReorderLocations(c *gin.Context) {
+	var req ReorderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "order is required",
+		})
+		return
+	}
+	h.changeLocations(c, nginx.LocationChange{Action: nginx.LocationReorder, Order: req.Order}, "Locations reordered successfully")
+}
+
+// changeLocations 执行location修改；?preview=true时返回修改后的配置文本而不保存
+func (h *SiteHandler) changeLocations(c *gin.Context, change nginx.LocationChange, message string) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	if c.Query("preview") == "true" {
+		preview, err := inst.ConfigManager.PreviewLocations(c.Param("id"), change)
+		if err != nil {
+			siteError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"success": true,
+			"data":    preview,
+		})
+		return
+	}
+
+	site, err := inst.ConfigManager.ChangeLocations(c.Param("id"), change, inst.Service.TestConfig)
+	h.respond(c, inst, site, err, message)
+}
+
+// location 按预设生成location，没有预设时直接使用请求中的指令
+func (r *LocationRequest) location() (nginx.Location, error) {
+	if r.Directives == nil {
+		r.Directives = []nginx.LocationDirective{}
+	}
+	if r.Preset == nil {
+		return r.Location, nil
+	}
+	return r.Preset.Build(r.Location)
+}
+
+func locationIndex(c *gin.Context) (int, bool) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid location index",
+		})
+		return 0, false
+	}
+	return index, true
+}
+
+// respond 修改成功后重新加载正在运行的nginx（与upstream修改一致），?reload=false时只保存不加载
+func (h *SiteHandler) respond(c *gin.Context, inst *instance.Instance, site *nginx.Site, err error, message string) {
+	if err != nil {
+		siteError(c, err)
+		return
+	}
+	logrus.Infof("%s by %s", message, actorOf(c))
+
+	reloaded := false
+	if c.Query("reload") != "false" && inst.Service.IsRunning() {
+		if err := inst.Service.Reload(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"success":  false,
+				"message":  "Site saved but reload failed: " + err.Error(),
+				"data":     site,
+				"reloaded": false,
+			})
+			return
+		}
+		reloaded = true
+		message += " and nginx reloaded"
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"message":  message,
+		"data":     site,
+		"reloaded": reloaded,
+	})
+}
+
+func siteError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, nginx.ErrSiteNotFound) || errors.Is(err, nginx.ErrLocationNotFound) {
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"success": false,
+		"message": err.Error(),
+	})
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"net/http"
+	"nginx_manager/internal/alert"
+	"nginx_manager/internal/instance"
+	"nginx_manager/internal/nginx"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"nginx_manager/internal/config"
+)
+
+type SupervisorHandler struct {
+	registry    *instance.Registry
+	supervisors map[string]*nginx.Supervisor
+	enabled     bool
+}
+
+// NewSupervisorHandler 为每个实例创建守护进程，守护事件通过告警引擎通知
+func NewSupervisorHandler(registry *instance.Registry, engine *alert.Engine) *SupervisorHandler {
+	cfg := config.AppConfig
+	policy := nginx.SupervisorPolicy{
+		CheckInterval:  cfg.Supervisor.CheckInterval,
+		BackoffInitial: cfg.Supervisor.BackoffInitial,
+		BackoffMax:     cfg.Supervisor.BackoffMax,
+		MaxRestarts:    cfg.Supervisor.MaxRestarts,
+		Window:         cfg.Supervisor.Window,
+		ErrorLogLines:  cfg.Supervisor.ErrorLogLines,
+	}
+	multiple := len(registry.All()) > 1
+
+	supervisors := make(map[string]*nginx.Supervisor)
+	for _, inst := range registry.All() {
+		name := inst.Name
+		notify := func(event nginx.SupervisorEvent) {
+			if engine == nil {
+				return
+			}
+			message := event.Message
+			if multiple {
+				message = "[" + name + "] " + message
+			}
+			if len(event.ErrorLog) > 0 {
+				message += "\n" + strings.Join(event.ErrorLog, "\n")
+			}
+			engine.Emit("nginx_supervisor_"+event.Type, supervisorSeverity(event.Type), message)
+		}
+
+		supervisor := nginx.NewSupervisor(inst.Service, policy, notify)
+		// 启动守护协程
+		if cfg.Supervisor.Enable {
+			go supervisor.Run()
+		}
+		supervisors[name] = supervisor
+	}
+
+	return &SupervisorHandler{
+		registry:    registry,
+		supervisors: supervisors,
+		enabled:     cfg.Supervisor.Enable,
+	}
+}
+
+// GetSupervisor 获取守护进程状态和最近事件
+func (h *SupervisorHandler) GetSupervisor(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"enabled":    h.enabled,
+			"supervisor": h.supervisors[inst.Name].State(),
+		},
+	})
+}
+
+func supervisorSeverity(eventType string) string {
+	switch eventType {
+	case nginx.SupervisorEventCrashed, nginx.SupervisorEventCrashLoop:
+		return alert.SeverityCritical
+	case nginx.SupervisorEventRestartFailed:
+		return alert.SeverityWarning
+	default:
+		return alert.SeverityInfo
+	}
+}
@@ -0,0 +1,28 @@
+package handler
+
+import (
+	"net/http"
+	"nginx_manager/internal/instance"
+	"nginx_manager/internal/nginx"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SystemHandler struct {
+	service *nginx.Service
+}
+
+// NewSystemHandler 创建资源监控处理器，nginx进程占用来自默认实例
+func NewSystemHandler(registry *instance.Registry) *SystemHandler {
+	return &SystemHandler{
+		service: registry.Default().Service,
+	}
+}
+
+// GetSystem 获取主机资源和nginx进程资源占用
+func (h *SystemHandler) GetSystem(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    h.service.GetSystemInfo(),
+	})
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"nginx_manager/internal/templates"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type TemplateHandler struct {
+	library *templates.Library
+}
+
+// RenderRequest 渲染模板的请求，未提供的参数使用默认值
+type RenderRequest struct {
+	Params map[string]interface{} `json:"params"`
+}
+
+func NewTemplateHandler(library *templates.Library) *TemplateHandler {
+	return &TemplateHandler{
+		library: library,
+	}
+}
+
+// GetTemplates 获取所有模板及其参数声明
+func (h *TemplateHandler) GetTemplates(c *gin.Context) {
+	list, err := h.library.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    list,
+	})
+}
+
+// GetTemplate 获取单个模板
+func (h *TemplateHandler) GetTemplate(c *gin.Context) {
+	tmpl, err := h.library.Get(c.Param("name"))
+	if err != nil {
+		templateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    tmpl,
+	})
+}
+
+// RenderTemplate 用给定参数渲染模板，返回生成的配置文本
+func (h *TemplateHandler) RenderTemplate(c *gin.Context) {
+	var req RenderRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"message": "Invalid request body",
+			})
+			return
+		}
+	}
+
+	tmpl, err := h.library.Get(c.Param("name"))
+	if err != nil {
+		templateError(c, err)
+		return
+	}
+	content, err := tmpl.Render(req.Params)
+	if err != nil {
+		templateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"kind":    tmpl.Kind,
+			"content": content,
+		},
+	})
+}
+
+// SaveTemplate 保存用户模板，同名的用户模板会被覆盖
+func (h *TemplateHandler) SaveTemplate(c *gin.Context) {
+	var tmpl templates.Template
+	if err := c.ShouldBindJSON(&tmpl); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request body",
+		})
+		return
+	}
+	tmpl.Name = c.Param("name")
+	tmpl.Builtin = false
+
+	if err := h.library.Save(&tmpl); err != nil {
+		templateError(c, err)
+		return
+	}
+	logrus.Infof("Template %s saved by %s", tmpl.Name, actorOf(c))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Template saved successfully",
+		"data":    tmpl,
+	})
+}
+
+// DeleteTemplate 删除用户模板，内置模板不能删除
+func (h *TemplateHandler) DeleteTemplate(c *gin.Context) {
+	if err := h.library.Delete(c.Param("name")); err != nil {
+		templateError(c, err)
+		return
+	}
+	logrus.Infof("Template %s deleted by %s", c.Param("name"), actorOf(c))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Template deleted successfully",
+	})
+}
+
+func templateError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, templates.ErrNotFound) {
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"success": false,
+		"message": err.Error(),
+	})
+}
@@ -0,0 +1,307 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"nginx_manager/internal/alert"
+	"nginx_manager/internal/audit"
+	"nginx_manager/internal/config"
+	"nginx_manager/internal/instance"
+	"nginx_manager/internal/nginx"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// healthActions 健康检查自动操作对应的审计动作
+var healthActions = map[string]string{
+	nginx.HealthEventMarkedDown:   "upstream.server.health_down",
+	nginx.HealthEventRestored:     "upstream.server.health_up",
+	nginx.HealthEventActionFailed: "upstream.server.health_failed",
+}
+
+type UpstreamHandler struct {
+	registry *instance.Registry
+	audit    *audit.Log
+	checkers map[string]*nginx.HealthChecker
+	enabled  bool
+}
+
+// ServerStateRequest 修改server状态的请求
+type ServerStateRequest struct {
+	Address string `json:"address" binding:"required"`
+	Force   bool   `json:"force"` // 允许让upstream失去最后一个可用的server
+}
+
+// NewUpstreamHandler 为每个实例创建健康检查器，健康事件通过告警引擎通知，自动操作记入审计日志
+func NewUpstreamHandler(registry *instance.Registry, auditLog *audit.Log, engine *alert.Engine) *UpstreamHandler {
+	cfg := config.AppConfig.HealthCheck
+	policy := nginx.HealthCheckPolicy{
+		Interval:   cfg.Interval,
+		Timeout:    cfg.Timeout,
+		Rise:       cfg.Rise,
+		Fall:       cfg.Fall,
+		AutoDown:   cfg.AutoDown,
+		FlapWindow: cfg.FlapWindow,
+		MaxFlaps:   cfg.MaxFlaps,
+	}
+	for _, check := range cfg.Checks {
+		policy.Checks = append(policy.Checks, nginx.HealthCheck{
+			Upstream:       check.Upstream,
+			Type:           strings.ToLower(check.Type),
+			Path:           check.Path,
+			Host:           check.Host,
+			ExpectedStatus: check.ExpectedStatus,
+		})
+	}
+	multiple := len(registry.All()) > 1
+
+	checkers := make(map[string]*nginx.HealthChecker)
+	for _, inst := range registry.All() {
+		name := inst.Name
+		notify := func(event nginx.HealthEvent) {
+			if action, ok := healthActions[event.Type]; ok {
+				auditLog.Record(audit.Entry{
+					At:       event.At,
+					Actor:    "health-check",
+					Instance: name,
+					Action:   action,
+					Target:   event.Upstream + "/" + event.Address,
+					Success:  event.Type != nginx.HealthEventActionFailed,
+					Error:    event.Error,
+				})
+			}
+			if engine == nil {
+				return
+			}
+			message := event.Message
+			if multiple {
+				message = "[" + name + "] " + message
+			}
+			engine.Emit("upstream_"+event.Type, healthSeverity(event.Type), message)
+		}
+
+		checker := nginx.NewHealthChecker(inst.ConfigManager, inst.Service, policy, notify)
+		// 启动健康检查协程
+		if cfg.Enable {
+			go checker.Run()
+		}
+		checkers[name] = checker
+	}
+
+	return &UpstreamHandler{
+		registry: registry,
+		audit:    auditLog,
+		checkers: checkers,
+		enabled:  cfg.Enable,
+	}
+}
+
+// GetUpstreams 获取所有upstream及其server
+func (h *UpstreamHandler) GetUpstreams(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	upstreams, err := inst.ConfigManager.ListUpstreams()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": err.Error(),
+		})
+		return
+	}
+	if h.enabled {
+		for i := range upstreams {
+			h.checkers[inst.Name].Annotate(&upstreams[i])
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    upstreams,
+	})
+}
+
+// GetUpstream 获取单个upstream，?context=stream用于stream中的同名upstream
+func (h *UpstreamHandler) GetUpstream(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	upstream, err := inst.ConfigManager.GetUpstream(c.Param("name"), c.Query("context"))
+	if err != nil {
+		upstreamError(c, err)
+		return
+	}
+	if h.enabled {
+		h.checkers[inst.Name].Annotate(upstream)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data":    upstream,
+	})
+}
+
+// GetHealth 获取健康检查是否启用及所有server的探测结果
+func (h *UpstreamHandler) GetHealth(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"data": gin.H{
+			"enabled": h.enabled,
+			"servers": h.checkers[inst.Name].List(),
+		},
+	})
+}
+
+// AddServer 向upstream添加server
+func (h *UpstreamHandler) AddServer(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	var server nginx.UpstreamServer
+	if err := c.ShouldBindJSON(&server); err != nil || server.Address == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "address is required",
+		})
+		return
+	}
+
+	h.apply(c, inst, "upstream.server.add", server.Address, strings.Join(server.Params, " "), func(test func() error) (*nginx.Upstream, error) {
+		return inst.ConfigManager.AddUpstreamServer(c.Param("name"), c.Query("context"), server, test)
+	})
+}
+
+// RemoveServer 从upstream删除server，地址通过?address=指定
+func (h *UpstreamHandler) RemoveServer(c *gin.Context) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	address := c.Query("address")
+	if address == "" {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "address is required",
+		})
+		return
+	}
+
+	h.apply(c, inst, "upstream.server.remove", address, "", func(test func() error) (*nginx.Upstream, error) {
+		return inst.ConfigManager.RemoveUpstreamServer(c.Param("name"), c.Query("context"), address, test)
+	})
+}
+
+// ServerUp 恢复被标记down或排空中的server
+func (h *UpstreamHandler) ServerUp(c *gin.Context) {
+	h.setState(c, nginx.ServerUp)
+}
+
+// ServerDown 将server标记为down
+func (h *UpstreamHandler) ServerDown(c *gin.Context) {
+	h.setState(c, nginx.ServerDown)
+}
+
+// DrainServer 排空server：改为backup，新请求只在其他server都不可用时才会发往它
+func (h *UpstreamHandler) DrainServer(c *gin.Context) {
+	h.setState(c, nginx.ServerDrain)
+}
+
+func (h *UpstreamHandler) setState(c *gin.Context, state string) {
+	inst, ok := instanceOf(c, h.registry)
+	if !ok {
+		return
+	}
+
+	var req ServerStateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "address is required",
+		})
+		return
+	}
+
+	detail := ""
+	if req.Force {
+		detail = "force"
+	}
+	h.apply(c, inst, "upstream.server."+state, req.Address, detail, func(test func() error) (*nginx.Upstream, error) {
+		return inst.ConfigManager.SetUpstreamServerState(c.Param("name"), c.Query("context"), req.Address, state, req.Force, test)
+	})
+}
+
+// apply 执行修改（通过nginx -t验证后写入），reload正在运行的nginx，并记录审计日志
+func (h *UpstreamHandler) apply(c *gin.Context, inst *instance.Instance, action, server, detail string, edit func(test func() error) (*nginx.Upstream, error)) {
+	upstream, err := edit(inst.Service.TestConfig)
+	if err == nil && inst.Service.IsRunning() {
+		if reloadErr := inst.Service.Reload(); reloadErr != nil {
+			err = fmt.Errorf("config saved but reload failed: %w", reloadErr)
+		}
+	}
+
+	entry := audit.Entry{
+		Actor:    actorOf(c),
+		Instance: inst.Name,
+		Action:   action,
+		Target:   c.Param("name") + "/" + server,
+		Detail:   detail,
+		Success:  err == nil,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	h.audit.Record(entry)
+
+	if err != nil {
+		logrus.Warnf("Upstream change %s on %s failed: %v", action, entry.Target, err)
+		upstreamError(c, err)
+		return
+	}
+	logrus.Infof("Upstream change %s on %s by %s", action, entry.Target, entry.Actor)
+
+	if h.enabled {
+		h.checkers[inst.Name].Annotate(upstream)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Upstream updated successfully",
+		"data":    upstream,
+	})
+}
+
+func healthSeverity(eventType string) string {
+	switch eventType {
+	case nginx.HealthEventUnhealthy, nginx.HealthEventActionFailed:
+		return alert.SeverityCritical
+	case nginx.HealthEventMarkedDown, nginx.HealthEventFlapping:
+		return alert.SeverityWarning
+	default:
+		return alert.SeverityInfo
+	}
+}
+
+func upstreamError(c *gin.Context, err error) {
+	status := http.StatusBadRequest
+	if errors.Is(err, nginx.ErrUpstreamNotFound) {
+		status = http.StatusNotFound
+	}
+	c.JSON(status, gin.H{
+		"success": false,
+		"message": err.Error(),
+	})
+}
@@ -3,7 +3,9 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"nginx_manager/internal/instance"
 	"nginx_manager/internal/nginx"
+	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -22,6 +24,7 @@ var upgrader = websocket.Upgrader{
 type WebSocketHandler struct {
 	nginxService *nginx.Service
 	clients      map[*websocket.Conn]bool
+	clientsMu    sync.RWMutex // 保护clients，持有写锁时才向连接写入，避免并发写同一连接
 	broadcast    chan []byte
 }
 
@@ -31,17 +34,11 @@ type WSMessage struct {
 	Time time.Time   `json:"time"`
 }
 
-func NewWebSocketHandler() *WebSocketHandler {
-	cfg := config.AppConfig.Nginx
-	service := nginx.NewService(
-		cfg.ExecutablePath,
-		cfg.ConfigPath,
-		cfg.LogPath,
-		cfg.PidFile,
-	)
-
+// NewWebSocketHandler 创建WebSocket处理器，推送默认实例的状态
+func NewWebSocketHandler(registry *instance.Registry) *WebSocketHandler {
+	cfg := config.AppConfig
 	handler := &WebSocketHandler{
-		nginxService: service,
+		nginxService: registry.Default().Service,
 		clients:      make(map[*websocket.Conn]bool),
 		broadcast:    make(chan []byte),
 	}
@@ -52,6 +49,11 @@ func NewWebSocketHandler() *WebSocketHandler {
 	// 启动状态监控协程
 	go handler.monitorStatus()
 
+	// 启动资源监控协程
+	if cfg.Metrics.SystemInterval > 0 {
+		go handler.monitorSystem(cfg.Metrics.SystemInterval)
+	}
+
 	return handler
 }
 
@@ -64,19 +66,21 @@ func (h *WebSocketHandler) HandleWebSocket(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	// 注册客户端
+	// 注册客户端并发送当前状态，持锁期间广播不会同时写入该连接
+	h.clientsMu.Lock()
 	h.clients[conn] = true
-	logrus.Info("New WebSocket client connected")
-
-	// 发送当前状态
 	h.sendCurrentStatus(conn)
+	h.clientsMu.Unlock()
+	logrus.Info("New WebSocket client connected")
 
 	// 监听客户端消息
 	for {
 		_, _, err := conn.ReadMessage()
 		if err != nil {
 			logrus.Debug("WebSocket client disconnected: ", err)
+			h.clientsMu.Lock()
 			delete(h.clients, conn)
+			h.clientsMu.Unlock()
 			break
 		}
 	}
@@ -88,6 +92,7 @@ func (h *WebSocketHandler) handleBroadcast() {
 		message := <-h.broadcast
 
 		// 向所有连接的客户端发送消息
+		h.clientsMu.Lock()
 		for client := range h.clients {
 			err := client.WriteMessage(websocket.TextMessage, message)
 			if err != nil {
@@ -96,6 +101,7 @@ func (h *WebSocketHandler) handleBroadcast() {
 				delete(h.clients, client)
 			}
 		}
+		h.clientsMu.Unlock()
 	}
 }
 
@@ -116,10 +122,31 @@ func (h *WebSocketHandler) monitorStatus() {
 				h.broadcastStatus(currentStatus)
 				lastStatus = currentStatus
 			}
+
+			// 连接指标每个周期都会变化，单独推送
+			if currentStatus.Connections != nil {
+				h.broadcastMessage("metrics", currentStatus.Connections)
+			}
 		}
 	}
 }
 
+// monitorSystem 定期推送主机和nginx进程资源占用
+func (h *WebSocketHandler) monitorSystem(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.clientsMu.RLock()
+		idle := len(h.clients) == 0
+		h.clientsMu.RUnlock()
+		if idle {
+			continue
+		}
+		h.broadcastMessage("system", h.nginxService.GetSystemInfo())
+	}
+}
+
 // sendCurrentStatus 向特定客户端发送当前状态
 func (h *WebSocketHandler) sendCurrentStatus(conn *websocket.Conn) {
 	status := h.nginxService.GetStatus()
@@ -162,6 +189,27 @@ func (h *WebSocketHandler) broadcastStatus(status *nginx.Status) {
 	}
 }
 
+// broadcastMessage 广播任意类型的消息
+func (h *WebSocketHandler) broadcastMessage(msgType string, payload interface{}) {
+	message := WSMessage{
+		Type: msgType,
+		Data: payload,
+		Time: time.Now(),
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		logrus.Errorf("Failed to marshal %s message: %v", msgType, err)
+		return
+	}
+
+	select {
+	case h.broadcast <- data:
+	default:
+		logrus.Warnf("Broadcast channel full, dropping %s message", msgType)
+	}
+}
+
 // BroadcastEvent 广播事件消息
 func (h *WebSocketHandler) BroadcastEvent(eventType, message string) {
 	wsMessage := WSMessage{
@@ -197,5 +245,8 @@ func statusChanged(old, new *nginx.Status) bool {
 	if old.ConfigValid != new.ConfigValid {
 		return true
 	}
+	if old.ReloadCount != new.ReloadCount || old.LastError != new.LastError {
+		return true
+	}
 	return false
 }
@@ -0,0 +1,139 @@
+package instance
+
+import (
+	"fmt"
+	"nginx_manager/internal/config"
+	"nginx_manager/internal/nginx"
+	"path/filepath"
+	"regexp"
+)
+
+// DefaultName 未配置instances时唯一实例的名称
+const DefaultName = "default"
+
+var namePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// Instance 一个受管理的nginx实例
+type Instance struct {
+	Name          string
+	Service       *nginx.Service
+	ConfigManager *nginx.ConfigManager
+	Config        config.InstanceConfig
+}
+
+// Info 实例概要，用于实例列表接口
+type Info struct {
+	Name       string `json:"name"`
+	Default    bool   `json:"default"`
+	ConfigPath string `json:"config_path"`
+	PidFile    string `json:"pid_file"`
+	IsRunning  bool   `json:"is_running"`
+	PID        int    `json:"pid"`
+	Monitored  bool   `json:"monitored"` // 告警、指标历史、系统监控和WebSocket状态推送只覆盖默认实例
+}
+
+// Registry 所有nginx实例，由各处理器共享；创建后不再修改，可并发读取
+type Registry struct {
+	instances   map[string]*Instance
+	order       []string
+	defaultName string
+}
+
+// NewRegistry 根据配置创建实例注册表：未配置instances时使用nginx段作为default实例，
+// 否则第一个实例为默认实例，旧的 /api/nginx 等路由作用于默认实例
+func NewRegistry(cfg *config.Config) (*Registry, error) {
+	instances := cfg.Instances
+	if len(instances) == 0 {
+		instances = []config.InstanceConfig{{
+			Name:           DefaultName,
+			ExecutablePath: cfg.Nginx.ExecutablePath,
+			ConfigPath:     cfg.Nginx.ConfigPath,
+			LogPath:        cfg.Nginx.LogPath,
+			PidFile:        cfg.Nginx.PidFile,
+			BackupDir:      cfg.Backup.BackupDir,
+		}}
+	}
+
+	r := &Registry{instances: make(map[string]*Instance)}
+	pidFiles := make(map[string]string)
+	for i, ic := range instances {
+		if !namePattern.MatchString(ic.Name) {
+			return nil, fmt.Errorf("invalid instance name %q: use lowercase letters, digits, '-' and '_'", ic.Name)
+		}
+		if _, exists := r.instances[ic.Name]; exists {
+			return nil, fmt.Errorf("duplicate instance name %q", ic.Name)
+		}
+		if ic.ExecutablePath == "" || ic.ConfigPath == "" || ic.PidFile == "" {
+			return nil, fmt.Errorf("instance %q requires executable_path, config_path and pid_file", ic.Name)
+		}
+		// 运行历史按PID文件区分实例，共用PID文件会让两个实例互相干扰
+		pidFile := filepath.Clean(ic.PidFile)
+		if other, exists := pidFiles[pidFile]; exists {
+			return nil, fmt.Errorf("instances %q and %q share pid_file %s", other, ic.Name, pidFile)
+		}
+		pidFiles[pidFile] = ic.Name
+
+		if ic.BackupDir == "" {
+			ic.BackupDir = filepath.Join(cfg.Backup.BackupDir, ic.Name)
+		}
+		if ic.StubStatusURL == "" && i == 0 {
+			ic.StubStatusURL = cfg.Metrics.StubStatusURL
+		}
+
+		service := nginx.NewService(ic.ExecutablePath, ic.ConfigPath, ic.LogPath, ic.PidFile)
+		service.EnableStubStatus(ic.StubStatusURL)
+		service.AllowUpgradesFrom(cfg.Upgrade.Dir)
+
+		r.instances[ic.Name] = &Instance{
+			Name:          ic.Name,
+			Service:       service,
+			ConfigManager: nginx.NewConfigManager(ic.ConfigPath, ic.BackupDir, cfg.Backup.MaxBackups),
+			Config:        ic,
+		}
+		r.order = append(r.order, ic.Name)
+	}
+	r.defaultName = r.order[0]
+	return r, nil
+}
+
+// Get 按名称查找实例，名称为空时返回默认实例
+func (r *Registry) Get(name string) (*Instance, bool) {
+	if name == "" {
+		name = r.defaultName
+	}
+	inst, ok := r.instances[name]
+	return inst, ok
+}
+
+// Default 返回默认实例
+func (r *Registry) Default() *Instance {
+	inst, _ := r.Get("")
+	return inst
+}
+
+// All 按配置顺序返回所有实例
+func (r *Registry) All() []*Instance {
+	all := make([]*Instance, 0, len(r.order))
+	for _, name := range r.order {
+		all = append(all, r.instances[name])
+	}
+	return all
+}
+
+// List 按配置顺序返回所有实例的概要
+func (r *Registry) List() []Info {
+	infos := []Info{}
+	for _, inst := range r.All() {
+		pid := inst.Service.PID()
+		infos = append(infos, Info{
+			Name:       inst.Name,
+			Default:    inst.Name == r.defaultName,
+			ConfigPath: inst.Config.ConfigPath,
+			PidFile:    inst.Config.PidFile,
+			IsRunning:  pid > 0,
+			PID:        pid,
+			Monitored:  inst.Name == r.defaultName,
+		})
+	}
+	return infos
+}
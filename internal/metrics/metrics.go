@@ -0,0 +1,292 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metric 可以输出为Prometheus文本格式的指标
+type Metric interface {
+	Name() string
+	Write(w io.Writer) error
+}
+
+// Registry 指标注册表
+type Registry struct {
+	mu      sync.Mutex
+	metrics []Metric
+}
+
+// DefaultRegistry 全局默认注册表
+var DefaultRegistry = &Registry{}
+
+// Register 注册指标
+func (r *Registry) Register(metrics ...Metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, metrics...)
+}
+
+// Write 按Prometheus文本格式写出所有指标
+func (r *Registry) Write(w io.Writer) error {
+	r.mu.Lock()
+	metrics := make([]Metric, len(r.metrics))
+	copy(metrics, r.metrics)
+	r.mu.Unlock()
+
+	sort.Slice(metrics, func(i, j int) bool {
+		return metrics[i].Name() < metrics[j].Name()
+	})
+	for _, m := range metrics {
+		if err := m.Write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vec 带标签的指标公共部分
+type vec struct {
+	name   string
+	help   string
+	labels []string
+	mu     sync.Mutex
+}
+
+func (v *vec) Name() string {
+	return v.name
+}
+
+func (v *vec) key(values []string) string {
+	if len(values) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", v.name, len(v.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (v *vec) header(w io.Writer, kind string) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.name, escapeHelp(v.help), v.name, kind)
+	return err
+}
+
+// labelString 生成 {a="1",b="2"} 形式的标签串，extra 为附加的标签对
+func (v *vec) labelString(key string, extra ...string) string {
+	var pairs []string
+	if len(v.labels) > 0 {
+		values := strings.Split(key, "\xff")
+		for i, label := range v.labels {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, label, escapeLabel(values[i])))
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escapeLabel(extra[i+1])))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Counter 只增计数器
+type Counter struct {
+	vec
+	values map[string]float64
+}
+
+func NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{
+		vec:    vec{name: name, help: help, labels: labels},
+		values: make(map[string]float64),
+	}
+}
+
+// Inc 计数加一
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add 计数增加指定值
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	key := c.key(labelValues)
+	c.mu.Lock()
+	c.values[key] += delta
+	c.mu.Unlock()
+}
+
+// Set 同步外部累计计数器（如stub_status）的当前值
+func (c *Counter) Set(value float64, labelValues ...string) {
+	key := c.key(labelValues)
+	c.mu.Lock()
+	c.values[key] = value
+	c.mu.Unlock()
+}
+
+func (c *Counter) Write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return writeSamples(w, &c.vec, "counter", c.values)
+}
+
+// Gauge 可增可减的瞬时值
+type Gauge struct {
+	vec
+	values map[string]float64
+}
+
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{
+		vec:    vec{name: name, help: help, labels: labels},
+		values: make(map[string]float64),
+	}
+}
+
+// Set 设置当前值
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	key := g.key(labelValues)
+	g.mu.Lock()
+	g.values[key] = value
+	g.mu.Unlock()
+}
+
+// Reset 清除所有标签组合，用于每次抓取时重新计算的指标
+func (g *Gauge) Reset() {
+	g.mu.Lock()
+	g.values = make(map[string]float64)
+	g.mu.Unlock()
+}
+
+func (g *Gauge) Write(w io.Writer) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return writeSamples(w, &g.vec, "gauge", g.values)
+}
+
+// Histogram 分桶统计
+type Histogram struct {
+	vec
+	buckets []float64
+	values  map[string]*histogramValue
+}
+
+type histogramValue struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// DefBuckets 默认的耗时分桶（秒）
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	return &Histogram{
+		vec:     vec{name: name, help: help, labels: labels},
+		buckets: sorted,
+		values:  make(map[string]*histogramValue),
+	}
+}
+
+// Observe 记录一次观测值
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	key := h.key(labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	hv, ok := h.values[key]
+	if !ok {
+		hv = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = hv
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			hv.counts[i]++
+		}
+	}
+	hv.sum += value
+	hv.count++
+}
+
+func (h *Histogram) Write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.values) == 0 {
+		return nil
+	}
+	if err := h.header(w, "histogram"); err != nil {
+		return err
+	}
+
+	for _, key := range sortedKeys(h.values) {
+		hv := h.values[key]
+		for i, bound := range h.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(key, "le", formatFloat(bound)), hv.counts[i]); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, h.labelString(key, "le", "+Inf"), hv.count); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_sum%s %s\n", h.name, h.labelString(key), formatFloat(hv.sum)); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s_count%s %d\n", h.name, h.labelString(key), hv.count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSamples 写出一组样本，调用方需持有锁
+func writeSamples(w io.Writer, v *vec, kind string, values map[string]float64) error {
+	if len(values) == 0 {
+		return nil
+	}
+	if err := v.header(w, kind); err != nil {
+		return err
+	}
+	for _, key := range sortedKeys(values) {
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", v.name, v.labelString(key), formatFloat(values[key])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
@@ -0,0 +1,75 @@
+package metrics
+
+// 管理器自身的HTTP请求指标
+var (
+	HTTPRequests = NewCounter("nginx_manager_http_requests_total",
+		"Total HTTP requests handled by the manager.", "method", "path", "status")
+	HTTPDuration = NewHistogram("nginx_manager_http_request_duration_seconds",
+		"HTTP request latency of the manager.", DefBuckets, "method", "path")
+)
+
+// nginx服务指标，进程和配置相关的gauge在每次抓取时重新计算
+var (
+	NginxUp = NewGauge("nginx_up",
+		"Whether the nginx master process is running.")
+	NginxStartTime = NewGauge("nginx_master_start_time_seconds",
+		"Start time of the nginx master process since unix epoch.")
+	NginxUptime = NewGauge("nginx_master_uptime_seconds",
+		"Uptime of the nginx master process.")
+	NginxWorkers = NewGauge("nginx_workers",
+		"Number of nginx child processes by type.", "type")
+	NginxProcessCPU = NewGauge("nginx_process_cpu_percent",
+		"CPU usage of each nginx process.", "pid", "type")
+	NginxProcessMemory = NewGauge("nginx_process_resident_memory_bytes",
+		"Resident memory of each nginx process.", "pid", "type")
+	NginxConfigValid = NewGauge("nginx_config_valid",
+		"Whether the nginx configuration passes nginx -t.")
+
+	NginxReloads = NewCounter("nginx_reloads_total",
+		"Reloads issued by the manager by result.", "result")
+	NginxLastReload = NewGauge("nginx_last_reload_timestamp_seconds",
+		"Time of the last reload issued by the manager.")
+	NginxLastReloadSuccess = NewGauge("nginx_last_reload_success",
+		"Whether the last reload issued by the manager succeeded.")
+
+	BackupCount = NewGauge("nginx_config_backups",
+		"Number of configuration backups.")
+	BackupSize = NewGauge("nginx_config_backups_size_bytes",
+		"Total size of configuration backups.")
+)
+
+// stub_status指标
+var (
+	ConnectionsActive = NewGauge("nginx_connections_active",
+		"Active client connections.")
+	ConnectionsState = NewGauge("nginx_connections",
+		"Client connections by state.", "state")
+	ConnectionsAccepted = NewCounter("nginx_connections_accepted_total",
+		"Accepted client connections.")
+	ConnectionsHandled = NewCounter("nginx_connections_handled_total",
+		"Handled client connections.")
+	StubRequests = NewCounter("nginx_http_requests_total",
+		"Total http requests reported by stub_status.")
+)
+
+// 访问日志解析得到的指标
+var (
+	AccessRequests = NewCounter("nginx_access_log_requests_total",
+		"Requests parsed from the access log.", "method", "status")
+	AccessResponseSize = NewHistogram("nginx_access_log_response_size_bytes",
+		"Response body size parsed from the access log.",
+		[]float64{100, 1000, 10000, 100000, 1000000, 10000000})
+	AccessRequestTime = NewHistogram("nginx_access_log_request_duration_seconds",
+		"Request time parsed from the access log when $request_time is logged.", DefBuckets)
+)
+
+func init() {
+	DefaultRegistry.Register(
+		HTTPRequests, HTTPDuration,
+		NginxUp, NginxStartTime, NginxUptime, NginxWorkers, NginxProcessCPU, NginxProcessMemory,
+		NginxConfigValid, NginxReloads, NginxLastReload, NginxLastReloadSuccess,
+		BackupCount, BackupSize,
+		ConnectionsActive, ConnectionsState, ConnectionsAccepted, ConnectionsHandled, StubRequests,
+		AccessRequests, AccessResponseSize, AccessRequestTime,
+	)
+}
@@ -0,0 +1,46 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"nginx_manager/internal/agent"
+	"nginx_manager/internal/config"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuthMiddleware 启用认证时要求Basic认证，认证用户作为操作者记录
+func AuthMiddleware() gin.HandlerFunc {
+	security := config.AppConfig.Security
+	if !security.EnableAuth {
+		return func(c *gin.Context) {
+			c.Next()
+		}
+	}
+	return gin.BasicAuth(gin.Accounts{security.Username: security.Password})
+}
+
+// AgentAuthMiddleware agent模式下校验控制端的Bearer令牌，token为空时只依赖mTLS；
+// 通过认证后以控制端转发的用户作为操作者
+func AgentAuthMiddleware(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token != "" {
+			provided := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+					"success": false,
+					"message": "invalid agent token",
+				})
+				return
+			}
+		}
+
+		user := "controller"
+		if forwarded := c.GetHeader(agent.ForwardedUserHeader); forwarded != "" {
+			user = "controller:" + forwarded
+		}
+		c.Set(gin.AuthUserKey, user)
+		c.Next()
+	}
+}
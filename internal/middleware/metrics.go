@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"nginx_manager/internal/metrics"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsMiddleware 统计管理器自身的HTTP请求数和耗时
+func MetricsMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		// 使用路由模板作为标签，避免路径参数造成标签爆炸
+		path := c.FullPath()
+		if path == "" {
+			path = "unmatched"
+		}
+		metrics.HTTPRequests.Inc(c.Request.Method, path, strconv.Itoa(c.Writer.Status()))
+		metrics.HTTPDuration.Observe(time.Since(start).Seconds(), c.Request.Method, path)
+	}
+}
@@ -0,0 +1,71 @@
+package nginx
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"strings"
+	"time"
+
+	"nginx_manager/internal/nginxconf"
+)
+
+// CertificateInfo 配置中引用的证书及其有效期
+type CertificateInfo struct {
+	Path     string    `json:"path"`
+	Subject  string    `json:"subject,omitempty"`
+	NotAfter time.Time `json:"not_after,omitempty"`
+	DaysLeft float64   `json:"days_left"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Certificates 扫描主配置及其include的文件，返回所有ssl_certificate证书的有效期
+func (cm *ConfigManager) Certificates() ([]CertificateInfo, error) {
+	tree, err := nginxconf.Load(cm.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]bool)
+	tree.Walk(func(node *nginxconf.Directive, parents []*nginxconf.Directive) bool {
+		// 含变量的证书路径在运行时才能确定
+		if node.Name == "ssl_certificate" && len(node.Args) > 0 && !strings.Contains(node.Args[0], "$") {
+			paths[tree.Resolve(node.Args[0])] = true
+		}
+		return true
+	})
+
+	certs := []CertificateInfo{}
+	for path := range paths {
+		certs = append(certs, inspectCertificate(path))
+	}
+	return certs, nil
+}
+
+// inspectCertificate 读取PEM证书链中的第一张证书
+func inspectCertificate(path string) CertificateInfo {
+	info := CertificateInfo{Path: path}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		info.Error = "no PEM certificate found"
+		return info
+	}
+
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+
+	info.Subject = cert.Subject.String()
+	info.NotAfter = cert.NotAfter
+	info.DaysLeft = time.Until(cert.NotAfter).Hours() / 24
+	return info
+}
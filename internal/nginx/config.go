@@ -4,8 +4,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
+	"nginx_manager/internal/nginxconf"
+
 	"github.com/sirupsen/logrus"
 )
 
@@ -13,6 +16,8 @@ type ConfigManager struct {
 	ConfigPath string
 	BackupDir  string
 	MaxBackups int
+
+	editMu sync.Mutex // 串行化站点等结构化修改的读-改-写过程
 }
 
 type BackupInfo struct {
@@ -60,6 +65,79 @@ func (cm *ConfigManager) WriteConfig(content string) error {
 	return nil
 }
 
+// commitTree 写入配置树中修改过的文件并删除removed中的文件，用test验证，失败时全部恢复
+func (cm *ConfigManager) commitTree(tree *nginxconf.Tree, removed []string, test func() error) error {
+	changes := make(map[string]*string)
+	for file, content := range tree.Modified() {
+		content := content
+		changes[file] = &content
+	}
+	for _, file := range removed {
+		changes[file] = nil
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+	return cm.applyFiles(changes, test)
+}
+
+// applyFiles 写入多个配置文件后用test验证，验证失败时恢复所有文件；
+// 内容为nil表示删除该文件。涉及主配置时先创建备份
+func (cm *ConfigManager) applyFiles(changes map[string]*string, test func() error) error {
+	type original struct {
+		content []byte
+		exists  bool
+	}
+
+	originals := make(map[string]original)
+	for file := range changes {
+		content, err := os.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		originals[file] = original{content: content, exists: err == nil}
+	}
+
+	if _, ok := changes[filepath.Clean(cm.ConfigPath)]; ok {
+		if err := cm.CreateBackup(); err != nil {
+			logrus.Warn("Failed to create backup before saving config: ", err)
+		}
+	}
+
+	restore := func() {
+		for file, orig := range originals {
+			var err error
+			if orig.exists {
+				err = os.WriteFile(file, orig.content, 0644)
+			} else if err = os.Remove(file); os.IsNotExist(err) {
+				err = nil
+			}
+			if err != nil {
+				logrus.Errorf("Failed to restore %s: %v", file, err)
+			}
+		}
+	}
+
+	for file, content := range changes {
+		var err error
+		if content == nil {
+			err = os.Remove(file)
+		} else if err = os.MkdirAll(filepath.Dir(file), 0755); err == nil {
+			err = os.WriteFile(file, []byte(*content), 0644)
+		}
+		if err != nil && !(content == nil && os.IsNotExist(err)) {
+			restore()
+			return fmt.Errorf("failed to write %s: %w", file, err)
+		}
+	}
+
+	if err := test(); err != nil {
+		restore()
+		return err
+	}
+	return nil
+}
+
 // CreateBackup 创建配置文件备份
 func (cm *ConfigManager) CreateBackup() error {
 	// 确保备份目录存在
@@ -168,52 +246,6 @@ func (cm *ConfigManager) DeleteBackup(backupID string) error {
 	return nil
 }
 
-// GetConfigTemplate 获取基础nginx配置模板
-func (cm *ConfigManager) GetConfigTemplate() string {
-	return `# 基本的nginx配置模板 - 适用于Windows
-worker_processes auto;
-
-events {
-    worker_connections 1024;
-}
-
-http {
-    include       mime.types;
-    default_type  application/octet-stream;
-
-    # 日志格式
-    log_format main '$remote_addr - $remote_user [$time_local] "$request" '
-                    '$status $body_bytes_sent "$http_referer" '
-                    '"$http_user_agent" "$http_x_forwarded_for"';
-
-    # 日志文件
-    access_log logs/access.log main;
-    error_log  logs/error.log;
-
-    # 基本设置
-    sendfile        on;
-    keepalive_timeout  65;
-
-    # 默认服务器配置
-    server {
-        listen       80;  # 监听80端口，适用于所有IP地址
-        server_name  localhost;
-
-        # 根目录
-        location / {
-            root   html;
-            index  index.html index.htm;
-        }
-
-        # 错误页面
-        error_page   500 502 503 504  /50x.html;
-        location = /50x.html {
-            root   html;
-        }
-    }
-}`
-}
-
 // cleanOldBackups 清理超过最大数量的旧备份
 func (cm *ConfigManager) cleanOldBackups() {
 	if cm.MaxBackups <= 0 {
@@ -0,0 +1,525 @@
+package nginx
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"nginx_manager/internal/nginxconf"
+)
+
+// 引用路径的检查结果
+const (
+	DependencyOK        = "ok"
+	DependencyMissing   = "missing"
+	DependencyWrongType = "wrong_type"
+	DependencyDenied    = "denied"     // worker用户没有访问权限
+	DependencyEmptyGlob = "empty_glob" // include的通配符没有匹配到任何文件
+	DependencySkipped   = "skipped"    // 含变量或由其他模块处理，运行时才能确定
+	DependencyUnknown   = "unknown"    // 无法读取路径信息
+)
+
+// 引用的路径应当是什么
+const (
+	ExpectFile      = "file"
+	ExpectDirectory = "directory"
+	ExpectAny       = "any" // alias可以指向文件或目录
+	ExpectGlob      = "glob"
+)
+
+// defaultWorkerUser 没有user指令时nginx的默认值
+const defaultWorkerUser = "nobody"
+
+// 由master进程以root读取的文件，不检查worker用户的权限
+var masterFiles = map[string]bool{
+	"include": true, "ssl_certificate": true, "ssl_certificate_key": true, "ssl_trusted_certificate": true,
+	"ssl_client_certificate": true, "ssl_dhparam": true, "ssl_crl": true, "ssl_password_file": true,
+	"access_log": true, "error_log": true,
+}
+
+// 不读取本地文件的请求处理方式，error_page的目标location使用它们时不检查文件
+var contentHandlers = []string{"proxy_pass", "fastcgi_pass", "uwsgi_pass", "scgi_pass", "grpc_pass", "memcached_pass", "return"}
+
+// Dependency 配置中引用的一个路径
+type Dependency struct {
+	Directive  string `json:"directive"`
+	Value      string `json:"value"`  // 配置中的原始写法
+	Path       string `json:"path"`   // 解析后的绝对路径
+	Expect     string `json:"expect"` // file、directory、any、glob
+	File       string `json:"file"`   // 相对于主配置目录
+	Line       int    `json:"line"`
+	Context    string `json:"context,omitempty"`
+	Exists     bool   `json:"exists"`
+	Mode       string `json:"mode,omitempty"`
+	Owner      string `json:"owner,omitempty"`   // uid:gid
+	Matches    int    `json:"matches,omitempty"` // 通配符匹配的文件数
+	Accessible *bool  `json:"accessible,omitempty"`
+	Status     string `json:"status"`
+	Severity   string `json:"severity,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+// DependencyReport 路径检查结果
+type DependencyReport struct {
+	User         string         `json:"user"` // worker进程的用户和组
+	Group        string         `json:"group"`
+	Dependencies []Dependency   `json:"dependencies"`
+	Summary      map[string]int `json:"summary"` // 各状态的数量
+	Notes        []string       `json:"notes,omitempty"`
+}
+
+// Dependencies 检查配置引用的文件和目录，content不为空时代替主配置文件的内容；
+// prefix为nginx的路径前缀（Service.Prefix）
+func (cm *ConfigManager) Dependencies(content, prefix string) (*DependencyReport, error) {
+	var tree *nginxconf.Tree
+	var err error
+	if content != "" {
+		tree, err = nginxconf.LoadContent(cm.ConfigPath, content)
+	} else {
+		tree, err = nginxconf.Load(cm.ConfigPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return CheckDependencies(tree, prefix), nil
+}
+
+// CheckDependencies 检查nginx -t不会检查的引用路径：root、alias目录，error_page的目标文件，
+// auth_basic_user_file，没有匹配到文件的include通配符，以及worker用户能否访问这些路径。
+// 与nginx一致，include、ssl_*和auth_basic_user_file相对于配置目录，root、alias和日志相对于prefix；
+// prefix为空时按常见的安装布局推断：配置目录名为conf时为其上级目录（源码安装），否则为配置目录（发行版软件包）
+func CheckDependencies(tree *nginxconf.Tree, prefix string) *DependencyReport {
+	c := &dependencyChecker{
+		tree:     tree,
+		prefix:   prefix,
+		resolver: &resolver{tree: tree},
+		report: &DependencyReport{
+			Dependencies: []Dependency{},
+			Summary:      make(map[string]int),
+		},
+	}
+	if c.prefix == "" {
+		c.prefix = tree.Prefix
+		if filepath.Base(tree.Prefix) == "conf" {
+			c.prefix = filepath.Dir(tree.Prefix)
+		}
+		c.report.Notes = append(c.report.Notes, fmt.Sprintf("nginx prefix is unknown; root, alias and log paths are resolved against %s", c.prefix))
+	}
+	c.lookupWorker()
+
+	tree.Walk(func(node *nginxconf.Directive, parents []*nginxconf.Directive) bool {
+		if !node.IsComment() && !node.Block && len(node.Args) > 0 {
+			c.visit(node, parents)
+		}
+		return true
+	})
+
+	c.report.Notes = append(c.report.Notes, c.resolver.notes...)
+	for _, dep := range c.report.Dependencies {
+		c.report.Summary[dep.Status]++
+	}
+	return c.report
+}
+
+type dependencyChecker struct {
+	tree     *nginxconf.Tree
+	prefix   string // nginx的路径前缀
+	resolver *resolver
+	worker   *workerIdentity
+	report   *DependencyReport
+}
+
+// workerIdentity worker进程的uid和所属的组
+type workerIdentity struct {
+	uid  uint32
+	gids map[uint32]bool
+}
+
+// lookupWorker 按主配置中的user指令确定worker用户，省略组时使用与用户同名的组
+func (c *dependencyChecker) lookupWorker() {
+	name, group := defaultWorkerUser, ""
+	for _, node := range expandChildren(c.tree, &c.tree.Root().Directive) {
+		if node.Name == "user" && !node.Block && len(node.Args) > 0 {
+			name = node.Args[0]
+			if len(node.Args) > 1 {
+				group = node.Args[1]
+			}
+		}
+	}
+	c.report.User = name
+
+	if !ownersSupported {
+		c.report.Group = group
+		c.report.Notes = append(c.report.Notes, "file permissions are not checked on this platform")
+		return
+	}
+	worker, group, err := lookupWorker(name, group)
+	c.report.Group = group
+	if err != nil {
+		c.report.Notes = append(c.report.Notes, fmt.Sprintf("permissions for worker user %s were not checked: %v", name, err))
+		return
+	}
+	c.worker = worker
+}
+
+// lookupWorker 查找用户及其附加组，返回实际使用的组名
+func lookupWorker(name, group string) (*workerIdentity, string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, group, err
+	}
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, group, fmt.Errorf("unexpected uid %q", u.Uid)
+	}
+	worker := &workerIdentity{uid: uint32(uid), gids: make(map[uint32]bool)}
+
+	// nginx以initgroups设置附加组，主组为user指令中的组；没有同名的组时使用用户的主组
+	ids, _ := u.GroupIds()
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return nil, group, err
+		}
+		ids = append(ids, g.Gid)
+	} else if g, err := user.LookupGroup(name); err == nil {
+		group = g.Name
+		ids = append(ids, g.Gid)
+	} else {
+		ids = append(ids, u.Gid)
+		if g, err := user.LookupGroupId(u.Gid); err == nil {
+			group = g.Name
+		}
+	}
+	for _, id := range ids {
+		if gid, err := strconv.ParseUint(id, 10, 32); err == nil {
+			worker.gids[uint32(gid)] = true
+		}
+	}
+	return worker, group, nil
+}
+
+// can worker用户对文件是否有perm（4读、2写、1执行）权限，无法获取属主时第二个返回值为false
+func (w *workerIdentity) can(info os.FileInfo, perm os.FileMode) (bool, bool) {
+	if w.uid == 0 {
+		return true, true
+	}
+	uid, gid, ok := fileOwner(info)
+	if !ok {
+		return false, false
+	}
+	mode := info.Mode().Perm()
+	switch {
+	case uid == w.uid:
+		return mode>>6&perm == perm, true
+	case w.gids[gid]:
+		return mode>>3&perm == perm, true
+	default:
+		return mode&perm == perm, true
+	}
+}
+
+func (c *dependencyChecker) visit(node *nginxconf.Directive, parents []*nginxconf.Directive) {
+	value := node.Args[0]
+	switch node.Name {
+	case "root":
+		c.check(node, parents, value, c.resolve(value), ExpectDirectory)
+	case "alias":
+		expect := ExpectAny
+		if len(parents) > 0 {
+			if modifier, _ := locationArgs(parents[len(parents)-1]); modifier == "=" {
+				expect = ExpectFile
+			}
+		}
+		c.check(node, parents, value, c.resolve(value), expect)
+	case "auth_basic_user_file":
+		c.check(node, parents, value, c.tree.Resolve(value), ExpectFile)
+	case "ssl_certificate", "ssl_certificate_key", "ssl_trusted_certificate", "ssl_client_certificate",
+		"ssl_dhparam", "ssl_crl", "ssl_password_file":
+		// 证书可以直接写在配置中，私钥可以由OpenSSL engine提供
+		if strings.HasPrefix(value, "data:") || strings.HasPrefix(value, "engine:") {
+			return
+		}
+		c.check(node, parents, value, c.tree.Resolve(value), ExpectFile)
+	case "include":
+		if strings.ContainsAny(value, "*?[") {
+			c.checkGlob(node, parents, value)
+		} else {
+			c.check(node, parents, value, c.tree.Resolve(value), ExpectFile)
+		}
+	case "access_log", "error_log":
+		if value == "off" || value == "stderr" || strings.HasPrefix(value, "syslog:") || strings.HasPrefix(value, "memory:") {
+			return
+		}
+		c.checkLog(node, parents, value)
+	case "error_page":
+		c.checkErrorPage(node, parents)
+	}
+}
+
+// check 检查路径是否存在、类型是否正确，以及worker用户能否访问
+func (c *dependencyChecker) check(node *nginxconf.Directive, parents []*nginxconf.Directive, value, path, expect string) {
+	dep := c.dependency(node, parents, value, path, expect)
+	if strings.Contains(value, "$") {
+		c.add(dep, DependencySkipped, "contains variables, resolved at request time")
+		return
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			c.add(dep, DependencyMissing, fmt.Sprintf("%s does not exist", path))
+		} else {
+			c.add(dep, DependencyUnknown, err.Error())
+		}
+		return
+	}
+	c.describe(&dep, info)
+
+	switch {
+	case expect == ExpectFile && info.IsDir():
+		c.add(dep, DependencyWrongType, fmt.Sprintf("%s is a directory, %s expects a file", path, node.Name))
+		return
+	case expect == ExpectDirectory && !info.IsDir():
+		c.add(dep, DependencyWrongType, fmt.Sprintf("%s is not a directory", path))
+		return
+	}
+
+	if c.worker == nil || masterFiles[node.Name] {
+		c.add(dep, DependencyOK, "")
+		return
+	}
+	// 目录只需要能进入，文件需要能读取，上级目录都需要能进入
+	var perm os.FileMode = 4
+	if info.IsDir() {
+		perm = 1
+	}
+	allowed, known := c.worker.can(info, perm)
+	if !known {
+		c.add(dep, DependencyOK, "")
+		return
+	}
+	if allowed {
+		if dir, blocked := c.traversable(filepath.Dir(path)); blocked {
+			allowed = false
+			dep.Accessible = &allowed
+			c.add(dep, DependencyDenied, fmt.Sprintf("worker user %s cannot enter %s", c.report.User, dir))
+			return
+		}
+	}
+	dep.Accessible = &allowed
+	if !allowed {
+		action := "read"
+		if info.IsDir() {
+			action = "enter"
+		}
+		c.add(dep, DependencyDenied, fmt.Sprintf("worker user %s cannot %s %s (mode %s)", c.report.User, action, path, dep.Mode))
+		return
+	}
+	c.add(dep, DependencyOK, "")
+}
+
+// traversable 检查从根目录到dir的每一级目录worker用户都能进入，返回第一个不能进入的目录
+func (c *dependencyChecker) traversable(dir string) (string, bool) {
+	var dirs []string
+	for {
+		dirs = append(dirs, dir)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		info, err := os.Stat(dirs[i])
+		if err != nil {
+			continue
+		}
+		if allowed, known := c.worker.can(info, 1); known && !allowed {
+			return dirs[i], true
+		}
+	}
+	return "", false
+}
+
+// checkGlob include的通配符必须至少匹配一个文件，否则nginx静默忽略
+func (c *dependencyChecker) checkGlob(node *nginxconf.Directive, parents []*nginxconf.Directive, value string) {
+	path := c.tree.Resolve(value)
+	dep := c.dependency(node, parents, value, path, ExpectGlob)
+	matches, err := filepath.Glob(path)
+	if err != nil {
+		c.add(dep, DependencyUnknown, err.Error())
+		return
+	}
+	dep.Matches = len(matches)
+	if len(matches) == 0 {
+		_, statErr := os.Stat(filepath.Dir(path))
+		if os.IsNotExist(statErr) {
+			c.add(dep, DependencyEmptyGlob, fmt.Sprintf("directory %s does not exist, nothing is included", filepath.Dir(path)))
+		} else {
+			c.add(dep, DependencyEmptyGlob, "pattern matches no files, nothing is included")
+		}
+		return
+	}
+	dep.Exists = true
+	c.add(dep, DependencyOK, "")
+}
+
+// checkLog 日志文件由nginx创建，只需要所在目录存在
+func (c *dependencyChecker) checkLog(node *nginxconf.Directive, parents []*nginxconf.Directive, value string) {
+	path := c.resolve(value)
+	if _, err := os.Stat(path); !os.IsNotExist(err) || strings.Contains(value, "$") {
+		c.check(node, parents, value, path, ExpectFile)
+		return
+	}
+
+	dep := c.dependency(node, parents, value, path, ExpectFile)
+	dir := filepath.Dir(path)
+	dirInfo, err := os.Stat(dir)
+	switch {
+	case err != nil && os.IsNotExist(err):
+		c.add(dep, DependencyMissing, fmt.Sprintf("log directory %s does not exist", dir))
+	case err != nil:
+		c.add(dep, DependencyUnknown, err.Error())
+	case !dirInfo.IsDir():
+		c.add(dep, DependencyWrongType, fmt.Sprintf("%s is not a directory", dir))
+	default:
+		c.add(dep, DependencyOK, "file does not exist yet and will be created")
+	}
+}
+
+// checkErrorPage error_page的目标URI在server中重新选择location，按该location的root或alias找到文件
+func (c *dependencyChecker) checkErrorPage(node *nginxconf.Directive, parents []*nginxconf.Directive) {
+	target := node.Args[len(node.Args)-1]
+	// @name和完整URL不是本地文件
+	if !strings.HasPrefix(target, "/") {
+		return
+	}
+	uri, _, _ := strings.Cut(target, "?")
+	if strings.Contains(uri, "$") {
+		c.add(c.dependency(node, parents, target, "", ExpectFile), DependencySkipped, "contains variables, resolved at request time")
+		return
+	}
+
+	chain := parents
+	for i, block := range parents {
+		if block.Name == "server" {
+			locations, _ := c.resolver.findLocation(block, normalizeURI(uri))
+			chain = append(parents[:i+1:i+1], locations...)
+			break
+		}
+	}
+
+	last := chain[len(chain)-1]
+	if last.Name == "location" {
+		for _, child := range expandChildren(c.tree, last) {
+			for _, handler := range contentHandlers {
+				if child.Name == handler {
+					dep := c.dependency(node, parents, target, "", ExpectFile)
+					c.add(dep, DependencySkipped, fmt.Sprintf("served by %s in location %s", handler, strings.Join(last.Args, " ")))
+					return
+				}
+			}
+		}
+	}
+
+	path, ok := c.documentPath(chain, uri)
+	if !ok {
+		c.add(c.dependency(node, parents, target, "", ExpectFile), DependencySkipped, "document root contains variables")
+		return
+	}
+	c.check(node, parents, target, path, ExpectFile)
+}
+
+// documentPath 与ngx_http_map_uri_to_path一致：最内层location的alias替换匹配的前缀，否则拼接生效的root
+func (c *dependencyChecker) documentPath(chain []*nginxconf.Directive, uri string) (string, bool) {
+	last := chain[len(chain)-1]
+	if last.Name == "location" {
+		for _, child := range expandChildren(c.tree, last) {
+			if child.Name != "alias" || len(child.Args) == 0 {
+				continue
+			}
+			alias := child.Args[0]
+			if strings.Contains(alias, "$") {
+				return "", false
+			}
+			modifier, prefix := locationArgs(last)
+			if modifier == "" || modifier == "^~" {
+				return c.resolve(alias + strings.TrimPrefix(uri, prefix)), true
+			}
+			return c.resolve(alias), true
+		}
+	}
+
+	root := "html"
+	for i := len(chain) - 1; i >= 0; i-- {
+		var found *nginxconf.Directive
+		for _, child := range expandChildren(c.tree, chain[i]) {
+			if child.Name == "root" && len(child.Args) > 0 {
+				found = child
+			}
+		}
+		if found != nil {
+			root = found.Args[0]
+			break
+		}
+	}
+	if strings.Contains(root, "$") {
+		return "", false
+	}
+	return c.resolve(root) + uri, true
+}
+
+// resolve 把root、alias和日志的相对路径解析为相对于prefix的路径
+func (c *dependencyChecker) resolve(path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(c.prefix, path)
+}
+
+func (c *dependencyChecker) dependency(node *nginxconf.Directive, parents []*nginxconf.Directive, value, path, expect string) Dependency {
+	return Dependency{
+		Directive: node.Name,
+		Value:     value,
+		Path:      path,
+		Expect:    expect,
+		File:      c.relative(node.File),
+		Line:      node.Line,
+		Context:   describeContext(c.tree, parents),
+	}
+}
+
+// describe 记录路径的权限和属主
+func (c *dependencyChecker) describe(dep *Dependency, info os.FileInfo) {
+	dep.Exists = true
+	dep.Mode = info.Mode().String()
+	if uid, gid, ok := fileOwner(info); ok {
+		dep.Owner = fmt.Sprintf("%d:%d", uid, gid)
+	}
+}
+
+func (c *dependencyChecker) add(dep Dependency, status, message string) {
+	dep.Status = status
+	dep.Message = message
+	switch status {
+	case DependencyMissing, DependencyWrongType, DependencyDenied:
+		dep.Severity = SeverityCritical
+	case DependencyEmptyGlob, DependencyUnknown:
+		dep.Severity = SeverityWarning
+	case DependencySkipped:
+		dep.Severity = SeverityInfo
+	}
+	c.report.Dependencies = append(c.report.Dependencies, dep)
+}
+
+// relative 相对于主配置目录的路径
+func (c *dependencyChecker) relative(file string) string {
+	if rel, err := filepath.Rel(c.tree.Prefix, file); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return file
+}
@@ -0,0 +1,486 @@
+package nginx
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 健康检查方式
+const (
+	HealthCheckTCP   = "tcp"
+	HealthCheckHTTP  = "http"
+	HealthCheckHTTPS = "https"
+)
+
+// server的健康状态
+const (
+	HealthUnknown   = "unknown"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// 健康检查事件
+const (
+	HealthEventUnhealthy     = "server_unhealthy"
+	HealthEventHealthy       = "server_healthy"
+	HealthEventMarkedDown    = "server_marked_down"
+	HealthEventRestored      = "server_restored"
+	HealthEventActionFailed  = "action_failed"
+	HealthEventFlapping      = "server_flapping"
+	HealthEventFlappingEnded = "server_flapping_ended"
+
+	maxConcurrentProbes = 16
+)
+
+// HealthCheck 一个upstream的探测方式，Upstream为空时作为默认
+type HealthCheck struct {
+	Upstream       string `json:"upstream,omitempty"`
+	Type           string `json:"type"`                      // tcp、http或https
+	Path           string `json:"path,omitempty"`            // http(s)请求路径，默认为/
+	Host           string `json:"host,omitempty"`            // http(s)请求的Host头，默认为server地址
+	ExpectedStatus []int  `json:"expected_status,omitempty"` // 为空时接受200-399
+}
+
+// HealthCheckPolicy 健康检查策略
+type HealthCheckPolicy struct {
+	Interval   time.Duration
+	Timeout    time.Duration
+	Rise       int  // 连续成功多少次视为恢复
+	Fall       int  // 连续失败多少次视为故障
+	AutoDown   bool // 自动将故障server标记down，恢复后去掉
+	FlapWindow time.Duration
+	MaxFlaps   int // FlapWindow内状态变化达到该次数视为抖动，暂停自动操作
+	Checks     []HealthCheck
+}
+
+// ServerHealth 一个server的探测结果
+type ServerHealth struct {
+	Upstream   string     `json:"upstream"`
+	Context    string     `json:"context"`
+	Address    string     `json:"address"`
+	Status     string     `json:"status"`
+	Check      string     `json:"check"` // 如 tcp、http /healthz
+	LastCheck  *time.Time `json:"last_check,omitempty"`
+	LastChange *time.Time `json:"last_change,omitempty"`
+	LastError  string     `json:"last_error,omitempty"`
+	LatencyMs  float64    `json:"latency_ms"`
+	Successes  int        `json:"successes"` // 连续成功次数
+	Failures   int        `json:"failures"`  // 连续失败次数
+	Flapping   bool       `json:"flapping"`
+	AutoDown   bool       `json:"auto_down"` // 当前被健康检查标记为down
+}
+
+// HealthEvent 健康状态变化或自动操作
+type HealthEvent struct {
+	Type     string    `json:"type"`
+	Upstream string    `json:"upstream"`
+	Context  string    `json:"context"`
+	Address  string    `json:"address"`
+	Message  string    `json:"message"`
+	At       time.Time `json:"at"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// HealthChecker 定期探测upstream中的server，可选地自动标记down和恢复
+type HealthChecker struct {
+	cm      *ConfigManager
+	service *Service
+	policy  HealthCheckPolicy
+	notify  func(HealthEvent)
+
+	mu      sync.Mutex
+	servers map[string]*serverHealthState
+}
+
+type serverHealthState struct {
+	health      ServerHealth
+	transitions []time.Time
+	refused     bool // 自动操作失败，状态再次变化前不再重试
+}
+
+type probeResult struct {
+	upstream Upstream
+	server   UpstreamServer
+	check    HealthCheck
+	latency  time.Duration
+	err      error
+}
+
+// NewHealthChecker 创建健康检查器，notify在每个事件发生时调用，可为nil
+func NewHealthChecker(cm *ConfigManager, service *Service, policy HealthCheckPolicy, notify func(HealthEvent)) *HealthChecker {
+	if policy.Interval <= 0 {
+		policy.Interval = 10 * time.Second
+	}
+	if policy.Timeout <= 0 {
+		policy.Timeout = 3 * time.Second
+	}
+	if policy.Rise <= 0 {
+		policy.Rise = 1
+	}
+	if policy.Fall <= 0 {
+		policy.Fall = 1
+	}
+	return &HealthChecker{
+		cm:      cm,
+		service: service,
+		policy:  policy,
+		notify:  notify,
+		servers: make(map[string]*serverHealthState),
+	}
+}
+
+// Run 定期执行健康检查，阻塞运行
+func (hc *HealthChecker) Run() {
+	ticker := time.NewTicker(hc.policy.Interval)
+	defer ticker.Stop()
+
+	hc.Check(time.Now())
+	for now := range ticker.C {
+		hc.Check(now)
+	}
+}
+
+// Check 探测所有upstream中的server一次，启用AutoDown时按结果修改配置
+func (hc *HealthChecker) Check(now time.Time) {
+	upstreams, err := hc.cm.ListUpstreams()
+	if err != nil {
+		logrus.Warn("Health check: failed to read upstreams: ", err)
+		return
+	}
+
+	results := hc.probeAll(upstreams)
+
+	hc.mu.Lock()
+	seen := make(map[string]bool)
+	var failed, recovered []ServerHealth
+	for _, r := range results {
+		key := healthKey(r.upstream.Context, r.upstream.Name, r.server.Address)
+		seen[key] = true
+		state := hc.update(key, r, now)
+		if !hc.policy.AutoDown || state.health.Flapping || state.refused {
+			continue
+		}
+		switch {
+		case state.health.Status == HealthUnhealthy && !r.server.Down:
+			failed = append(failed, state.health)
+		case state.health.Status == HealthHealthy && r.server.HealthDown:
+			recovered = append(recovered, state.health)
+		}
+	}
+	for key := range hc.servers {
+		if !seen[key] {
+			delete(hc.servers, key)
+		}
+	}
+	hc.mu.Unlock()
+
+	hc.act(failed, recovered)
+}
+
+// List 返回所有server的探测结果
+func (hc *HealthChecker) List() []ServerHealth {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	list := make([]ServerHealth, 0, len(hc.servers))
+	for _, state := range hc.servers {
+		list = append(list, state.health)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Context != list[j].Context {
+			return list[i].Context < list[j].Context
+		}
+		if list[i].Upstream != list[j].Upstream {
+			return list[i].Upstream < list[j].Upstream
+		}
+		return list[i].Address < list[j].Address
+	})
+	return list
+}
+
+// Annotate 为upstream中的server附上探测结果
+func (hc *HealthChecker) Annotate(upstreams ...*Upstream) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	for _, upstream := range upstreams {
+		for i := range upstream.Servers {
+			server := &upstream.Servers[i]
+			if state, ok := hc.servers[healthKey(upstream.Context, upstream.Name, server.Address)]; ok {
+				health := state.health
+				server.Health = &health
+			}
+		}
+	}
+}
+
+func (hc *HealthChecker) probeAll(upstreams []Upstream) []probeResult {
+	var results []probeResult
+	for _, upstream := range upstreams {
+		check := hc.checkFor(upstream)
+		for _, server := range upstream.Servers {
+			results = append(results, probeResult{upstream: upstream, server: server, check: check})
+		}
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentProbes)
+	for i := range results {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(r *probeResult) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			start := time.Now()
+			r.err = hc.probe(r.check, r.server.Address)
+			r.latency = time.Since(start)
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
+
+// checkFor 选择upstream的探测方式：按名称匹配，否则使用默认，stream中的upstream总是使用tcp
+func (hc *HealthChecker) checkFor(upstream Upstream) HealthCheck {
+	check := HealthCheck{Type: HealthCheckTCP}
+	for _, c := range hc.policy.Checks {
+		if c.Upstream == upstream.Name {
+			check = c
+			break
+		}
+		if c.Upstream == "" {
+			check = c
+		}
+	}
+	if upstream.Context == "stream" || check.Type == "" {
+		check.Type = HealthCheckTCP
+	}
+	if check.Type != HealthCheckTCP && check.Path == "" {
+		check.Path = "/"
+	}
+	return check
+}
+
+// probe 探测一个server，返回nil表示健康
+func (hc *HealthChecker) probe(check HealthCheck, address string) error {
+	network, target := dialTarget(address)
+
+	if check.Type == HealthCheckTCP {
+		conn, err := net.DialTimeout(network, target, hc.policy.Timeout)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	}
+
+	host := check.Host
+	if host == "" {
+		host = target
+		if network == "unix" {
+			host = "localhost"
+		}
+	}
+	dialer := &net.Dialer{Timeout: hc.policy.Timeout}
+	client := &http.Client{
+		Timeout: hc.policy.Timeout,
+		Transport: &http.Transport{
+			// 总是连接server地址，Host头和SNI使用配置的host
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return dialer.DialContext(ctx, network, target)
+			},
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: true, ServerName: hostOnly(host)},
+			DisableKeepAlives: true,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(check.Type + "://" + host + check.Path)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if !expectedStatus(check.ExpectedStatus, resp.StatusCode) {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// update 记录一次探测结果，连续成功Rise次或连续失败Fall次后改变状态
+func (hc *HealthChecker) update(key string, r probeResult, now time.Time) *serverHealthState {
+	state, ok := hc.servers[key]
+	if !ok {
+		state = &serverHealthState{health: ServerHealth{
+			Upstream: r.upstream.Name,
+			Context:  r.upstream.Context,
+			Address:  r.server.Address,
+			Status:   HealthUnknown,
+		}}
+		// 带有健康检查停用标记的server（如管理程序重启前被自动停用）视为不健康，同样需要连续成功Rise次才恢复
+		if r.server.HealthDown {
+			state.health.Status = HealthUnhealthy
+		}
+		hc.servers[key] = state
+	}
+
+	h := &state.health
+	checkedAt := now
+	h.LastCheck = &checkedAt
+	h.Check = r.check.Type
+	if r.check.Type != HealthCheckTCP {
+		h.Check += " " + r.check.Path
+	}
+	h.LatencyMs = float64(r.latency.Microseconds()) / 1000
+	h.AutoDown = r.server.HealthDown
+
+	previous := h.Status
+	if r.err == nil {
+		h.Successes++
+		h.Failures = 0
+		h.LastError = ""
+		// 首次探测成功直接视为健康，故障恢复需要连续成功Rise次
+		if previous == HealthUnknown || (previous == HealthUnhealthy && h.Successes >= hc.policy.Rise) {
+			h.Status = HealthHealthy
+		}
+	} else {
+		h.Failures++
+		h.Successes = 0
+		h.LastError = r.err.Error()
+		if previous != HealthUnhealthy && h.Failures >= hc.policy.Fall {
+			h.Status = HealthUnhealthy
+		}
+	}
+
+	if h.Status != previous {
+		h.LastChange = &checkedAt
+		state.refused = false
+		if previous != HealthUnknown {
+			state.transitions = append(state.transitions, now)
+		}
+		if h.Status == HealthUnhealthy {
+			hc.emit(HealthEvent{Type: HealthEventUnhealthy, Message: fmt.Sprintf("%s in upstream %s is unhealthy: %s", h.Address, h.Upstream, h.LastError), Error: h.LastError}, h, now)
+		} else if previous == HealthUnhealthy {
+			hc.emit(HealthEvent{Type: HealthEventHealthy, Message: fmt.Sprintf("%s in upstream %s is healthy again", h.Address, h.Upstream)}, h, now)
+		}
+	}
+
+	hc.updateFlapping(state, now)
+	return state
+}
+
+// updateFlapping 统计FlapWindow内的状态变化次数，判断是否抖动
+func (hc *HealthChecker) updateFlapping(state *serverHealthState, now time.Time) {
+	if hc.policy.MaxFlaps <= 0 || hc.policy.FlapWindow <= 0 {
+		return
+	}
+
+	recent := state.transitions[:0]
+	for _, t := range state.transitions {
+		if now.Sub(t) < hc.policy.FlapWindow {
+			recent = append(recent, t)
+		}
+	}
+	state.transitions = recent
+
+	h := &state.health
+	flapping := len(recent) >= hc.policy.MaxFlaps
+	if flapping == h.Flapping {
+		return
+	}
+	h.Flapping = flapping
+	if flapping {
+		hc.emit(HealthEvent{Type: HealthEventFlapping, Message: fmt.Sprintf("%s in upstream %s changed state %d times in %s, automatic actions paused", h.Address, h.Upstream, len(recent), hc.policy.FlapWindow)}, h, now)
+	} else {
+		hc.emit(HealthEvent{Type: HealthEventFlappingEnded, Message: fmt.Sprintf("%s in upstream %s is stable again, automatic actions resumed", h.Address, h.Upstream)}, h, now)
+	}
+}
+
+// act 标记故障server为down、恢复已健康的server，有修改且nginx正在运行时reload一次
+func (hc *HealthChecker) act(failed, recovered []ServerHealth) {
+	changed := false
+	run := func(h ServerHealth, state, eventType, message string) {
+		_, err := hc.cm.setServerState(h.Upstream, h.Context, h.Address, state, false, hc.service.TestConfig)
+		now := time.Now()
+		if err != nil {
+			hc.mu.Lock()
+			if state, ok := hc.servers[healthKey(h.Context, h.Upstream, h.Address)]; ok {
+				state.refused = true
+			}
+			hc.mu.Unlock()
+			hc.emit(HealthEvent{Type: HealthEventActionFailed, Message: fmt.Sprintf("could not update %s in upstream %s: %v", h.Address, h.Upstream, err), Error: err.Error()}, &h, now)
+			return
+		}
+		changed = true
+		hc.emit(HealthEvent{Type: eventType, Message: message}, &h, now)
+	}
+
+	for _, h := range failed {
+		run(h, serverFailed, HealthEventMarkedDown, fmt.Sprintf("%s in upstream %s marked down after failed health checks", h.Address, h.Upstream))
+	}
+	for _, h := range recovered {
+		run(h, serverRecovered, HealthEventRestored, fmt.Sprintf("%s in upstream %s restored after passing health checks", h.Address, h.Upstream))
+	}
+
+	if changed && hc.service.IsRunning() {
+		if err := hc.service.Reload(); err != nil {
+			logrus.Warn("Health check: reload failed: ", err)
+			hc.emit(HealthEvent{Type: HealthEventActionFailed, Message: "upstream config updated but reload failed: " + err.Error(), Error: err.Error()}, &ServerHealth{}, time.Now())
+		}
+	}
+}
+
+func (hc *HealthChecker) emit(event HealthEvent, h *ServerHealth, now time.Time) {
+	event.Upstream = h.Upstream
+	event.Context = h.Context
+	event.Address = h.Address
+	event.At = now
+	logrus.Infof("Health check: %s", event.Message)
+	if hc.notify != nil {
+		hc.notify(event)
+	}
+}
+
+func healthKey(context, upstream, address string) string {
+	return context + "/" + upstream + "/" + address
+}
+
+// dialTarget 将server地址转换为可连接的地址，unix:开头的为unix socket，未指定端口时为80
+func dialTarget(address string) (network, target string) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return "unix", path
+	}
+	if _, _, err := net.SplitHostPort(address); err == nil {
+		return "tcp", address
+	}
+	return "tcp", net.JoinHostPort(strings.Trim(address, "[]"), "80")
+}
+
+func hostOnly(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+func expectedStatus(expected []int, status int) bool {
+	if len(expected) == 0 {
+		return status >= 200 && status < 400
+	}
+	for _, code := range expected {
+		if code == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,216 @@
+package nginx
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+const (
+	ActorExternal   = "external"   // 不是通过管理器发起的操作
+	ActorManager    = "manager"    // 管理器内部发起，未指明具体用户
+	ActorSupervisor = "supervisor" // 守护进程自动重启
+)
+
+// ActionRecord 一次启动或停止操作的记录
+type ActionRecord struct {
+	Actor string    `json:"actor"`
+	At    time.Time `json:"at"`
+}
+
+// serviceHistory nginx实例的运行历史；同一PID文件的多个Service共享一份
+type serviceHistory struct {
+	mu               sync.Mutex
+	lastReloadAt     time.Time
+	lastReloadResult string
+	reloadCount      int
+	lastStart        *ActionRecord
+	lastStop         *ActionRecord
+	lastError        string
+	lastErrorAt      time.Time
+	lastStopRequest  time.Time // 最近一次通过管理器请求停止的时间，无论停止是否成功
+
+	masterPID  int32
+	workerPIDs map[int32]bool
+}
+
+var (
+	historiesMu sync.Mutex
+	histories   = make(map[string]*serviceHistory)
+)
+
+// history 返回该nginx实例共享的运行历史
+func (s *Service) history() *serviceHistory {
+	key := filepath.Clean(s.PidFile)
+
+	historiesMu.Lock()
+	defer historiesMu.Unlock()
+
+	h, ok := histories[key]
+	if !ok {
+		h = &serviceHistory{}
+		histories[key] = h
+	}
+	return h
+}
+
+// recordReload 记录一次由管理器发起的reload
+func (h *serviceHistory) recordReload(err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastReloadAt = time.Now()
+	if err != nil {
+		h.lastReloadResult = "failure"
+		h.setError(fmt.Errorf("reload failed: %w", err))
+		return
+	}
+	h.lastReloadResult = "success"
+	h.reloadCount++
+}
+
+// recordStart 记录启动操作
+func (h *serviceHistory) recordStart(actor string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err != nil {
+		h.setError(fmt.Errorf("start failed: %w", err))
+		return
+	}
+	h.lastStart = &ActionRecord{Actor: actor, At: time.Now()}
+	h.masterPID = 0
+	h.workerPIDs = nil
+}
+
+// requestStop 在停止前标记本次退出是预期的，守护进程据此不做自动重启
+func (h *serviceHistory) requestStop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastStopRequest = time.Now()
+}
+
+// stopRequestedSince 判断since之后是否通过管理器请求过停止
+func (h *serviceHistory) stopRequestedSince(since time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return !h.lastStopRequest.Before(since)
+}
+
+// recordStop 记录停止操作
+func (h *serviceHistory) recordStop(actor string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if err != nil {
+		h.setError(fmt.Errorf("stop failed: %w", err))
+		return
+	}
+	h.lastStop = &ActionRecord{Actor: actor, At: time.Now()}
+	h.masterPID = 0
+	h.workerPIDs = nil
+}
+
+func (h *serviceHistory) setError(err error) {
+	h.lastError = err.Error()
+	h.lastErrorAt = time.Now()
+}
+
+// observe 根据当前master和worker进程推断管理器之外发生的启动、停止和reload
+func (h *serviceHistory) observe(master *process.Process) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if master == nil {
+		if h.masterPID != 0 {
+			h.lastStop = &ActionRecord{Actor: ActorExternal, At: time.Now()}
+		}
+		h.masterPID = 0
+		h.workerPIDs = nil
+		return
+	}
+
+	if h.masterPID != master.Pid {
+		// master晚于最近一次管理器启动操作创建，说明是在管理器之外启动的
+		at := time.Now()
+		if created, err := master.CreateTime(); err == nil {
+			at = time.UnixMilli(created)
+		}
+		if h.lastStart == nil || at.After(h.lastStart.At.Add(2*time.Second)) {
+			h.lastStart = &ActionRecord{Actor: ActorExternal, At: at}
+		}
+		h.masterPID = master.Pid
+		h.workerPIDs = nil
+	}
+
+	children, err := master.Children()
+	if err != nil || len(children) == 0 {
+		return
+	}
+
+	current := make(map[int32]bool, len(children))
+	spawned := 0
+	for _, child := range children {
+		current[child.Pid] = true
+		if !h.workerPIDs[child.Pid] {
+			spawned++
+		}
+	}
+
+	// 新出现的worker不少于之前的worker数，说明整批worker被替换，即发生了reload
+	// （例如外部执行了nginx -s reload）；管理器自己的reload已经记录过，短时间内忽略
+	recent := time.Since(h.lastReloadAt) < 10*time.Second
+	if len(h.workerPIDs) > 0 && spawned >= len(h.workerPIDs) && !recent {
+		h.lastReloadAt = time.Now()
+		h.lastReloadResult = "success"
+		h.reloadCount++
+	}
+	h.workerPIDs = current
+}
+
+// apply 将运行历史填充到状态中
+func (h *serviceHistory) apply(status *Status) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status.ReloadCount = h.reloadCount
+	status.LastReloadResult = h.lastReloadResult
+	if !h.lastReloadAt.IsZero() {
+		t := h.lastReloadAt
+		status.LastReloadAt = &t
+	}
+	status.LastStart = h.lastStart
+	status.LastStop = h.lastStop
+	status.LastError = h.lastError
+	if !h.lastErrorAt.IsZero() {
+		t := h.lastErrorAt
+		status.LastErrorAt = &t
+	}
+}
+
+// formatUptime 将时长格式化为 3d 4h 5m 6s 形式
+func formatUptime(d time.Duration) string {
+	d = d.Round(time.Second)
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	seconds := (d - minutes*time.Minute) / time.Second
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh %dm %ds", days, hours, minutes, seconds)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm %ds", hours, minutes, seconds)
+	case minutes > 0:
+		return fmt.Sprintf("%dm %ds", minutes, seconds)
+	default:
+		return fmt.Sprintf("%ds", seconds)
+	}
+}
@@ -0,0 +1,496 @@
+package nginx
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"nginx_manager/internal/nginxconf"
+)
+
+// 检查结果的严重程度，与告警一致
+const (
+	SeverityInfo     = "info"
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// 静态检查规则
+const (
+	RuleProxyPassURI     = "proxy-pass-uri"
+	RuleAddHeaderInherit = "add-header-inheritance"
+	RuleIfInLocation     = "if-in-location"
+	RuleServerTokens     = "server-tokens"
+	RuleAliasTraversal   = "alias-traversal"
+	RuleDuplicateServer  = "duplicate-server"
+	RuleWeakProtocols    = "weak-ssl-protocols"
+	RuleWeakCiphers      = "weak-ssl-ciphers"
+	RuleRootInLocation   = "root-in-location"
+)
+
+// LintRule 检查规则说明
+type LintRule struct {
+	ID          string `json:"id"`
+	Severity    string `json:"severity"` // 该规则可能给出的最高严重程度
+	Description string `json:"description"`
+}
+
+// LintRules 所有检查规则
+var LintRules = []LintRule{
+	{RuleProxyPassURI, SeverityWarning, "proxy_pass URI and location prefix disagree on the trailing slash, producing joined or doubled slashes"},
+	{RuleAddHeaderInherit, SeverityWarning, "add_header in a nested block silently drops all add_header directives of the enclosing block"},
+	{RuleIfInLocation, SeverityWarning, "if inside location with anything other than return or rewrite ... last"},
+	{RuleServerTokens, SeverityWarning, "server_tokens is not off, so the nginx version is disclosed"},
+	{RuleAliasTraversal, SeverityCritical, "alias and location prefix disagree on the trailing slash; without it on the location, ../ escapes the alias directory"},
+	{RuleDuplicateServer, SeverityWarning, "the same server_name on the same listen address in several server blocks; nginx ignores all but the first"},
+	{RuleWeakProtocols, SeverityCritical, "ssl_protocols enables SSLv2, SSLv3, TLSv1 or TLSv1.1"},
+	{RuleWeakCiphers, SeverityWarning, "ssl_ciphers allows NULL, export, RC4, DES, MD5 or anonymous ciphers"},
+	{RuleRootInLocation, SeverityInfo, "root only set inside locations, so other requests fall back to the default html directory"},
+}
+
+// LintFinding 静态检查发现的问题
+type LintFinding struct {
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+	File     string `json:"file"` // 相对于主配置目录
+	Line     int    `json:"line"`
+	Context  string `json:"context,omitempty"` // 所在的块，如 http > server example.com > location /api/
+	Hint     string `json:"hint"`
+}
+
+// LintReport 检查结果
+type LintReport struct {
+	Findings []LintFinding  `json:"findings"`
+	Summary  map[string]int `json:"summary"` // 各严重程度的数量
+}
+
+var (
+	weakProtocols = map[string]bool{"SSLv2": true, "SSLv3": true, "TLSv1": true, "TLSv1.1": true}
+	// weakCipherParts OpenSSL密码套件名或关键字中表示弱算法的部分
+	weakCipherParts = map[string]bool{
+		"NULL": true, "ENULL": true, "ANULL": true, "EXP": true, "EXPORT": true, "EXPORT40": true, "EXPORT56": true,
+		"RC4": true, "RC2": true, "DES": true, "3DES": true, "CBC3": true, "MD5": true, "ADH": true, "AECDH": true,
+		"LOW": true, "ALL": true,
+	}
+)
+
+// Lint 静态检查配置，content不为空时代替主配置文件的内容（include的文件仍从磁盘读取）
+func (cm *ConfigManager) Lint(content string) (*LintReport, error) {
+	var tree *nginxconf.Tree
+	var err error
+	if content != "" {
+		tree, err = nginxconf.LoadContent(cm.ConfigPath, content)
+	} else {
+		tree, err = nginxconf.Load(cm.ConfigPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	report := &LintReport{
+		Findings: LintTree(tree),
+		Summary:  map[string]int{SeverityCritical: 0, SeverityWarning: 0, SeverityInfo: 0},
+	}
+	for _, finding := range report.Findings {
+		report.Summary[finding.Severity]++
+	}
+	return report, nil
+}
+
+// LintTree 检查nginx -t不会报错但通常是配置错误或不安全的写法
+func LintTree(tree *nginxconf.Tree) []LintFinding {
+	l := &linter{tree: tree, findings: []LintFinding{}}
+	l.walk(&tree.Root().Directive, nil)
+	sort.SliceStable(l.findings, func(i, j int) bool {
+		a, b := l.findings[i], l.findings[j]
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	return l.findings
+}
+
+type linter struct {
+	tree     *nginxconf.Tree
+	findings []LintFinding
+}
+
+func (l *linter) report(rule, severity string, node *nginxconf.Directive, parents []*nginxconf.Directive, message, hint string) {
+	l.findings = append(l.findings, LintFinding{
+		Rule:     rule,
+		Severity: severity,
+		Message:  message,
+		File:     l.relative(node.File),
+		Line:     node.Line,
+		Context:  describeContext(l.tree, parents),
+		Hint:     hint,
+	})
+}
+
+// relative 相对于主配置目录的路径
+func (l *linter) relative(file string) string {
+	if rel, err := filepath.Rel(l.tree.Prefix, file); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return file
+}
+
+func (l *linter) walk(block *nginxconf.Directive, parents []*nginxconf.Directive) {
+	for _, node := range expandChildren(l.tree, block) {
+		l.check(node, parents)
+		if node.Block {
+			l.walk(node, append(parents[:len(parents):len(parents)], node))
+		}
+	}
+}
+
+// check 对单个节点执行规则，parents为从外到内的块指令
+func (l *linter) check(node *nginxconf.Directive, parents []*nginxconf.Directive) {
+	var parent *nginxconf.Directive
+	if len(parents) > 0 {
+		parent = parents[len(parents)-1]
+	}
+	inLocation := parent != nil && parent.Name == "location"
+
+	switch node.Name {
+	case "http":
+		if node.Block && parent == nil {
+			l.checkServerTokens(node)
+			l.checkDuplicateServers(node)
+			l.checkHeaders(node, []*nginxconf.Directive{node}, nil)
+		}
+	case "server_tokens":
+		if len(node.Args) > 0 && node.Args[0] != "off" {
+			l.report(RuleServerTokens, SeverityWarning, node, parents,
+				fmt.Sprintf("server_tokens %s discloses the nginx version in the Server header and error pages", node.Args[0]),
+				"use server_tokens off;")
+		}
+	case "proxy_pass":
+		if inLocation {
+			l.checkProxyPass(node, parent, parents)
+		}
+	case "alias":
+		if inLocation {
+			l.checkAlias(node, parent, parents)
+		}
+	case "root":
+		if inLocation {
+			l.checkRoot(node, parents)
+		}
+	case "if":
+		if node.Block && inLocation {
+			l.checkIf(node, parents)
+		}
+	case "ssl_protocols":
+		var weak []string
+		for _, protocol := range node.Args {
+			if weakProtocols[protocol] {
+				weak = append(weak, protocol)
+			}
+		}
+		if len(weak) > 0 {
+			l.report(RuleWeakProtocols, SeverityCritical, node, parents,
+				fmt.Sprintf("ssl_protocols enables deprecated %s", strings.Join(weak, ", ")),
+				"use ssl_protocols TLSv1.2 TLSv1.3;")
+		}
+	case "ssl_ciphers":
+		if len(node.Args) == 0 {
+			return
+		}
+		if weak := weakCiphers(node.Args[0]); len(weak) > 0 {
+			l.report(RuleWeakCiphers, SeverityWarning, node, parents,
+				fmt.Sprintf("ssl_ciphers allows weak ciphers: %s", strings.Join(weak, ", ")),
+				"exclude them with !, e.g. ssl_ciphers HIGH:!aNULL:!MD5:!RC4:!3DES; or use a modern list such as ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES256-GCM-SHA384:ECDHE-RSA-AES256-GCM-SHA384")
+		}
+	}
+}
+
+// checkProxyPass 前缀location中，proxy_pass带URI时location的前缀被替换为该URI，两者结尾的斜杠应一致
+func (l *linter) checkProxyPass(node, location *nginxconf.Directive, parents []*nginxconf.Directive) {
+	prefix, ok := prefixLocation(location)
+	if !ok || len(node.Args) == 0 || strings.Contains(node.Args[0], "$") {
+		return
+	}
+	target, err := url.Parse(node.Args[0])
+	if err != nil || target.Host == "" || target.Path == "" {
+		return
+	}
+
+	uri := target.Path
+	switch {
+	case strings.HasSuffix(prefix, "/") && !strings.HasSuffix(uri, "/"):
+		l.report(RuleProxyPassURI, SeverityWarning, node, parents,
+			fmt.Sprintf("location %s replaces its prefix with %s, so %sfile is proxied as %sfile", prefix, uri, prefix, uri),
+			fmt.Sprintf("add a trailing slash to the proxy_pass URI (%s/) or remove it from the location", strings.TrimSuffix(node.Args[0], "/")))
+	case !strings.HasSuffix(prefix, "/") && strings.HasSuffix(uri, "/"):
+		l.report(RuleProxyPassURI, SeverityWarning, node, parents,
+			fmt.Sprintf("location %s replaces its prefix with %s, so %s/file is proxied as %s/file", prefix, uri, prefix, uri),
+			fmt.Sprintf("add a trailing slash to the location (location %s/) or remove it from the proxy_pass URI", prefix))
+	}
+}
+
+// checkAlias 前缀location中alias替换location的前缀，两者结尾的斜杠不一致时路径拼接错误或可以跳出alias目录
+func (l *linter) checkAlias(node, location *nginxconf.Directive, parents []*nginxconf.Directive) {
+	prefix, ok := prefixLocation(location)
+	if !ok || len(node.Args) == 0 || strings.Contains(node.Args[0], "$") {
+		return
+	}
+
+	alias := node.Args[0]
+	switch {
+	case !strings.HasSuffix(prefix, "/") && strings.HasSuffix(alias, "/"):
+		l.report(RuleAliasTraversal, SeverityCritical, node, parents,
+			fmt.Sprintf("location %s without a trailing slash and alias %s allow path traversal: %s../ maps to the parent of %s", prefix, alias, prefix, alias),
+			fmt.Sprintf("add a trailing slash to the location (location %s/)", prefix))
+	case strings.HasSuffix(prefix, "/") && !strings.HasSuffix(alias, "/"):
+		l.report(RuleAliasTraversal, SeverityWarning, node, parents,
+			fmt.Sprintf("alias %s has no trailing slash, so %sfile maps to %sfile", alias, prefix, alias),
+			fmt.Sprintf("add a trailing slash to the alias (alias %s/)", alias))
+	}
+}
+
+// checkRoot location中的root只作用于该location，server没有root时其他请求使用默认的html目录
+func (l *linter) checkRoot(node *nginxconf.Directive, parents []*nginxconf.Directive) {
+	for _, block := range parents[:len(parents)-1] {
+		if block.Name == "location" {
+			continue
+		}
+		for _, child := range expandChildren(l.tree, block) {
+			if child.Name == "root" && !child.Block {
+				return
+			}
+		}
+	}
+	l.report(RuleRootInLocation, SeverityInfo, node, parents,
+		"root is only set inside this location; requests handled by other locations use the default html directory",
+		"set root in the server block and override it in a location only where needed")
+}
+
+// checkIf location中的if只有return和rewrite ... last是可靠的，其他指令的行为常常不符合预期
+func (l *linter) checkIf(node *nginxconf.Directive, parents []*nginxconf.Directive) {
+	for _, child := range expandChildren(l.tree, node) {
+		if child.Name == "return" || (child.Name == "rewrite" && len(child.Args) > 0 && child.Args[len(child.Args)-1] == "last") {
+			continue
+		}
+		l.report(RuleIfInLocation, SeverityWarning, node, parents,
+			fmt.Sprintf("if inside location with %s is unreliable; only return and rewrite ... last are safe", child.Name),
+			"use map, try_files or a separate location instead, or limit the if block to return or rewrite ... last")
+		return
+	}
+}
+
+// checkServerTokens http块没有关闭server_tokens，且有server块没有自行关闭时报告
+func (l *linter) checkServerTokens(http *nginxconf.Directive) {
+	var servers []*nginxconf.Directive
+	for _, child := range expandChildren(l.tree, http) {
+		switch {
+		case child.Name == "server_tokens":
+			return
+		case child.Name == "server" && child.Block:
+			servers = append(servers, child)
+		}
+	}
+	for _, server := range servers {
+		// server中设置了server_tokens时由该指令自己的检查负责
+		set := false
+		for _, child := range expandChildren(l.tree, server) {
+			if child.Name == "server_tokens" {
+				set = true
+			}
+		}
+		if !set {
+			l.report(RuleServerTokens, SeverityWarning, http, nil,
+				"server_tokens is not set, so the nginx version is disclosed in the Server header and error pages",
+				"add server_tokens off; to the http block")
+			return
+		}
+	}
+}
+
+// checkDuplicateServers 同一监听地址上重复的server_name，nginx -t只给出警告并忽略后面的server
+func (l *linter) checkDuplicateServers(http *nginxconf.Directive) {
+	type owner struct {
+		server *nginxconf.Directive
+		listen string
+	}
+	seen := make(map[string]owner)
+
+	for _, server := range expandChildren(l.tree, http) {
+		if server.Name != "server" || !server.Block {
+			continue
+		}
+		var listens []string
+		var names []*nginxconf.Directive
+		for _, child := range expandChildren(l.tree, server) {
+			switch child.Name {
+			case "listen":
+				if len(child.Args) > 0 {
+					listens = append(listens, child.Args[0])
+				}
+			case "server_name":
+				names = append(names, child)
+			}
+		}
+		if len(listens) == 0 {
+			listens = []string{"80"}
+		}
+		if len(names) == 0 {
+			names = []*nginxconf.Directive{nginxconf.New("server_name", "")}
+			names[0].Line = server.Line
+			names[0].File = server.File
+		}
+
+		reported := make(map[string]bool)
+		for _, listen := range listens {
+			key := listenKey(listen)
+			for _, node := range names {
+				for _, name := range node.Args {
+					pair := key + " " + strings.ToLower(name)
+					first, ok := seen[pair]
+					if !ok {
+						seen[pair] = owner{server, listen}
+						continue
+					}
+					if first.server == server || reported[pair] {
+						continue
+					}
+					reported[pair] = true
+					l.report(RuleDuplicateServer, SeverityWarning, node, []*nginxconf.Directive{http, server},
+						fmt.Sprintf("server_name %q on %s is already defined at %s:%d; nginx ignores this server for it", name, listen, l.relative(first.server.File), first.server.Line),
+						"remove the duplicate name or merge the two server blocks")
+				}
+			}
+		}
+	}
+}
+
+// checkHeaders 块中有add_header时不继承外层的add_header，外层设置而本层没有重新设置的头会丢失
+func (l *linter) checkHeaders(block *nginxconf.Directive, parents []*nginxconf.Directive, inherited []*nginxconf.Directive) {
+	children := expandChildren(l.tree, block)
+	var own []*nginxconf.Directive
+	for _, child := range children {
+		if child.Name == "add_header" && !child.Block && len(child.Args) > 0 {
+			own = append(own, child)
+		}
+	}
+
+	if len(own) > 0 {
+		defined := make(map[string]bool)
+		for _, node := range own {
+			defined[strings.ToLower(node.Args[0])] = true
+		}
+		var lost []string
+		for _, node := range inherited {
+			if !defined[strings.ToLower(node.Args[0])] {
+				lost = append(lost, node.Args[0])
+			}
+		}
+		if len(lost) > 0 {
+			l.report(RuleAddHeaderInherit, SeverityWarning, own[0], parents,
+				fmt.Sprintf("add_header here drops %s set in the enclosing block", strings.Join(lost, ", ")),
+				"repeat the enclosing block's add_header directives here, e.g. from a shared include file")
+		}
+		inherited = own
+	}
+
+	for _, child := range children {
+		if child.Block && (child.Name == "server" || child.Name == "location" || child.Name == "if") {
+			l.checkHeaders(child, append(parents[:len(parents):len(parents)], child), inherited)
+		}
+	}
+}
+
+// weakCiphers 返回密码套件列表中未被排除的弱套件或关键字
+func weakCiphers(list string) []string {
+	var weak []string
+	for _, item := range strings.FieldsFunc(list, func(r rune) bool { return r == ':' || r == ' ' || r == ',' }) {
+		if strings.HasPrefix(item, "!") || strings.HasPrefix(item, "-") {
+			continue
+		}
+		for _, part := range strings.FieldsFunc(strings.TrimPrefix(item, "+"), func(r rune) bool { return r == '-' || r == '+' }) {
+			if weakCipherParts[strings.ToUpper(part)] {
+				weak = append(weak, item)
+				break
+			}
+		}
+	}
+	return weak
+}
+
+// expandChildren 块的子节点（不含注释），include指令替换为被引入文件的内容
+func expandChildren(tree *nginxconf.Tree, block *nginxconf.Directive) []*nginxconf.Directive {
+	return appendChildren(nil, tree, block, make(map[*nginxconf.Document]bool))
+}
+
+func appendChildren(nodes []*nginxconf.Directive, tree *nginxconf.Tree, block *nginxconf.Directive, active map[*nginxconf.Document]bool) []*nginxconf.Directive {
+	for _, child := range block.Children {
+		if child.IsComment() {
+			continue
+		}
+		if child.Name != "include" || child.Block {
+			nodes = append(nodes, child)
+			continue
+		}
+		for _, doc := range tree.Included(child) {
+			// 防止文件互相include导致死循环
+			if active[doc] {
+				continue
+			}
+			active[doc] = true
+			nodes = appendChildren(nodes, tree, &doc.Directive, active)
+			delete(active, doc)
+		}
+	}
+	return nodes
+}
+
+// prefixLocation 前缀匹配（包括^~）的location的路径，其他location返回false
+func prefixLocation(location *nginxconf.Directive) (string, bool) {
+	if len(location.Args) == 0 {
+		return "", false
+	}
+	modifier, path := locationArgs(location)
+	return path, modifier == "" || modifier == "^~"
+}
+
+// listenKey 用于比较的监听地址：只有相同的地址和端口才视为同一监听，
+// 0.0.0.0、*和省略地址为*:port，IPv6通配地址为[::]:port
+func listenKey(listen string) string {
+	host, port, ok := splitListen(listen)
+	switch {
+	case !ok:
+		return listen
+	case host == "" && strings.HasPrefix(listen, "["):
+		return "[::]:" + port
+	case host == "":
+		return "*:" + port
+	case strings.Contains(host, ":"):
+		return "[" + host + "]:" + port
+	}
+	return host + ":" + port
+}
+
+// describeContext 块的路径，如 http > server example.com > location /api/
+func describeContext(tree *nginxconf.Tree, parents []*nginxconf.Directive) string {
+	parts := make([]string, 0, len(parents))
+	for _, block := range parents {
+		label := block.Name
+		switch {
+		case block.Name == "server":
+			for _, child := range expandChildren(tree, block) {
+				if child.Name == "server_name" && len(child.Args) > 0 {
+					label += " " + child.Args[0]
+					break
+				}
+			}
+		case len(block.Args) > 0:
+			label += " " + strings.Join(block.Args, " ")
+		}
+		parts = append(parts, label)
+	}
+	return strings.Join(parts, " > ")
+}
@@ -0,0 +1,301 @@
+package nginx
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"nginx_manager/internal/nginxconf"
+)
+
+// location预设类型
+const (
+	PresetProxy    = "proxy"    // 反向代理
+	PresetStatic   = "static"   // 静态文件
+	PresetSPA      = "spa"      // 单页应用，找不到的路径回退到index.html
+	PresetRedirect = "redirect" // 301/302等跳转
+	PresetReturn   = "return"   // 直接返回状态码和内容
+)
+
+// 对站点location的修改
+const (
+	LocationAdd     = "add"
+	LocationUpdate  = "update"
+	LocationDelete  = "delete"
+	LocationReorder = "reorder"
+)
+
+// ErrLocationNotFound 站点中没有该序号的location
+var ErrLocationNotFound = errors.New("location not found")
+
+// LocationPresetInfo 预设说明，供前端展示
+type LocationPresetInfo struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Fields      []string `json:"fields"` // 该预设使用的LocationPreset字段
+}
+
+// LocationPresets 所有可用的location预设
+var LocationPresets = []LocationPresetInfo{
+	{PresetProxy, "Reverse proxy with standard forwarding headers, optional WebSocket upgrade", []string{"target", "websocket"}},
+	{PresetStatic, "Static files with caching headers", []string{"target", "expires"}},
+	{PresetSPA, "Single page application: unknown paths fall back to /index.html", []string{"target"}},
+	{PresetRedirect, "Redirect to another URL (301, 302, 307 or 308)", []string{"target", "status"}},
+	{PresetReturn, "Return a status code with optional text", []string{"status", "text"}},
+}
+
+// LocationPreset 按预设生成location中的指令
+type LocationPreset struct {
+	Type      string `json:"type"`
+	Target    string `json:"target,omitempty"`    // proxy为proxy_pass地址，static和spa为root目录，redirect为跳转地址
+	Status    int    `json:"status,omitempty"`    // redirect默认301，return必填
+	Text      string `json:"text,omitempty"`      // return的响应内容
+	WebSocket bool   `json:"websocket,omitempty"` // proxy是否支持WebSocket升级
+	Expires   string `json:"expires,omitempty"`   // static的缓存时间，默认30d
+}
+
+// LocationChange 对站点location的一次修改
+type LocationChange struct {
+	Action   string
+	Index    int       // update、delete的location序号，与Site.Locations一致
+	Location *Location // add、update的新内容
+	Position *int      // add时插入的位置，为空时添加在最后
+	Order    []int     // reorder时原序号的新顺序
+}
+
+// LocationPreview 修改后的配置文本
+type LocationPreview struct {
+	Location string `json:"location,omitempty"` // 新增或修改的location块
+	Server   string `json:"server"`             // 修改后的整个server块
+}
+
+// Build 按预设生成location，loc中已有的指令追加在预设指令之后
+func (p *LocationPreset) Build(loc Location) (Location, error) {
+	var directives []LocationDirective
+	add := func(name string, args ...string) {
+		directives = append(directives, LocationDirective{Name: name, Args: args})
+	}
+
+	switch p.Type {
+	case PresetProxy:
+		target, err := url.Parse(p.Target)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return loc, fmt.Errorf("proxy target must be an http:// or https:// URL")
+		}
+		if (loc.Modifier == "~" || loc.Modifier == "~*") && target.Path != "" {
+			return loc, fmt.Errorf("proxy target cannot have a URI part in a regular expression location")
+		}
+		add("proxy_pass", p.Target)
+		add("proxy_http_version", "1.1")
+		add("proxy_set_header", "Host", "$host")
+		add("proxy_set_header", "X-Real-IP", "$remote_addr")
+		add("proxy_set_header", "X-Forwarded-For", "$proxy_add_x_forwarded_for")
+		add("proxy_set_header", "X-Forwarded-Proto", "$scheme")
+		if p.WebSocket {
+			add("proxy_set_header", "Upgrade", "$http_upgrade")
+			add("proxy_set_header", "Connection", "upgrade")
+			add("proxy_read_timeout", "3600s")
+		} else {
+			add("proxy_set_header", "Connection", "")
+		}
+	case PresetStatic:
+		if p.Target != "" {
+			add("root", p.Target)
+		}
+		expires := p.Expires
+		if expires == "" {
+			expires = "30d"
+		}
+		add("try_files", "$uri", "=404")
+		// expires已设置Cache-Control；不用add_header，否则server级的add_header在该location中失效
+		add("expires", expires)
+		add("access_log", "off")
+	case PresetSPA:
+		if p.Target != "" {
+			add("root", p.Target)
+		}
+		add("index", "index.html")
+		add("try_files", "$uri", "$uri/", "/index.html")
+	case PresetRedirect:
+		if p.Target == "" {
+			return loc, fmt.Errorf("redirect target is required")
+		}
+		status := p.Status
+		if status == 0 {
+			status = 301
+		}
+		if status != 301 && status != 302 && status != 307 && status != 308 {
+			return loc, fmt.Errorf("invalid redirect status %d", status)
+		}
+		add("return", strconv.Itoa(status), p.Target)
+	case PresetReturn:
+		if p.Status < 100 || p.Status > 999 {
+			return loc, fmt.Errorf("return requires a status code")
+		}
+		if p.Text != "" {
+			add("return", strconv.Itoa(p.Status), p.Text)
+		} else {
+			add("return", strconv.Itoa(p.Status))
+		}
+	default:
+		return loc, fmt.Errorf("unknown location preset %q", p.Type)
+	}
+
+	loc.Directives = append(directives, loc.Directives...)
+	return loc, nil
+}
+
+// ChangeLocations 修改站点的location并用test验证，失败时恢复原配置
+func (cm *ConfigManager) ChangeLocations(id string, change LocationChange, test func() error) (*Site, error) {
+	cm.editMu.Lock()
+	defer cm.editMu.Unlock()
+
+	tree, err := nginxconf.Load(cm.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := findSite(tree, id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := change.apply(ref.server); err != nil {
+		return nil, err
+	}
+	return cm.commitSiteEdit(tree, ref, test)
+}
+
+// PreviewLocations 返回修改后的配置文本，不写入文件
+func (cm *ConfigManager) PreviewLocations(id string, change LocationChange) (*LocationPreview, error) {
+	tree, err := nginxconf.Load(cm.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := findSite(tree, id)
+	if err != nil {
+		return nil, err
+	}
+	node, err := change.apply(ref.server)
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &LocationPreview{Server: ref.server.Text("")}
+	if node != nil {
+		preview.Location = node.Text("")
+	}
+	return preview, nil
+}
+
+// apply 在server块中执行修改，返回新增或修改的location块
+func (change *LocationChange) apply(server *nginxconf.Directive) (*nginxconf.Directive, error) {
+	nodes := locationNodes(server)
+	at := func(i int) (*nginxconf.Directive, error) {
+		if i < 0 || i >= len(nodes) {
+			return nil, fmt.Errorf("%w: %d", ErrLocationNotFound, i)
+		}
+		return nodes[i], nil
+	}
+
+	switch change.Action {
+	case LocationAdd, LocationUpdate:
+		if change.Location == nil {
+			return nil, fmt.Errorf("location is required")
+		}
+		loc := change.Location
+		if err := loc.validate(); err != nil {
+			return nil, err
+		}
+
+		var node *nginxconf.Directive
+		if change.Action == LocationUpdate {
+			var err error
+			if node, err = at(change.Index); err != nil {
+				return nil, err
+			}
+		}
+		for _, other := range nodes {
+			if other != node && strings.Join(other.Args, " ") == strings.Join(loc.args(), " ") {
+				return nil, fmt.Errorf("duplicate location %s", strings.Join(loc.args(), " "))
+			}
+		}
+
+		if node == nil {
+			node = nginxconf.NewBlock("location", loc.args())
+			position := len(nodes)
+			if change.Position != nil && *change.Position >= 0 && *change.Position < len(nodes) {
+				position = *change.Position
+			}
+			switch {
+			case position < len(nodes):
+				server.InsertBefore(nodes[position], node)
+			case len(nodes) > 0:
+				server.InsertAfter(nodes[len(nodes)-1], node)
+			default:
+				server.Append(node)
+			}
+		} else {
+			node.SetArgs(loc.args()...)
+		}
+		syncDirectives(node, loc.Directives)
+		return node, nil
+	case LocationDelete:
+		node, err := at(change.Index)
+		if err != nil {
+			return nil, err
+		}
+		server.RemoveWithComments(node)
+		return nil, nil
+	case LocationReorder:
+		if len(change.Order) != len(nodes) {
+			return nil, fmt.Errorf("order must list all %d locations", len(nodes))
+		}
+		ordered := make([]*nginxconf.Directive, len(nodes))
+		for i, index := range change.Order {
+			node, err := at(index)
+			if err != nil {
+				return nil, err
+			}
+			ordered[i] = node
+		}
+		if !server.Reorder(ordered) {
+			return nil, fmt.Errorf("order must list each location once")
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown location action %q", change.Action)
+}
+
+// locationNodes server块中的location块，顺序与Site.Locations一致
+func locationNodes(server *nginxconf.Directive) []*nginxconf.Directive {
+	var nodes []*nginxconf.Directive
+	for _, child := range server.Children {
+		if child.Name == "location" && child.Block && len(child.Args) > 0 {
+			nodes = append(nodes, child)
+		}
+	}
+	return nodes
+}
+
+func (loc *Location) args() []string {
+	if loc.Modifier != "" {
+		return []string{loc.Modifier, loc.Path}
+	}
+	return []string{loc.Path}
+}
+
+func (loc *Location) validate() error {
+	if loc.Path == "" {
+		return fmt.Errorf("location path is required")
+	}
+	if !siteModifiers[loc.Modifier] {
+		return fmt.Errorf("invalid location modifier %q", loc.Modifier)
+	}
+	for _, d := range loc.Directives {
+		if !directiveName.MatchString(d.Name) {
+			return fmt.Errorf("invalid directive name %q in location %s", d.Name, loc.Path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package nginx
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const (
+	ExportText   = "text"
+	ExportGzip   = "gzip"
+	ExportCSV    = "csv"
+	ExportNDJSON = "ndjson"
+)
+
+// LogExporter 将日志条目写出为指定格式
+type LogExporter struct {
+	format string
+	w      io.Writer
+	gz     *gzip.Writer
+	csv    *csv.Writer
+	json   *json.Encoder
+	header bool
+}
+
+var csvHeader = []string{
+	"time", "level", "remote_addr", "remote_user", "method", "path", "protocol",
+	"status", "body_bytes", "referer", "user_agent", "request_time", "message",
+}
+
+func NewLogExporter(w io.Writer, format string) (*LogExporter, error) {
+	e := &LogExporter{format: format, w: w}
+	switch format {
+	case ExportText:
+	case ExportGzip:
+		e.gz = gzip.NewWriter(w)
+		e.w = e.gz
+	case ExportCSV:
+		e.csv = csv.NewWriter(w)
+	case ExportNDJSON:
+		e.json = json.NewEncoder(w)
+	default:
+		return nil, fmt.Errorf("unsupported export format: %s", format)
+	}
+	return e, nil
+}
+
+// ContentType 导出格式对应的MIME类型
+func (e *LogExporter) ContentType() string {
+	switch e.format {
+	case ExportGzip:
+		return "application/gzip"
+	case ExportCSV:
+		return "text/csv; charset=utf-8"
+	case ExportNDJSON:
+		return "application/x-ndjson"
+	default:
+		return "text/plain; charset=utf-8"
+	}
+}
+
+// FileExt 导出文件扩展名
+func (e *LogExporter) FileExt() string {
+	switch e.format {
+	case ExportGzip:
+		return ".log.gz"
+	case ExportCSV:
+		return ".csv"
+	case ExportNDJSON:
+		return ".ndjson"
+	default:
+		return ".log"
+	}
+}
+
+// Write 写出一条日志
+func (e *LogExporter) Write(entry *LogEntry) error {
+	switch e.format {
+	case ExportCSV:
+		if !e.header {
+			e.header = true
+			if err := e.csv.Write(csvHeader); err != nil {
+				return err
+			}
+		}
+		return e.csv.Write([]string{
+			entry.Time.Format(time.RFC3339),
+			entry.Level,
+			entry.RemoteAddr,
+			entry.RemoteUser,
+			entry.Method,
+			entry.Path,
+			entry.Protocol,
+			formatStatus(entry.Status),
+			strconv.FormatInt(entry.BodyBytes, 10),
+			entry.Referer,
+			entry.UserAgent,
+			formatRequestTime(entry.RequestTime),
+			entry.Message,
+		})
+	case ExportNDJSON:
+		return e.json.Encode(entry)
+	default:
+		_, err := io.WriteString(e.w, entry.Raw+"\n")
+		return err
+	}
+}
+
+// Flush 将缓冲内容写出，便于流式传输
+func (e *LogExporter) Flush() error {
+	switch {
+	case e.csv != nil:
+		e.csv.Flush()
+		return e.csv.Error()
+	case e.gz != nil:
+		return e.gz.Flush()
+	}
+	return nil
+}
+
+// Close 结束导出
+func (e *LogExporter) Close() error {
+	if e.csv != nil {
+		e.csv.Flush()
+		return e.csv.Error()
+	}
+	if e.gz != nil {
+		return e.gz.Close()
+	}
+	return nil
+}
+
+func formatStatus(status int) string {
+	if status == 0 {
+		return ""
+	}
+	return strconv.Itoa(status)
+}
+
+func formatRequestTime(seconds float64) string {
+	if seconds == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(seconds, 'f', 3, 64)
+}
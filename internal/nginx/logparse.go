@@ -0,0 +1,239 @@
+package nginx
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	LogTypeAccess = "access"
+	LogTypeError  = "error"
+)
+
+var (
+	// accessLogPattern 匹配nginx默认的combined/main日志格式
+	accessLogPattern = regexp.MustCompile(`^(\S+) \S+ (\S+) \[([^\]]+)\] "([^"]*)" (\d{3}) (\d+|-)(?: "([^"]*)" "([^"]*)")?`)
+	// errorLogPattern 匹配错误日志行：2024/12/25 14:38:02 [error] 1234#5678: message
+	errorLogPattern = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} \d{2}:\d{2}:\d{2}) \[(\w+)\] (\d+)#(\d+): (.*)$`)
+)
+
+// LogEntry 解析后的日志条目
+type LogEntry struct {
+	Time        time.Time `json:"time"`
+	Level       string    `json:"level,omitempty"`
+	RemoteAddr  string    `json:"remote_addr,omitempty"`
+	RemoteUser  string    `json:"remote_user,omitempty"`
+	Method      string    `json:"method,omitempty"`
+	Path        string    `json:"path,omitempty"`
+	Protocol    string    `json:"protocol,omitempty"`
+	Status      int       `json:"status,omitempty"`
+	BodyBytes   int64     `json:"body_bytes,omitempty"`
+	Referer     string    `json:"referer,omitempty"`
+	UserAgent   string    `json:"user_agent,omitempty"`
+	RequestTime float64   `json:"request_time,omitempty"`
+	Message     string    `json:"message,omitempty"`
+	Raw         string    `json:"raw"`
+}
+
+// LogQuery 日志过滤条件，零值字段表示不过滤
+type LogQuery struct {
+	From       time.Time
+	To         time.Time
+	Status     string // 精确状态码(404)或状态类(5xx)
+	Method     string
+	Level      string
+	RemoteAddr string
+	Contains   string
+}
+
+// ParseAccessLine 解析一行访问日志
+func ParseAccessLine(line string) (*LogEntry, error) {
+	m := accessLogPattern.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("unrecognized access log line")
+	}
+
+	t, err := time.Parse("02/Jan/2006:15:04:05 -0700", m[3])
+	if err != nil {
+		return nil, fmt.Errorf("invalid access log time: %w", err)
+	}
+
+	entry := &LogEntry{
+		Time:       t,
+		RemoteAddr: m[1],
+		RemoteUser: strings.Trim(m[2], "-"),
+		Referer:    strings.Trim(m[7], "-"),
+		UserAgent:  m[8],
+		Raw:        line,
+	}
+	entry.Status, _ = strconv.Atoi(m[5])
+	entry.BodyBytes, _ = strconv.ParseInt(m[6], 10, 64)
+
+	// 自定义格式常在末尾追加 $request_time，如 ... "curl/8.0" 0.012
+	if rest := strings.Fields(line[len(m[0]):]); len(rest) > 0 {
+		last := strings.Trim(rest[len(rest)-1], `"`)
+		if strings.Contains(last, ".") {
+			entry.RequestTime, _ = strconv.ParseFloat(last, 64)
+		}
+	}
+
+	// 请求行: GET /path HTTP/1.1
+	parts := strings.SplitN(m[4], " ", 3)
+	switch len(parts) {
+	case 3:
+		entry.Method, entry.Path, entry.Protocol = parts[0], parts[1], parts[2]
+	case 2:
+		entry.Method, entry.Path = parts[0], parts[1]
+	default:
+		entry.Path = m[4]
+	}
+
+	return entry, nil
+}
+
+// ParseErrorLine 解析一行错误日志
+func ParseErrorLine(line string) (*LogEntry, error) {
+	m := errorLogPattern.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("unrecognized error log line")
+	}
+
+	t, err := time.ParseInLocation("2006/01/02 15:04:05", m[1], time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("invalid error log time: %w", err)
+	}
+
+	return &LogEntry{
+		Time:    t,
+		Level:   m[2],
+		Message: m[5],
+		Raw:     line,
+	}, nil
+}
+
+// Match 判断日志条目是否满足过滤条件
+func (q *LogQuery) Match(e *LogEntry) bool {
+	if !q.From.IsZero() && e.Time.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && e.Time.After(q.To) {
+		return false
+	}
+	if q.Status != "" && !matchStatus(q.Status, e.Status) {
+		return false
+	}
+	if q.Method != "" && !strings.EqualFold(q.Method, e.Method) {
+		return false
+	}
+	if q.Level != "" && !strings.EqualFold(q.Level, e.Level) {
+		return false
+	}
+	if q.RemoteAddr != "" && q.RemoteAddr != e.RemoteAddr {
+		return false
+	}
+	if q.Contains != "" && !strings.Contains(e.Raw, q.Contains) {
+		return false
+	}
+	return true
+}
+
+// matchStatus 匹配状态码，支持 404 和 5xx 两种写法
+func matchStatus(pattern string, status int) bool {
+	pattern = strings.ToLower(pattern)
+	if len(pattern) == 3 && strings.HasSuffix(pattern, "xx") {
+		return strconv.Itoa(status/100) == pattern[:1]
+	}
+	return pattern == strconv.Itoa(status)
+}
+
+// DetectLogType 根据文件名推断日志类型
+func DetectLogType(name string) string {
+	if strings.Contains(strings.ToLower(name), "error") {
+		return LogTypeError
+	}
+	return LogTypeAccess
+}
+
+// ResolveLogFiles 解析日志名称对应的文件路径，按时间先后排列
+// name 可以是 access、access.log 或归档文件名；withArchives 为 true 时包含该日志的所有归档
+func (s *Service) ResolveLogFiles(name string, withArchives bool) ([]string, error) {
+	if name == "" || name != filepath.Base(name) || strings.Contains(name, "..") {
+		return nil, fmt.Errorf("invalid log name: %s", name)
+	}
+	if _, err := os.Stat(filepath.Join(s.LogPath, name)); os.IsNotExist(err) && filepath.Ext(name) != ".log" {
+		name += ".log"
+	}
+
+	var files []string
+	if withArchives {
+		// archivesOf按时间倒序，读取时从最早的归档开始
+		archives := archivesOf(s.LogPath, name)
+		for i := len(archives) - 1; i >= 0; i-- {
+			files = append(files, filepath.Join(s.LogPath, archives[i].Filename))
+		}
+	}
+
+	path := filepath.Join(s.LogPath, name)
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+
+	if len(files) == 0 {
+		return nil, fmt.Errorf("log file not found: %s", name)
+	}
+	return files, nil
+}
+
+// ScanLog 逐行解析日志文件，对满足条件的条目调用fn；gzip归档会被透明解压
+func ScanLog(files []string, logType string, query LogQuery, fn func(*LogEntry) error) error {
+	parse := ParseAccessLine
+	if logType == LogTypeError {
+		parse = ParseErrorLine
+	}
+
+	for _, path := range files {
+		if err := scanLogFile(path, parse, query, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanLogFile(path string, parse func(string) (*LogEntry, error), query LogQuery, fn func(*LogEntry) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer file.Close()
+
+	var reader io.Reader = file
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return fmt.Errorf("failed to open gzip log archive: %w", err)
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		entry, err := parse(scanner.Text())
+		if err != nil || !query.Match(entry) {
+			continue
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,389 @@
+package nginx
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// rotateTimeFormat 归档文件名中的时间戳格式，与备份文件保持一致
+const rotateTimeFormat = "20060102_150405"
+
+// RotatePolicy 日志轮转策略
+type RotatePolicy struct {
+	MaxSize       int64         // 单个日志文件达到该大小（字节）时轮转，0表示不限制
+	Interval      time.Duration // 距上次轮转超过该时长时轮转，0表示不按时间轮转
+	CheckInterval time.Duration // 后台检查周期
+	Compress      bool          // 是否gzip压缩归档文件
+	MaxFiles      int           // 每个日志保留的归档数量，0表示不限制
+	MaxAge        time.Duration // 归档最长保留时间，0表示不限制
+}
+
+// LogRotator 内置日志轮转器
+type LogRotator struct {
+	service *Service
+	policy  RotatePolicy
+	started time.Time
+	mu      sync.Mutex
+}
+
+// LogArchive 已轮转的日志归档
+type LogArchive struct {
+	Log       string    `json:"log"`
+	Filename  string    `json:"filename"`
+	Size      int64     `json:"size"`
+	RotatedAt time.Time `json:"rotated_at"`
+	Gzipped   bool      `json:"gzipped"`
+
+	seq int // 同一秒内轮转的序号
+}
+
+func NewLogRotator(service *Service, policy RotatePolicy) *LogRotator {
+	if policy.CheckInterval <= 0 {
+		policy.CheckInterval = time.Minute
+	}
+	return &LogRotator{
+		service: service,
+		policy:  policy,
+		started: time.Now(),
+	}
+}
+
+// Run 按检查周期循环执行轮转
+func (r *LogRotator) Run() {
+	ticker := time.NewTicker(r.policy.CheckInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := r.Check(); err != nil {
+			logrus.Warn("Log rotation check failed: ", err)
+		}
+	}
+}
+
+// Check 轮转达到大小或时间阈值的日志，并执行保留策略
+func (r *LogRotator) Check() ([]LogArchive, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	logs, err := r.listLogs()
+	if err != nil {
+		return nil, err
+	}
+
+	var due []string
+	for _, name := range logs {
+		if r.isDue(name) {
+			due = append(due, name)
+		}
+	}
+
+	archives := r.rotate(due)
+	r.enforceRetention()
+	return archives, nil
+}
+
+// RotateAll 立即轮转所有日志文件
+func (r *LogRotator) RotateAll() ([]LogArchive, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	logs, err := r.listLogs()
+	if err != nil {
+		return nil, err
+	}
+
+	archives := r.rotate(logs)
+	r.enforceRetention()
+	return archives, nil
+}
+
+// ListArchives 列出所有日志归档，按轮转时间倒序
+func (r *LogRotator) ListArchives() ([]LogArchive, error) {
+	if _, err := os.Stat(r.service.LogPath); err != nil {
+		return nil, fmt.Errorf("failed to read log directory: %w", err)
+	}
+
+	archives := []LogArchive{}
+	for _, name := range r.archivedLogs() {
+		archives = append(archives, archivesOf(r.service.LogPath, name)...)
+	}
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].RotatedAt.After(archives[j].RotatedAt)
+	})
+	return archives, nil
+}
+
+// listLogs 列出日志目录中正在写入的日志文件
+func (r *LogRotator) listLogs() ([]string, error) {
+	files, err := os.ReadDir(r.service.LogPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log directory: %w", err)
+	}
+
+	var logs []string
+	for _, file := range files {
+		if file.IsDir() || filepath.Ext(file.Name()) != ".log" {
+			continue
+		}
+		logs = append(logs, file.Name())
+	}
+	return logs, nil
+}
+
+// archivedLogs 列出存在归档的日志文件名（日志本身可能已不存在）
+func (r *LogRotator) archivedLogs() []string {
+	files, err := os.ReadDir(r.service.LogPath)
+	if err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var logs []string
+	for _, file := range files {
+		idx := strings.Index(file.Name(), ".log.")
+		if file.IsDir() || idx < 0 {
+			continue
+		}
+		name := file.Name()[:idx+len(".log")]
+		if !seen[name] {
+			seen[name] = true
+			logs = append(logs, name)
+		}
+	}
+	return logs
+}
+
+// isDue 判断日志是否需要轮转
+func (r *LogRotator) isDue(name string) bool {
+	info, err := os.Stat(filepath.Join(r.service.LogPath, name))
+	if err != nil || info.Size() == 0 {
+		return false
+	}
+
+	if r.policy.MaxSize > 0 && info.Size() >= r.policy.MaxSize {
+		return true
+	}
+
+	if r.policy.Interval > 0 {
+		last := r.started
+		if archives := archivesOf(r.service.LogPath, name); len(archives) > 0 {
+			last = archives[0].RotatedAt
+		}
+		return time.Since(last) >= r.policy.Interval
+	}
+
+	return false
+}
+
+// rotate 重命名日志文件，通知nginx重新打开日志，然后压缩归档
+func (r *LogRotator) rotate(names []string) []LogArchive {
+	if len(names) == 0 {
+		return nil
+	}
+
+	timestamp := time.Now().Format(rotateTimeFormat)
+	var rotated []string
+	filenames := make(map[string]string)
+	for _, name := range names {
+		src := filepath.Join(r.service.LogPath, name)
+		filename := archiveFilename(r.service.LogPath, name, timestamp)
+		if err := moveLog(src, filepath.Join(r.service.LogPath, filename)); err != nil {
+			logrus.Warnf("Failed to rotate log %s: %v", name, err)
+			continue
+		}
+		rotated = append(rotated, name)
+		filenames[name] = filename
+	}
+
+	if len(rotated) == 0 {
+		return nil
+	}
+
+	// nginx仍持有旧文件句柄，需要重新打开才会写入新文件
+	if r.service.IsRunning() {
+		if err := r.service.Reopen(); err != nil {
+			logrus.Warn("Failed to reopen nginx logs after rotation: ", err)
+		}
+	}
+
+	var archives []LogArchive
+	for _, name := range rotated {
+		filename := filenames[name]
+		if r.policy.Compress {
+			if err := gzipFile(filepath.Join(r.service.LogPath, filename)); err != nil {
+				logrus.Warnf("Failed to compress log archive %s: %v", filename, err)
+			} else {
+				filename += ".gz"
+			}
+		}
+
+		archive := LogArchive{
+			Log:      name,
+			Filename: filename,
+			Gzipped:  strings.HasSuffix(filename, ".gz"),
+		}
+		if info, err := os.Stat(filepath.Join(r.service.LogPath, filename)); err == nil {
+			archive.Size = info.Size()
+		}
+		archive.RotatedAt, _ = time.ParseInLocation(rotateTimeFormat, timestamp, time.Local)
+		archives = append(archives, archive)
+		logrus.Infof("Log rotated: %s -> %s", name, filename)
+	}
+
+	return archives
+}
+
+// enforceRetention 按数量和时间清理旧归档
+func (r *LogRotator) enforceRetention() {
+	for _, name := range r.archivedLogs() {
+		archives := archivesOf(r.service.LogPath, name)
+		for i, archive := range archives {
+			expired := r.policy.MaxAge > 0 && time.Since(archive.RotatedAt) > r.policy.MaxAge
+			overflow := r.policy.MaxFiles > 0 && i >= r.policy.MaxFiles
+			if !expired && !overflow {
+				continue
+			}
+			if err := os.Remove(filepath.Join(r.service.LogPath, archive.Filename)); err != nil {
+				logrus.Warn("Failed to delete old log archive: ", err)
+				continue
+			}
+			logrus.Infof("Log archive deleted: %s", archive.Filename)
+		}
+	}
+}
+
+// archiveFilename 归档文件名，同一秒内多次轮转时加上.1、.2等序号，避免覆盖之前的归档
+func archiveFilename(logPath, name, timestamp string) string {
+	filename := fmt.Sprintf("%s.%s", name, timestamp)
+	for seq := 1; ; seq++ {
+		if !fileExists(filepath.Join(logPath, filename)) && !fileExists(filepath.Join(logPath, filename+".gz")) {
+			return filename
+		}
+		filename = fmt.Sprintf("%s.%s.%d", name, timestamp, seq)
+	}
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+// archivesOf 列出日志目录中指定日志的归档，按轮转时间倒序（同一秒内的按序号倒序）
+func archivesOf(logPath, name string) []LogArchive {
+	files, err := os.ReadDir(logPath)
+	if err != nil {
+		return nil
+	}
+
+	var archives []LogArchive
+	for _, file := range files {
+		if file.IsDir() || !strings.HasPrefix(file.Name(), name+".") {
+			continue
+		}
+
+		stamp := strings.TrimSuffix(strings.TrimPrefix(file.Name(), name+"."), ".gz")
+		seq := 0
+		if i := strings.IndexByte(stamp, '.'); i >= 0 {
+			if seq, err = strconv.Atoi(stamp[i+1:]); err != nil || seq <= 0 {
+				continue
+			}
+			stamp = stamp[:i]
+		}
+		rotatedAt, err := time.ParseInLocation(rotateTimeFormat, stamp, time.Local)
+		if err != nil {
+			continue
+		}
+
+		info, err := file.Info()
+		if err != nil {
+			continue
+		}
+
+		archives = append(archives, LogArchive{
+			Log:       name,
+			Filename:  file.Name(),
+			Size:      info.Size(),
+			RotatedAt: rotatedAt,
+			Gzipped:   strings.HasSuffix(file.Name(), ".gz"),
+			seq:       seq,
+		})
+	}
+
+	sort.Slice(archives, func(i, j int) bool {
+		if !archives[i].RotatedAt.Equal(archives[j].RotatedAt) {
+			return archives[i].RotatedAt.After(archives[j].RotatedAt)
+		}
+		return archives[i].seq > archives[j].seq
+	})
+	return archives
+}
+
+// moveLog 重命名日志文件，失败时（如Windows上文件被占用）退化为复制后截断
+func moveLog(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	return os.Truncate(src, 0)
+}
+
+// gzipFile 将文件压缩为同名.gz文件并删除原文件
+func gzipFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(out)
+	if _, err := io.Copy(gz, in); err != nil {
+		gz.Close()
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	in.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,113 @@
+package nginx
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sync"
+)
+
+// LogTailer 增量读取日志文件的新内容，自动处理轮转和截断
+type LogTailer struct {
+	Path   string
+	mu     sync.Mutex
+	offset int64
+	inited bool
+}
+
+func NewLogTailer(path string) *LogTailer {
+	return &LogTailer{Path: path}
+}
+
+// ReadNew 读取自上次调用以来新增的完整行；首次调用只定位到文件末尾，不回放历史
+func (t *LogTailer) ReadNew(fn func(line string)) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	file, err := os.Open(t.Path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if !t.inited {
+		t.inited = true
+		t.offset = info.Size()
+		return nil
+	}
+
+	// 文件变小说明已被轮转或截断，从头读取
+	if info.Size() < t.offset {
+		t.offset = 0
+	}
+	if _, err := file.Seek(t.offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			// 不完整的行留到下次读取
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		t.offset += int64(len(line))
+		fn(trimNewline(line))
+	}
+}
+
+func trimNewline(line string) string {
+	for len(line) > 0 && (line[len(line)-1] == '\n' || line[len(line)-1] == '\r') {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// TailLines 读取文件末尾最多n行，用于在异常时附带最近的日志
+func TailLines(path string, n int) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// 只读取末尾64KB，足够容纳常见的错误日志行
+	const window = 64 * 1024
+	offset := info.Size() - window
+	if offset < 0 {
+		offset = 0
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), window)
+	lines := []string{}
+	first := offset > 0
+	for scanner.Scan() {
+		// 从中间开始读取时第一行可能不完整
+		if first {
+			first = false
+			continue
+		}
+		lines = append(lines, scanner.Text())
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	return lines, scanner.Err()
+}
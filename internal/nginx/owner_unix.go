@@ -0,0 +1,20 @@
+//go:build !windows
+
+package nginx
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownersSupported 当前平台是否可以按属主和权限位检查worker用户的访问权限
+const ownersSupported = true
+
+// fileOwner 文件的uid和gid
+func fileOwner(info os.FileInfo) (uint32, uint32, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, 0, false
+	}
+	return stat.Uid, stat.Gid, true
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package nginx
+
+import "os"
+
+// ownersSupported Windows没有POSIX属主和权限位，nginx也不支持user指令
+const ownersSupported = false
+
+// fileOwner Windows不支持
+func fileOwner(info os.FileInfo) (uint32, uint32, bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,147 @@
+package nginx
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+const (
+	ProcessMaster       = "master"
+	ProcessWorker       = "worker"
+	ProcessCacheManager = "cache_manager"
+	ProcessCacheLoader  = "cache_loader"
+)
+
+// ProcessInfo nginx进程资源占用
+type ProcessInfo struct {
+	PID         int32     `json:"pid"`
+	Type        string    `json:"type"`
+	CPUPercent  float64   `json:"cpu_percent"`
+	RSS         uint64    `json:"rss"`
+	OpenFDs     int32     `json:"open_fds"`
+	Threads     int32     `json:"threads"`
+	Connections int       `json:"connections"`
+	Listen      []string  `json:"listen,omitempty"`
+	CreateTime  time.Time `json:"create_time"`
+}
+
+// cpuSample 上一次采样的进程CPU时间，用于计算区间CPU占用率
+type cpuSample struct {
+	total float64
+	at    time.Time
+}
+
+var (
+	cpuSamplesMu sync.Mutex
+	cpuSamples   = make(map[string]cpuSample)
+)
+
+// Processes 列出master及其子进程（worker、cache manager等）的资源占用
+func (s *Service) Processes() ([]ProcessInfo, error) {
+	pid := s.getPIDFromFile()
+	if pid <= 0 || !s.isPIDRunning(pid) {
+		return nil, fmt.Errorf("nginx is not running")
+	}
+
+	master, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect nginx master: %w", err)
+	}
+
+	procs := []ProcessInfo{inspectProcess(master, ProcessMaster)}
+	children, _ := master.Children()
+	for _, child := range children {
+		procs = append(procs, inspectProcess(child, childProcessType(child)))
+	}
+
+	return procs, nil
+}
+
+// inspectProcess 采集单个进程的资源占用，单项采集失败时保留零值
+func inspectProcess(p *process.Process, procType string) ProcessInfo {
+	info := ProcessInfo{PID: p.Pid, Type: procType}
+	if created, err := p.CreateTime(); err == nil {
+		info.CreateTime = time.UnixMilli(created)
+	}
+	if mem, err := p.MemoryInfo(); err == nil {
+		info.RSS = mem.RSS
+	}
+	info.CPUPercent = cpuPercent(p, info.CreateTime)
+	if fds, err := p.NumFDs(); err == nil {
+		info.OpenFDs = fds
+	}
+	if threads, err := p.NumThreads(); err == nil {
+		info.Threads = threads
+	}
+
+	// 监听套接字由master创建并被worker继承，只在master上列出监听地址
+	if conns, err := p.Connections(); err == nil {
+		seen := make(map[string]bool)
+		for _, conn := range conns {
+			if conn.Status != "LISTEN" {
+				info.Connections++
+				continue
+			}
+			addr := net.JoinHostPort(conn.Laddr.IP, strconv.Itoa(int(conn.Laddr.Port)))
+			if procType == ProcessMaster && !seen[addr] {
+				seen[addr] = true
+				info.Listen = append(info.Listen, addr)
+			}
+		}
+	}
+	return info
+}
+
+// cpuPercent 计算距上次采样的CPU占用率，首次采样时退化为进程生命周期平均值
+func cpuPercent(p *process.Process, created time.Time) float64 {
+	times, err := p.Times()
+	if err != nil {
+		return 0
+	}
+
+	now := time.Now()
+	total := times.User + times.System
+	key := fmt.Sprintf("%d-%d", p.Pid, created.UnixMilli())
+
+	cpuSamplesMu.Lock()
+	prev, ok := cpuSamples[key]
+	cpuSamples[key] = cpuSample{total: total, at: now}
+	// reload后旧worker的采样不再需要
+	for k, sample := range cpuSamples {
+		if now.Sub(sample.at) > 10*time.Minute {
+			delete(cpuSamples, k)
+		}
+	}
+	cpuSamplesMu.Unlock()
+
+	if ok {
+		if elapsed := now.Sub(prev.at).Seconds(); elapsed > 0 {
+			return (total - prev.total) / elapsed * 100
+		}
+	}
+
+	percent, err := p.CPUPercent()
+	if err != nil {
+		return 0
+	}
+	return percent
+}
+
+// childProcessType 根据命令行识别子进程类型
+func childProcessType(p *process.Process) string {
+	cmdline, _ := p.Cmdline()
+	switch {
+	case strings.Contains(cmdline, "cache manager"):
+		return ProcessCacheManager
+	case strings.Contains(cmdline, "cache loader"):
+		return ProcessCacheLoader
+	default:
+		return ProcessWorker
+	}
+}
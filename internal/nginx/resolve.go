@@ -0,0 +1,527 @@
+package nginx
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"nginx_manager/internal/nginxconf"
+)
+
+// ErrNoServer 没有server监听请求的端口
+var ErrNoServer = errors.New("no server listens on the requested port")
+
+// 服务器名和location的匹配方式
+const (
+	MatchExact            = "exact"
+	MatchLeadingWildcard  = "leading_wildcard"  // *.example.com 或 .example.com
+	MatchTrailingWildcard = "trailing_wildcard" // www.example.*
+	MatchRegex            = "regex"
+	MatchDefaultServer    = "default_server"
+	MatchFirstServer      = "first_server" // 没有default_server时该地址上的第一个server
+	MatchPrefix           = "prefix"
+	MatchPrefixNoRegex    = "prefix_noregex" // ^~，匹配后不再检查正则
+)
+
+// notInherited 不会从外层块继承到location的指令
+var notInherited = map[string]bool{
+	"proxy_pass": true, "fastcgi_pass": true, "uwsgi_pass": true, "scgi_pass": true, "grpc_pass": true,
+	"memcached_pass": true, "alias": true, "stub_status": true, "internal": true, "try_files": true,
+	"return": true, "rewrite": true, "set": true, "break": true,
+}
+
+// ResolveRequest 要模拟的请求
+type ResolveRequest struct {
+	Host    string `json:"host"`              // Host请求头，可以带端口
+	Port    int    `json:"port,omitempty"`    // 为空时取Host中的端口，否则http为80、https为443
+	URI     string `json:"uri,omitempty"`     // 为空时为 /
+	Address string `json:"address,omitempty"` // 连接的本机地址，为空时匹配任意地址
+	Scheme  string `json:"scheme,omitempty"`  // http或https
+}
+
+// ResolvedServer 处理请求的server块
+type ResolvedServer struct {
+	ID         string   `json:"id"`
+	ServerName []string `json:"server_name"`
+	Listen     []string `json:"listen"`
+	File       string   `json:"file"`
+	Line       int      `json:"line"`
+	Match      string   `json:"match"`                // 匹配方式
+	MatchedBy  string   `json:"matched_by,omitempty"` // 匹配到的server_name
+}
+
+// ResolvedLocation 处理请求的location，嵌套location时Parents为外层location
+type ResolvedLocation struct {
+	Modifier string   `json:"modifier,omitempty"`
+	Path     string   `json:"path"`
+	File     string   `json:"file"`
+	Line     int      `json:"line"`
+	Match    string   `json:"match"`
+	Parents  []string `json:"parents,omitempty"`
+}
+
+// EffectiveDirective 继承后生效的指令及其来源
+type EffectiveDirective struct {
+	Name    string   `json:"name"`
+	Args    []string `json:"args"`
+	Context string   `json:"context"` // 设置该指令的块，如 http、server、location /api/
+	File    string   `json:"file"`
+	Line    int      `json:"line"`
+}
+
+// ResolveResult 请求的路由结果
+type ResolveResult struct {
+	Host           string               `json:"host"`
+	Port           int                  `json:"port"`
+	URI            string               `json:"uri"` // 规范化后用于匹配location的路径
+	Server         ResolvedServer       `json:"server"`
+	Location       *ResolvedLocation    `json:"location"`                  // 没有location匹配时为空
+	ServerRewrites []EffectiveDirective `json:"server_rewrites,omitempty"` // server中的rewrite模块指令，在选择location之前执行
+	Directives     []EffectiveDirective `json:"directives"`
+	Notes          []string             `json:"notes,omitempty"`
+}
+
+// Resolve 按nginx选择server和location的规则确定处理请求的配置，不需要实际发送请求
+func (cm *ConfigManager) Resolve(req ResolveRequest) (*ResolveResult, error) {
+	tree, err := nginxconf.Load(cm.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return ResolveTree(tree, req)
+}
+
+// ResolveTree 在配置树中解析请求
+func ResolveTree(tree *nginxconf.Tree, req ResolveRequest) (*ResolveResult, error) {
+	host, port, err := req.target()
+	if err != nil {
+		return nil, err
+	}
+	http := httpBlock(tree)
+	if http == nil {
+		return nil, fmt.Errorf("config has no http block")
+	}
+
+	r := &resolver{tree: tree}
+	result := &ResolveResult{Host: host, Port: port, URI: normalizeURI(req.URI), Directives: []EffectiveDirective{}}
+
+	server, match, name := r.findServer(http, host, strconv.Itoa(port), req.Address)
+	if server == nil {
+		if len(r.notes) > 0 {
+			return nil, fmt.Errorf("%w: %d; %s", ErrNoServer, port, strings.Join(r.notes, "; "))
+		}
+		return nil, fmt.Errorf("%w: %d", ErrNoServer, port)
+	}
+	result.Server = r.describeServer(server, match, name)
+
+	chain := []*nginxconf.Directive{http, server}
+	for _, node := range expandChildren(tree, server) {
+		switch node.Name {
+		case "return", "rewrite", "set", "break", "if":
+			result.ServerRewrites = append(result.ServerRewrites, r.effectiveDirective(node, chain[:2]))
+			if node.Name == "return" {
+				result.Notes = append(result.Notes, fmt.Sprintf("return at %s:%d answers the request before a location is selected", r.relative(node.File), node.Line))
+			}
+		}
+	}
+
+	locations, match := r.findLocation(server, result.URI)
+	if len(locations) > 0 {
+		location := locations[len(locations)-1]
+		modifier, path := locationArgs(location)
+		result.Location = &ResolvedLocation{
+			Modifier: modifier,
+			Path:     path,
+			File:     r.relative(location.File),
+			Line:     location.Line,
+			Match:    match,
+		}
+		for _, parent := range locations[:len(locations)-1] {
+			result.Location.Parents = append(result.Location.Parents, strings.Join(parent.Args, " "))
+		}
+		chain = append(chain, locations...)
+	} else {
+		result.Notes = append(result.Notes, "no location matches; the request is handled with the server configuration")
+	}
+	result.Notes = append(result.Notes, r.notes...)
+
+	result.Directives = r.effective(chain)
+	return result, nil
+}
+
+// target 请求的主机名（小写，不含端口）和端口
+func (req *ResolveRequest) target() (string, int, error) {
+	host := strings.ToLower(strings.TrimSpace(req.Host))
+	port := req.Port
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		host = h
+		if port == 0 {
+			port, _ = strconv.Atoi(p)
+		}
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+
+	if port == 0 {
+		port = 80
+		if req.Scheme == "https" {
+			port = 443
+		}
+	}
+	if port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port %d", port)
+	}
+	return host, port, nil
+}
+
+// normalizeURI 去掉查询参数，解码%XX，合并多余的斜杠并处理 . 和 ..，与nginx匹配location前的处理一致
+func normalizeURI(uri string) string {
+	if i := strings.IndexAny(uri, "?#"); i >= 0 {
+		uri = uri[:i]
+	}
+	if decoded, err := url.PathUnescape(uri); err == nil {
+		uri = decoded
+	}
+	if !strings.HasPrefix(uri, "/") {
+		uri = "/" + uri
+	}
+	cleaned := path.Clean(uri)
+	if strings.HasSuffix(uri, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+type resolver struct {
+	tree  *nginxconf.Tree
+	notes []string
+}
+
+// listener server在某个端口上的一条listen
+type listener struct {
+	server        *nginxconf.Directive
+	addr          string // 通配地址为空
+	defaultServer bool
+}
+
+// findServer 先按地址和端口选出候选server，再按server_name选择：
+// 精确名称、最长的前缀通配、最长的后缀通配、第一个匹配的正则，最后是default_server或第一个server
+func (r *resolver) findServer(http *nginxconf.Directive, host, port, address string) (*nginxconf.Directive, string, string) {
+	var specific, wildcard []listener
+	for _, server := range expandChildren(r.tree, http) {
+		if server.Name != "server" || !server.Block {
+			continue
+		}
+		listens := 0
+		for _, node := range expandChildren(r.tree, server) {
+			if node.Name != "listen" || len(node.Args) == 0 {
+				continue
+			}
+			listens++
+			addr, p, ok := splitListen(node.Args[0])
+			if !ok || p != port {
+				continue
+			}
+			l := listener{server: server, addr: addr}
+			for _, arg := range node.Args[1:] {
+				if arg == "default_server" || arg == "default" {
+					l.defaultServer = true
+				}
+			}
+			switch {
+			case addr == "":
+				wildcard = append(wildcard, l)
+			case address == "" || addr == address:
+				specific = append(specific, l)
+			}
+		}
+		// 没有listen的server监听 *:80
+		if listens == 0 && port == "80" {
+			wildcard = append(wildcard, listener{server: server})
+		}
+	}
+
+	// 连接到具体地址时只使用监听该地址的server；没有指定地址时只使用通配地址的server，
+	// 监听具体地址的server只处理连接到该地址的请求，不能与通配地址的server混在一起选择
+	candidates := wildcard
+	if address != "" && len(specific) > 0 {
+		candidates = specific
+	} else if address == "" && len(specific) > 0 {
+		var addrs []string
+		seen := make(map[string]bool)
+		for _, l := range specific {
+			if !seen[l.addr] {
+				seen[l.addr] = true
+				addrs = append(addrs, l.addr)
+			}
+		}
+		if len(wildcard) == 0 {
+			r.notes = append(r.notes, fmt.Sprintf("port %s only has servers listening on specific addresses (%s); set address to choose one", port, strings.Join(addrs, ", ")))
+		} else {
+			r.notes = append(r.notes, fmt.Sprintf("servers listening on %s at port %s were skipped; set address to resolve a connection to those addresses", strings.Join(addrs, ", "), port))
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, "", ""
+	}
+
+	var leading, trailing *nginxconf.Directive
+	var leadingName, trailingName string
+	for _, l := range candidates {
+		for _, name := range r.serverNames(l.server) {
+			name = strings.ToLower(name)
+			switch {
+			case strings.HasPrefix(name, "~"):
+			case name == host:
+				return l.server, MatchExact, name
+			case strings.HasPrefix(name, "*.") || strings.HasPrefix(name, "."):
+				suffix := strings.TrimPrefix(name, "*")
+				if (strings.HasSuffix(host, suffix) || (name[0] == '.' && host == name[1:])) && len(name) > len(leadingName) {
+					leading, leadingName = l.server, name
+				}
+			case strings.HasSuffix(name, ".*"):
+				if strings.HasPrefix(host, strings.TrimSuffix(name, "*")) && len(name) > len(trailingName) {
+					trailing, trailingName = l.server, name
+				}
+			}
+		}
+	}
+	if leading != nil {
+		return leading, MatchLeadingWildcard, leadingName
+	}
+	if trailing != nil {
+		return trailing, MatchTrailingWildcard, trailingName
+	}
+
+	for _, l := range candidates {
+		for _, name := range r.serverNames(l.server) {
+			if !strings.HasPrefix(name, "~") {
+				continue
+			}
+			re, err := regexp.Compile(name[1:])
+			if err != nil {
+				r.notes = append(r.notes, fmt.Sprintf("server_name %s was not evaluated: %v", name, err))
+				continue
+			}
+			if re.MatchString(host) {
+				return l.server, MatchRegex, name
+			}
+		}
+	}
+
+	for _, l := range candidates {
+		if l.defaultServer {
+			return l.server, MatchDefaultServer, ""
+		}
+	}
+	return candidates[0].server, MatchFirstServer, ""
+}
+
+func (r *resolver) serverNames(server *nginxconf.Directive) []string {
+	var names []string
+	for _, node := range expandChildren(r.tree, server) {
+		if node.Name == "server_name" {
+			names = append(names, node.Args...)
+		}
+	}
+	return names
+}
+
+// findLocation 与ngx_http_core_find_location一致：精确匹配直接使用；否则取最长前缀，
+// 先在其嵌套location中查找，前缀为^~时不再检查正则，否则按顺序检查本层的正则location，
+// 第一个匹配的正则优先于前缀。返回从外到内的location链和匹配方式
+func (r *resolver) findLocation(block *nginxconf.Directive, uri string) ([]*nginxconf.Directive, string) {
+	var locations []*nginxconf.Directive
+	for _, node := range expandChildren(r.tree, block) {
+		if node.Name == "location" && node.Block && len(node.Args) > 0 {
+			locations = append(locations, node)
+		}
+	}
+
+	var best *nginxconf.Directive
+	bestLen := -1
+	for _, location := range locations {
+		modifier, path := locationArgs(location)
+		switch modifier {
+		case "=":
+			if uri == path {
+				return []*nginxconf.Directive{location}, MatchExact
+			}
+		case "", "^~":
+			if strings.HasPrefix(uri, path) && len(path) > bestLen {
+				best, bestLen = location, len(path)
+			}
+		}
+	}
+
+	var matched []*nginxconf.Directive
+	match := ""
+	if best != nil {
+		modifier, _ := locationArgs(best)
+		matched, match = []*nginxconf.Directive{best}, MatchPrefix
+		if modifier == "^~" {
+			match = MatchPrefixNoRegex
+		}
+		if nested, nestedMatch := r.findLocation(best, uri); len(nested) > 0 {
+			matched, match = append(matched, nested...), nestedMatch
+			// 嵌套的^~只阻止其所在层的正则，外层的正则仍然检查
+			if nestedMatch == MatchExact || nestedMatch == MatchRegex {
+				return matched, match
+			}
+		}
+		if modifier == "^~" {
+			return matched, match
+		}
+	}
+
+	for _, location := range locations {
+		modifier, path := locationArgs(location)
+		if modifier != "~" && modifier != "~*" {
+			continue
+		}
+		pattern := path
+		if modifier == "~*" {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			r.notes = append(r.notes, fmt.Sprintf("location %s %s was not evaluated: %v", modifier, path, err))
+			continue
+		}
+		if re.MatchString(uri) {
+			chain := []*nginxconf.Directive{location}
+			nested, _ := r.findLocation(location, uri)
+			return append(chain, nested...), MatchRegex
+		}
+	}
+	return matched, match
+}
+
+// effective 块链中继承后生效的简单指令：某个块设置了一条指令时，外层块的同名指令全部不再生效；
+// proxy_pass、return等不继承的指令只取自最内层的location
+func (r *resolver) effective(chain []*nginxconf.Directive) []EffectiveDirective {
+	last := len(chain) - 1
+	applies := func(node *nginxconf.Directive, i int) bool {
+		if node.Block || node.Name == "listen" || node.Name == "server_name" {
+			return false
+		}
+		return !notInherited[node.Name] || (i == last && chain[i].Name == "location")
+	}
+
+	source := make(map[string]int)
+	for i, block := range chain {
+		for _, node := range expandChildren(r.tree, block) {
+			if applies(node, i) {
+				source[node.Name] = i
+			}
+		}
+	}
+
+	directives := []EffectiveDirective{}
+	for i, block := range chain {
+		for _, node := range expandChildren(r.tree, block) {
+			if applies(node, i) && source[node.Name] == i {
+				directives = append(directives, r.effectiveDirective(node, chain[:i+1]))
+			}
+		}
+	}
+	return directives
+}
+
+func (r *resolver) effectiveDirective(node *nginxconf.Directive, chain []*nginxconf.Directive) EffectiveDirective {
+	block := chain[len(chain)-1]
+	context := block.Name
+	if block.Name == "location" {
+		context += " " + strings.Join(block.Args, " ")
+	}
+	return EffectiveDirective{
+		Name:    node.Name,
+		Args:    node.Args,
+		Context: context,
+		File:    r.relative(node.File),
+		Line:    node.Line,
+	}
+}
+
+func (r *resolver) describeServer(server *nginxconf.Directive, match, name string) ResolvedServer {
+	result := ResolvedServer{
+		ID:         siteID(server),
+		ServerName: []string{},
+		Listen:     []string{},
+		File:       r.relative(server.File),
+		Line:       server.Line,
+		Match:      match,
+		MatchedBy:  name,
+	}
+	for _, node := range expandChildren(r.tree, server) {
+		switch node.Name {
+		case "server_name":
+			result.ServerName = append(result.ServerName, node.Args...)
+		case "listen":
+			result.Listen = append(result.Listen, strings.Join(node.Args, " "))
+		}
+	}
+	return result
+}
+
+func (r *resolver) relative(file string) string {
+	if rel, err := filepath.Rel(r.tree.Prefix, file); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return file
+}
+
+// locationArgs location的修饰符和路径，修饰符可以与路径连写
+func locationArgs(location *nginxconf.Directive) (string, string) {
+	if len(location.Args) > 1 {
+		return location.Args[0], location.Args[1]
+	}
+	arg := location.Args[0]
+	for _, modifier := range []string{"^~", "~*", "=", "~"} {
+		if strings.HasPrefix(arg, modifier) && len(arg) > len(modifier) {
+			return modifier, arg[len(modifier):]
+		}
+	}
+	if strings.HasPrefix(arg, "@") {
+		return "@", arg[1:]
+	}
+	return "", arg
+}
+
+// splitListen 拆分listen的地址和端口，通配地址返回空地址；unix socket返回false
+func splitListen(listen string) (string, string, bool) {
+	if strings.HasPrefix(listen, "unix:") || strings.Contains(listen, "$") {
+		return "", "", false
+	}
+	host, port := "", listen
+	switch {
+	case strings.HasPrefix(listen, "["):
+		end := strings.Index(listen, "]")
+		if end < 0 {
+			return "", "", false
+		}
+		host, port = listen[1:end], strings.TrimPrefix(listen[end+1:], ":")
+		if port == "" {
+			port = "80"
+		}
+	case strings.Contains(listen, ":"):
+		i := strings.LastIndex(listen, ":")
+		host, port = listen[:i], listen[i+1:]
+	default:
+		if _, err := strconv.Atoi(listen); err != nil {
+			host, port = listen, "80"
+		}
+	}
+	if _, err := strconv.Atoi(port); err != nil {
+		return "", "", false
+	}
+	switch host {
+	case "*", "0.0.0.0", "::":
+		host = ""
+	}
+	return host, port, true
+}
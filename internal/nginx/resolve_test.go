@@ -0,0 +1,174 @@
+package nginx
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"nginx_manager/internal/nginxconf"
+)
+
+func loadTestTree(t *testing.T, content string) *nginxconf.Tree {
+	t.Helper()
+	tree, err := nginxconf.LoadContent(filepath.Join(t.TempDir(), "nginx.conf"), content)
+	if err != nil {
+		t.Fatalf("LoadContent: %v", err)
+	}
+	return tree
+}
+
+func TestResolveServerPrecedence(t *testing.T) {
+	tree := loadTestTree(t, `http {
+    server { listen 80; server_name first.test; }
+    server { listen 80; server_name www.example.com; }
+    server { listen 80; server_name *.example.com; }
+    server { listen 80; server_name *.shop.example.com; }
+    server { listen 80; server_name .example.org; }
+    server { listen 80; server_name www.example.*; }
+    server { listen 80; server_name ~^api\d+\.example\.net$; }
+    server { listen 80 default_server; server_name fallback.test; }
+    server { listen 8080; server_name eight.test; }
+    server { listen 8080; server_name other.test; }
+    server { listen 127.0.0.1:80; server_name www.example.com local.test; }
+    server { listen 10.0.0.1:81; server_name only.test; }
+}
+`)
+
+	tests := []struct {
+		name      string
+		req       ResolveRequest
+		wantName  string
+		wantMatch string
+		wantNote  string
+	}{
+		{"exact beats wildcards", ResolveRequest{Host: "www.example.com"}, "www.example.com", MatchExact, "127.0.0.1"},
+		{"longest leading wildcard", ResolveRequest{Host: "a.shop.example.com"}, "*.shop.example.com", MatchLeadingWildcard, ""},
+		{"leading wildcard", ResolveRequest{Host: "blog.example.com"}, "*.example.com", MatchLeadingWildcard, ""},
+		{"dot wildcard matches the bare domain", ResolveRequest{Host: "example.org"}, ".example.org", MatchLeadingWildcard, ""},
+		{"trailing wildcard", ResolveRequest{Host: "www.example.net"}, "www.example.*", MatchTrailingWildcard, ""},
+		{"regex", ResolveRequest{Host: "api12.example.net"}, "~^api\\d+\\.example\\.net$", MatchRegex, ""},
+		{"host is case-insensitive and may carry a port", ResolveRequest{Host: "WWW.Example.COM:80"}, "www.example.com", MatchExact, ""},
+		{"default_server", ResolveRequest{Host: "unknown.test"}, "fallback.test", MatchDefaultServer, ""},
+		{"first server on the port", ResolveRequest{Host: "unknown.test", Port: 8080}, "eight.test", MatchFirstServer, ""},
+		{"specific address", ResolveRequest{Host: "local.test", Address: "127.0.0.1"}, "www.example.com", MatchExact, ""},
+		{"no address ignores specific listeners", ResolveRequest{Host: "local.test"}, "fallback.test", MatchDefaultServer, "127.0.0.1"},
+		{"address without specific listeners", ResolveRequest{Host: "blog.example.com", Address: "192.0.2.1"}, "*.example.com", MatchLeadingWildcard, ""},
+		{"address on a port with only specific listeners", ResolveRequest{Host: "x.test", Port: 81, Address: "10.0.0.1"}, "only.test", MatchFirstServer, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ResolveTree(tree, tt.req)
+			if err != nil {
+				t.Fatalf("ResolveTree: %v", err)
+			}
+			if got := result.Server.ServerName[0]; got != tt.wantName {
+				t.Errorf("server = %s, want %s", got, tt.wantName)
+			}
+			if result.Server.Match != tt.wantMatch {
+				t.Errorf("match = %s, want %s", result.Server.Match, tt.wantMatch)
+			}
+			if tt.wantNote != "" && !strings.Contains(strings.Join(result.Notes, "\n"), tt.wantNote) {
+				t.Errorf("notes %q do not mention %s", result.Notes, tt.wantNote)
+			}
+		})
+	}
+}
+
+func TestResolveServerErrors(t *testing.T) {
+	tree := loadTestTree(t, `http {
+    server { listen 80; }
+    server { listen 10.0.0.1:81; }
+}
+`)
+
+	tests := []struct {
+		name string
+		req  ResolveRequest
+		want string
+	}{
+		{"no listener on the port", ResolveRequest{Host: "a.test", Port: 82}, ""},
+		{"only specific listeners without address", ResolveRequest{Host: "a.test", Port: 81}, "set address"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ResolveTree(tree, tt.req)
+			if !errors.Is(err, ErrNoServer) {
+				t.Fatalf("err = %v, want ErrNoServer", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveLocationPrecedence(t *testing.T) {
+	tree := loadTestTree(t, `http {
+    server {
+        listen 80;
+        location / { }
+        location = /exact { }
+        location /static/ { }
+        location ^~ /static/img/ { }
+        location ~* \.(png|jpg)$ { }
+        location ~ ^/api/v[0-9]+/ { }
+        location /api/ {
+            location ~ \.json$ { }
+        }
+        location /docs/ {
+            location /docs/internal/ { }
+        }
+        location ^~ /assets/ {
+            location ~ \.css$ { }
+        }
+    }
+}
+`)
+
+	tests := []struct {
+		name         string
+		uri          string
+		wantModifier string
+		wantPath     string
+		wantMatch    string
+		wantParents  []string
+	}{
+		{"exact", "/exact", "=", "/exact", MatchExact, nil},
+		{"exact does not match a longer path", "/exact/more", "", "/", MatchPrefix, nil},
+		{"longest prefix", "/static/site.css", "", "/static/", MatchPrefix, nil},
+		{"regex beats a plain prefix", "/static/logo.png", "~*", `\.(png|jpg)$`, MatchRegex, nil},
+		{"^~ stops the regex search", "/static/img/logo.png", "^~", "/static/img/", MatchPrefixNoRegex, nil},
+		{"first matching regex in config order", "/api/v2/x.png", "~*", `\.(png|jpg)$`, MatchRegex, nil},
+		{"regex over the prefix", "/api/v1/users", "~", "^/api/v[0-9]+/", MatchRegex, nil},
+		{"nested regex", "/api/users.json", "~", `\.json$`, MatchRegex, []string{"/api/"}},
+		{"nested prefix", "/docs/internal/a", "", "/docs/internal/", MatchPrefix, []string{"/docs/"}},
+		{"nested regex under ^~", "/assets/site.css", "~", `\.css$`, MatchRegex, []string{"^~ /assets/"}},
+		{"uri is normalized", "/static/../exact", "=", "/exact", MatchExact, nil},
+		{"root fallback", "/other", "", "/", MatchPrefix, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := ResolveTree(tree, ResolveRequest{Host: "a.test", URI: tt.uri})
+			if err != nil {
+				t.Fatalf("ResolveTree: %v", err)
+			}
+			loc := result.Location
+			if loc == nil {
+				t.Fatal("no location selected")
+			}
+			if loc.Modifier != tt.wantModifier || loc.Path != tt.wantPath {
+				t.Errorf("location = %s %s, want %s %s", loc.Modifier, loc.Path, tt.wantModifier, tt.wantPath)
+			}
+			if loc.Match != tt.wantMatch {
+				t.Errorf("match = %s, want %s", loc.Match, tt.wantMatch)
+			}
+			if strings.Join(loc.Parents, ",") != strings.Join(tt.wantParents, ",") {
+				t.Errorf("parents = %q, want %q", loc.Parents, tt.wantParents)
+			}
+		})
+	}
+}
@@ -0,0 +1,660 @@
+package nginx
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"nginx_manager/internal/nginxconf"
+)
+
+// 安全检查项
+const (
+	CheckHTTPS            = "https"
+	CheckTLSProtocols     = "tls-protocols"
+	CheckTLSCiphers       = "tls-ciphers"
+	CheckHSTS             = "hsts"
+	CheckCSP              = "csp"
+	CheckFrameOptions     = "x-frame-options"
+	CheckExposedEndpoints = "exposed-endpoints"
+	CheckBodyLimit        = "client-body-limit"
+	CheckRateLimit        = "rate-limit"
+	CheckListenAddress    = "listen-address"
+	CheckServerTokens     = "server-tokens"
+)
+
+const (
+	hstsMinAge     = 15552000          // HSTS的max-age至少180天
+	maxBodyLimit   = 100 * 1024 * 1024 // client_max_body_size超过100m视为没有限制
+	securityFormat = "2006-01-02 15:04:05"
+)
+
+// securityWeights 各检查项在得分中的权重
+var securityWeights = map[string]int{
+	CheckHTTPS:            15,
+	CheckTLSProtocols:     10,
+	CheckTLSCiphers:       10,
+	CheckHSTS:             10,
+	CheckCSP:              10,
+	CheckFrameOptions:     5,
+	CheckExposedEndpoints: 15,
+	CheckBodyLimit:        10,
+	CheckRateLimit:        10,
+	CheckListenAddress:    5,
+	CheckServerTokens:     5,
+}
+
+// SecurityCheck 一个server块的一项检查结果
+type SecurityCheck struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Passed      bool   `json:"passed"`
+	Weight      int    `json:"weight"`
+	Detail      string `json:"detail"`
+	Remediation string `json:"remediation,omitempty"` // 未通过时的修改建议
+}
+
+// ServerSecurity 一个server块的检查结果，得分为通过项权重占适用项权重的百分比
+type ServerSecurity struct {
+	ID         string          `json:"id"` // 与站点ID一致
+	ServerName []string        `json:"server_name"`
+	Listen     []string        `json:"listen"`
+	File       string          `json:"file"`
+	Line       int             `json:"line"`
+	TLS        bool            `json:"tls"`
+	Score      int             `json:"score"`
+	Grade      string          `json:"grade"`
+	Checks     []SecurityCheck `json:"checks"`
+}
+
+// SecurityReport 整个配置的安全检查报告，总分为各server得分的平均值
+type SecurityReport struct {
+	Instance    string           `json:"instance,omitempty"`
+	ConfigPath  string           `json:"config_path"`
+	GeneratedAt time.Time        `json:"generated_at"`
+	Score       int              `json:"score"`
+	Grade       string           `json:"grade"`
+	Servers     []ServerSecurity `json:"servers"`
+}
+
+// SecurityAudit 按继承后的生效配置检查每个server块的安全设置；
+// version为nginx -v报告的版本（如nginx/1.25.0），用于判断未设置的指令的默认值
+func (cm *ConfigManager) SecurityAudit(version string) (*SecurityReport, error) {
+	tree, err := nginxconf.Load(cm.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	return AuditTree(tree, version), nil
+}
+
+// AuditTree 检查配置树中http块下的所有server
+func AuditTree(tree *nginxconf.Tree, version string) *SecurityReport {
+	report := &SecurityReport{
+		ConfigPath:  tree.Main,
+		GeneratedAt: time.Now(),
+		Servers:     []ServerSecurity{},
+	}
+	http := httpBlock(tree)
+	if http == nil {
+		report.Grade = grade(0)
+		return report
+	}
+
+	a := &auditor{tree: tree, version: version}
+	seen := make(map[string]int)
+	total := 0
+	for _, server := range expandChildren(tree, http) {
+		if server.Name != "server" || !server.Block {
+			continue
+		}
+		result := a.audit([]*nginxconf.Directive{http, server})
+		seen[result.ID]++
+		if seen[result.ID] > 1 {
+			result.ID = fmt.Sprintf("%s-%d", result.ID, seen[result.ID])
+		}
+		report.Servers = append(report.Servers, result)
+		total += result.Score
+	}
+
+	if len(report.Servers) > 0 {
+		report.Score = total / len(report.Servers)
+	}
+	report.Grade = grade(report.Score)
+	return report
+}
+
+type auditor struct {
+	tree    *nginxconf.Tree
+	version string
+}
+
+// audit 检查chain最后的server块，chain为http和server
+func (a *auditor) audit(chain []*nginxconf.Directive) ServerSecurity {
+	server := chain[len(chain)-1]
+	result := ServerSecurity{
+		ID:         siteID(server),
+		ServerName: []string{},
+		Listen:     []string{},
+		File:       server.File,
+		Line:       server.Line,
+	}
+	if rel, err := filepath.Rel(a.tree.Prefix, server.File); err == nil && !strings.HasPrefix(rel, "..") {
+		result.File = rel
+	}
+
+	children := expandChildren(a.tree, server)
+	for _, child := range children {
+		switch child.Name {
+		case "server_name":
+			result.ServerName = append(result.ServerName, child.Args...)
+		case "listen":
+			result.Listen = append(result.Listen, strings.Join(child.Args, " "))
+			for i, arg := range child.Args {
+				if i > 0 && (arg == "ssl" || arg == "quic") {
+					result.TLS = true
+				}
+			}
+		case "ssl":
+			// 旧版本的 ssl on;
+			if len(child.Args) > 0 && child.Args[0] == "on" {
+				result.TLS = true
+			}
+		}
+	}
+	redirect := a.redirectsToHTTPS(server)
+	// 只做HTTPS跳转的server不返回内容，响应头等检查不适用
+	redirectOnly := !result.TLS && redirect
+
+	add := func(id, title string, passed bool, detail, remediation string) {
+		check := SecurityCheck{ID: id, Title: title, Passed: passed, Weight: securityWeights[id], Detail: detail}
+		if !passed {
+			check.Remediation = remediation
+		}
+		result.Checks = append(result.Checks, check)
+	}
+
+	switch {
+	case result.TLS:
+		add(CheckHTTPS, "HTTPS", true, "served over TLS", "")
+	case redirect:
+		add(CheckHTTPS, "HTTPS", true, "redirects to HTTPS", "")
+	default:
+		add(CheckHTTPS, "HTTPS", false, "served over plain HTTP without a redirect to HTTPS",
+			"add listen 443 ssl with ssl_certificate and ssl_certificate_key, or return 301 https://$host$request_uri;")
+	}
+
+	if result.TLS {
+		a.checkTLS(chain, add)
+	}
+
+	if !redirectOnly {
+		headers := a.headers(chain)
+		hsts, csp, xfo := headers["strict-transport-security"], headers["content-security-policy"], headers["x-frame-options"]
+
+		if result.TLS {
+			age := hstsMaxAge(hsts)
+			switch {
+			case hsts == "":
+				add(CheckHSTS, "HSTS", false, "Strict-Transport-Security is not set",
+					`add_header Strict-Transport-Security "max-age=31536000; includeSubDomains" always;`)
+			case age < hstsMinAge:
+				add(CheckHSTS, "HSTS", false, fmt.Sprintf("max-age %d is shorter than 180 days", age),
+					`add_header Strict-Transport-Security "max-age=31536000; includeSubDomains" always;`)
+			default:
+				add(CheckHSTS, "HSTS", true, hsts, "")
+			}
+		}
+
+		if csp != "" {
+			add(CheckCSP, "Content-Security-Policy", true, csp, "")
+		} else {
+			add(CheckCSP, "Content-Security-Policy", false, "Content-Security-Policy is not set",
+				`add_header Content-Security-Policy "default-src 'self'" always; and extend it for the sources the site needs`)
+		}
+
+		switch {
+		case xfo != "":
+			add(CheckFrameOptions, "X-Frame-Options", true, xfo, "")
+		case strings.Contains(csp, "frame-ancestors"):
+			add(CheckFrameOptions, "X-Frame-Options", true, "covered by the CSP frame-ancestors directive", "")
+		default:
+			add(CheckFrameOptions, "X-Frame-Options", false, "neither X-Frame-Options nor CSP frame-ancestors is set",
+				"add_header X-Frame-Options SAMEORIGIN always;")
+		}
+
+		a.checkEndpoints(chain, add)
+		a.checkBodyLimit(chain, add)
+		a.checkRateLimit(chain, add)
+	}
+
+	var open []string
+	for _, child := range children {
+		if child.Name == "listen" && len(child.Args) > 0 && listensOnAll(child.Args[0]) {
+			open = append(open, child.Args[0])
+		}
+	}
+	if len(result.Listen) == 0 {
+		open = append(open, "80")
+	}
+	if len(open) > 0 {
+		add(CheckListenAddress, "Listen address", false, fmt.Sprintf("listens on all interfaces: %s", strings.Join(open, ", ")),
+			"bind to a specific address (listen 10.0.0.1:443) unless the server is meant to be reachable on every interface")
+	} else {
+		add(CheckListenAddress, "Listen address", true, "bound to specific addresses", "")
+	}
+
+	if tokens := a.effective(chain, "server_tokens"); tokens != nil && len(tokens.Args) > 0 && tokens.Args[0] == "off" {
+		add(CheckServerTokens, "Server tokens", true, "server_tokens off", "")
+	} else {
+		add(CheckServerTokens, "Server tokens", false, "the nginx version is disclosed in the Server header and error pages",
+			"add server_tokens off; to the http block")
+	}
+
+	weight, passed := 0, 0
+	for _, check := range result.Checks {
+		weight += check.Weight
+		if check.Passed {
+			passed += check.Weight
+		}
+	}
+	if weight > 0 {
+		result.Score = passed * 100 / weight
+	}
+	result.Grade = grade(result.Score)
+	return result
+}
+
+func (a *auditor) checkTLS(chain []*nginxconf.Directive, add func(id, title string, passed bool, detail, remediation string)) {
+	protocols := a.effective(chain, "ssl_protocols")
+	switch {
+	case protocols == nil:
+		// nginx 1.23.4起默认只启用TLSv1.2 TLSv1.3，更早的版本默认还启用TLSv1 TLSv1.1
+		switch version, ok := parseNginxVersion(a.version); {
+		case !ok:
+			add(CheckTLSProtocols, "TLS protocols", false, "ssl_protocols not set and the nginx version is unknown; versions before 1.23.4 enable TLSv1 and TLSv1.1 by default",
+				"ssl_protocols TLSv1.2 TLSv1.3;")
+		case !versionAtLeast(version, 1, 23, 4):
+			add(CheckTLSProtocols, "TLS protocols", false, fmt.Sprintf("nginx default for %s: TLSv1 TLSv1.1 TLSv1.2 TLSv1.3", a.version),
+				"ssl_protocols TLSv1.2 TLSv1.3;")
+		default:
+			add(CheckTLSProtocols, "TLS protocols", true, fmt.Sprintf("nginx default for %s: TLSv1.2 TLSv1.3", a.version), "")
+		}
+	default:
+		var weak []string
+		for _, protocol := range protocols.Args {
+			if weakProtocols[protocol] {
+				weak = append(weak, protocol)
+			}
+		}
+		if len(weak) > 0 {
+			add(CheckTLSProtocols, "TLS protocols", false, fmt.Sprintf("deprecated protocols enabled: %s", strings.Join(weak, ", ")),
+				"ssl_protocols TLSv1.2 TLSv1.3;")
+		} else {
+			add(CheckTLSProtocols, "TLS protocols", true, strings.Join(protocols.Args, " "), "")
+		}
+	}
+
+	ciphers := a.effective(chain, "ssl_ciphers")
+	switch {
+	case ciphers == nil || len(ciphers.Args) == 0:
+		add(CheckTLSCiphers, "TLS ciphers", true, "nginx default (HIGH:!aNULL:!MD5)", "")
+	default:
+		if weak := weakCiphers(ciphers.Args[0]); len(weak) > 0 {
+			add(CheckTLSCiphers, "TLS ciphers", false, fmt.Sprintf("weak ciphers allowed: %s", strings.Join(weak, ", ")),
+				"ssl_ciphers ECDHE-ECDSA-AES128-GCM-SHA256:ECDHE-RSA-AES128-GCM-SHA256:ECDHE-ECDSA-AES256-GCM-SHA384:ECDHE-RSA-AES256-GCM-SHA384;")
+		} else {
+			add(CheckTLSCiphers, "TLS ciphers", true, ciphers.Args[0], "")
+		}
+	}
+}
+
+// checkEndpoints stub_status、NGINX Plus api和autoindex没有访问限制时视为暴露
+func (a *auditor) checkEndpoints(chain []*nginxconf.Directive, add func(id, title string, passed bool, detail, remediation string)) {
+	var exposed []string
+	a.eachLocation(chain, func(locChain []*nginxconf.Directive) {
+		location := locChain[len(locChain)-1]
+		label := "location " + strings.Join(location.Args, " ")
+		for _, child := range expandChildren(a.tree, location) {
+			if (child.Name == "stub_status" || child.Name == "api") && !a.restricted(locChain) {
+				exposed = append(exposed, fmt.Sprintf("%s in %s", child.Name, label))
+			}
+		}
+		if autoindex := a.effective(locChain, "autoindex"); autoindex != nil && len(autoindex.Args) > 0 &&
+			autoindex.Args[0] == "on" && !a.restricted(locChain) {
+			exposed = append(exposed, "autoindex in "+label)
+		}
+	})
+	if autoindex := a.effective(chain, "autoindex"); autoindex != nil && len(autoindex.Args) > 0 &&
+		autoindex.Args[0] == "on" && !a.restricted(chain) {
+		exposed = append(exposed, "autoindex for the whole server")
+	}
+
+	if len(exposed) > 0 {
+		add(CheckExposedEndpoints, "Status and listing endpoints", false, strings.Join(exposed, "; "),
+			"restrict them with allow 127.0.0.1; deny all; or auth_basic, or remove them")
+	} else {
+		add(CheckExposedEndpoints, "Status and listing endpoints", true, "no unrestricted stub_status, api or autoindex", "")
+	}
+}
+
+// checkBodyLimit client_max_body_size为0（不限制）或过大时不通过
+func (a *auditor) checkBodyLimit(chain []*nginxconf.Directive, add func(id, title string, passed bool, detail, remediation string)) {
+	var unlimited []string
+	check := func(c []*nginxconf.Directive, label string) {
+		node := a.effective(c, "client_max_body_size")
+		if node == nil || len(node.Args) == 0 {
+			return
+		}
+		if size, ok := parseSize(node.Args[0]); ok && (size == 0 || size > maxBodyLimit) {
+			unlimited = append(unlimited, fmt.Sprintf("%s in %s", node.Args[0], label))
+		}
+	}
+	check(chain, "server")
+	a.eachLocation(chain, func(locChain []*nginxconf.Directive) {
+		// 只报告location中自己设置的值，继承的值已在server中报告
+		for _, child := range expandChildren(a.tree, locChain[len(locChain)-1]) {
+			if child.Name == "client_max_body_size" {
+				check(locChain, "location "+strings.Join(locChain[len(locChain)-1].Args, " "))
+				return
+			}
+		}
+	})
+
+	if len(unlimited) > 0 {
+		add(CheckBodyLimit, "Request body limit", false, "client_max_body_size "+strings.Join(unlimited, "; "),
+			"set client_max_body_size to what the application needs (default 1m), and raise it only in the locations that accept uploads")
+		return
+	}
+	size := "1m (default)"
+	if node := a.effective(chain, "client_max_body_size"); node != nil && len(node.Args) > 0 {
+		size = node.Args[0]
+	}
+	add(CheckBodyLimit, "Request body limit", true, "client_max_body_size "+size, "")
+}
+
+// checkRateLimit server（或http）中有limit_req时所有请求都受限制，否则统计location的覆盖情况
+func (a *auditor) checkRateLimit(chain []*nginxconf.Directive, add func(id, title string, passed bool, detail, remediation string)) {
+	if a.effective(chain, "limit_req") != nil {
+		add(CheckRateLimit, "Rate limiting", true, "limit_req applies to the whole server", "")
+		return
+	}
+
+	total, covered := 0, 0
+	a.eachLocation(chain, func(locChain []*nginxconf.Directive) {
+		total++
+		if a.effective(locChain, "limit_req") != nil {
+			covered++
+		}
+	})
+	detail := "no limit_req"
+	if covered > 0 {
+		detail = fmt.Sprintf("limit_req covers %d of %d locations", covered, total)
+	}
+	add(CheckRateLimit, "Rate limiting", false, detail,
+		"define limit_req_zone $binary_remote_addr zone=perip:10m rate=10r/s; in http and add limit_req zone=perip burst=20 nodelay; to the server")
+}
+
+// redirectsToHTTPS server（或location /）是否把请求跳转到https
+func (a *auditor) redirectsToHTTPS(server *nginxconf.Directive) bool {
+	isRedirect := func(node *nginxconf.Directive) bool {
+		switch node.Name {
+		case "return":
+			return len(node.Args) == 2 && strings.HasPrefix(node.Args[1], "https://")
+		case "rewrite":
+			return len(node.Args) >= 2 && strings.HasPrefix(node.Args[1], "https://")
+		}
+		return false
+	}
+	for _, child := range expandChildren(a.tree, server) {
+		if isRedirect(child) {
+			return true
+		}
+		if child.Name == "location" && child.Block && len(child.Args) == 1 && child.Args[0] == "/" {
+			for _, node := range expandChildren(a.tree, child) {
+				if isRedirect(node) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// effective 指令在chain最内层块中的生效值：从内向外第一个设置了该指令的块中的最后一条
+func (a *auditor) effective(chain []*nginxconf.Directive, name string) *nginxconf.Directive {
+	for i := len(chain) - 1; i >= 0; i-- {
+		var found *nginxconf.Directive
+		for _, child := range expandChildren(a.tree, chain[i]) {
+			if child.Name == name && !child.Block {
+				found = child
+			}
+		}
+		if found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// headers server级别生效的add_header（头名称小写），add_header只从没有设置它的块继承
+func (a *auditor) headers(chain []*nginxconf.Directive) map[string]string {
+	headers := make(map[string]string)
+	for i := len(chain) - 1; i >= 0; i-- {
+		for _, child := range expandChildren(a.tree, chain[i]) {
+			if child.Name == "add_header" && len(child.Args) > 1 {
+				headers[strings.ToLower(child.Args[0])] = child.Args[1]
+			}
+		}
+		if len(headers) > 0 {
+			break
+		}
+	}
+	return headers
+}
+
+// eachLocation 遍历server中的所有location（包括嵌套的），fn的参数为到该location的块链
+func (a *auditor) eachLocation(chain []*nginxconf.Directive, fn func(locChain []*nginxconf.Directive)) {
+	for _, child := range expandChildren(a.tree, chain[len(chain)-1]) {
+		if child.Name == "location" && child.Block {
+			locChain := append(chain[:len(chain):len(chain)], child)
+			fn(locChain)
+			a.eachLocation(locChain, fn)
+		}
+	}
+}
+
+// restricted 块链最内层生效的配置是否限制访问。allow/deny、auth_basic和auth_request各自独立继承：
+// 内层设置了其中一种就不再继承外层的同种设置（如内层auth_basic off取消外层的auth_basic）；
+// satisfy any时allow all即可放行
+func (a *auditor) restricted(chain []*nginxconf.Directive) bool {
+	denied, allowed := false, false
+	for _, rule := range a.accessRules(chain) {
+		if len(rule.Args) == 0 || rule.Args[0] != "all" {
+			continue
+		}
+		// 按顺序匹配，第一条all规则决定其余客户端能否访问
+		denied, allowed = rule.Name == "deny", rule.Name == "allow"
+		break
+	}
+	if allowed {
+		if satisfy := a.effective(chain, "satisfy"); satisfy != nil && len(satisfy.Args) > 0 && satisfy.Args[0] == "any" {
+			return false
+		}
+	}
+
+	return denied || a.enabled(chain, "auth_basic") || a.enabled(chain, "auth_request")
+}
+
+// accessRules 最内层设置了allow或deny的块中的访问规则
+func (a *auditor) accessRules(chain []*nginxconf.Directive) []*nginxconf.Directive {
+	for i := len(chain) - 1; i >= 0; i-- {
+		var rules []*nginxconf.Directive
+		for _, child := range expandChildren(a.tree, chain[i]) {
+			if (child.Name == "allow" || child.Name == "deny") && !child.Block {
+				rules = append(rules, child)
+			}
+		}
+		if len(rules) > 0 {
+			return rules
+		}
+	}
+	return nil
+}
+
+// enabled 生效的name指令是否存在且不为off
+func (a *auditor) enabled(chain []*nginxconf.Directive, name string) bool {
+	directive := a.effective(chain, name)
+	return directive != nil && len(directive.Args) > 0 && directive.Args[0] != "off"
+}
+
+// parseNginxVersion 解析nginx -v报告的版本（如nginx/1.25.0、openresty/1.21.4.1）的前三段数字
+func parseNginxVersion(version string) ([3]int, bool) {
+	var parsed [3]int
+	fields := strings.Fields(version)
+	if len(fields) == 0 {
+		return parsed, false
+	}
+	number := fields[0][strings.LastIndex(fields[0], "/")+1:]
+	parts := strings.Split(number, ".")
+	if len(parts) < 3 {
+		return parsed, false
+	}
+	for i := range parsed {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return parsed, false
+		}
+		parsed[i] = n
+	}
+	return parsed, true
+}
+
+func versionAtLeast(version [3]int, major, minor, patch int) bool {
+	want := [3]int{major, minor, patch}
+	for i := range version {
+		if version[i] != want[i] {
+			return version[i] > want[i]
+		}
+	}
+	return true
+}
+
+// listensOnAll listen参数是否监听所有网卡（只有端口、*、0.0.0.0或[::]）
+func listensOnAll(listen string) bool {
+	if strings.HasPrefix(listen, "unix:") {
+		return false
+	}
+	if _, err := strconv.Atoi(listen); err == nil {
+		return true
+	}
+	for _, prefix := range []string{"*:", "0.0.0.0:", "[::]:"} {
+		if strings.HasPrefix(listen, prefix) {
+			return true
+		}
+	}
+	return listen == "*" || listen == "0.0.0.0" || listen == "[::]"
+}
+
+// hstsMaxAge Strict-Transport-Security中的max-age
+func hstsMaxAge(value string) int {
+	for _, part := range strings.Split(value, ";") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(strings.ToLower(part), "max-age=") {
+			age, _ := strconv.Atoi(strings.Trim(part[len("max-age="):], `"`))
+			return age
+		}
+	}
+	return 0
+}
+
+// parseSize 解析nginx的大小参数，如 512、10k、1m、1g
+func parseSize(value string) (int64, bool) {
+	if value == "" {
+		return 0, false
+	}
+	unit := int64(1)
+	switch value[len(value)-1] {
+	case 'k', 'K':
+		unit = 1024
+	case 'm', 'M':
+		unit = 1024 * 1024
+	case 'g', 'G':
+		unit = 1024 * 1024 * 1024
+	}
+	if unit > 1 {
+		value = value[:len(value)-1]
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n * unit, true
+}
+
+func grade(score int) string {
+	switch {
+	case score >= 90:
+		return "A"
+	case score >= 80:
+		return "B"
+	case score >= 70:
+		return "C"
+	case score >= 60:
+		return "D"
+	}
+	return "F"
+}
+
+var securityTemplate = template.Must(template.New("security").Funcs(template.FuncMap{
+	"join": strings.Join,
+	"time": func(t time.Time) string { return t.Format(securityFormat) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Nginx security report{{ if .Instance }} - {{ .Instance }}{{ end }}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { border: 1px solid #ddd; padding: 6px 8px; text-align: left; vertical-align: top; }
+th { background: #f5f5f5; }
+.pass { color: #2e7d32; font-weight: bold; }
+.fail { color: #c62828; font-weight: bold; }
+.grade { font-size: 1.4em; font-weight: bold; }
+code { background: #f5f5f5; padding: 1px 4px; }
+</style>
+</head>
+<body>
+<h1>Nginx security report</h1>
+<p>
+{{ if .Instance }}Instance: <code>{{ .Instance }}</code><br>{{ end }}
+Config: <code>{{ .ConfigPath }}</code><br>
+Generated: {{ time .GeneratedAt }}<br>
+Overall score: <span class="grade">{{ .Score }} ({{ .Grade }})</span> across {{ len .Servers }} server block(s)
+</p>
+{{ range .Servers }}
+<h2>{{ if .ServerName }}{{ join .ServerName " " }}{{ else }}(no server_name){{ end }} &mdash; {{ .Score }} ({{ .Grade }})</h2>
+<p>{{ .File }}:{{ .Line }} &middot; listen {{ join .Listen ", " }}{{ if .TLS }} &middot; TLS{{ end }}</p>
+<table>
+<tr><th>Check</th><th>Result</th><th>Weight</th><th>Detail</th><th>Remediation</th></tr>
+{{ range .Checks }}<tr>
+<td>{{ .Title }}</td>
+<td>{{ if .Passed }}<span class="pass">PASS</span>{{ else }}<span class="fail">FAIL</span>{{ end }}</td>
+<td>{{ .Weight }}</td>
+<td>{{ .Detail }}</td>
+<td>{{ if .Remediation }}<code>{{ .Remediation }}</code>{{ end }}</td>
+</tr>
+{{ end }}</table>
+{{ end }}
+</body>
+</html>
+`))
+
+// WriteHTML 输出HTML格式的报告，用于存档和合规审查
+func (r *SecurityReport) WriteHTML(w io.Writer) error {
+	return securityTemplate.Execute(w, r)
+}
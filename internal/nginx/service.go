@@ -4,11 +4,16 @@ import (
 	"fmt"
 	"github.com/shirou/gopsutil/v3/process"
 	"github.com/sirupsen/logrus"
+	"nginx_manager/internal/metrics"
+	"nginx_manager/internal/nginxconf"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -17,16 +22,35 @@ type Service struct {
 	ConfigPath     string
 	LogPath        string
 	PidFile        string
+	metrics        *MetricsCollector
+
+	testMu   sync.Mutex
+	lastTest *configTest
+
+	upgradeMu  sync.Mutex // 同一实例同一时间只允许一次升级
+	upgradeDir string
 }
 
 type Status struct {
-	IsRunning   bool      `json:"is_running"`
-	PID         int       `json:"pid"`
-	Uptime      string    `json:"uptime"`
-	Version     string    `json:"version"`
-	ConfigValid bool      `json:"config_valid"`
-	LastError   string    `json:"last_error,omitempty"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	IsRunning     bool       `json:"is_running"`
+	PID           int        `json:"pid"`
+	StartedAt     *time.Time `json:"started_at,omitempty"`
+	UptimeSeconds int64      `json:"uptime_seconds"`
+	Uptime        string     `json:"uptime"`
+	Version       string     `json:"version"`
+	ConfigValid   bool       `json:"config_valid"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastErrorAt   *time.Time `json:"last_error_at,omitempty"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+
+	ReloadCount      int           `json:"reload_count"`
+	LastReloadAt     *time.Time    `json:"last_reload_at,omitempty"`
+	LastReloadResult string        `json:"last_reload_result,omitempty"`
+	LastStart        *ActionRecord `json:"last_start,omitempty"`
+	LastStop         *ActionRecord `json:"last_stop,omitempty"`
+
+	Connections  *ConnectionMetrics `json:"connections,omitempty"`
+	MetricsError string             `json:"metrics_error,omitempty"`
 }
 
 func NewService(execPath, configPath, logPath, pidFile string) *Service {
@@ -38,8 +62,69 @@ func NewService(execPath, configPath, logPath, pidFile string) *Service {
 	}
 }
 
+// EnableStubStatus 启用stub_status连接指标抓取
+func (s *Service) EnableStubStatus(statusURL string) {
+	if statusURL == "" {
+		return
+	}
+	s.metrics = NewMetricsCollector(statusURL)
+}
+
+// Metrics 返回stub_status指标采集器，未启用时为nil
+func (s *Service) Metrics() *MetricsCollector {
+	return s.metrics
+}
+
+// InjectStubStatus 向配置文件注入仅本机可访问的stub_status配置，验证失败时回滚
+func (s *Service) InjectStubStatus(cm *ConfigManager) (bool, error) {
+	if s.metrics == nil {
+		return false, fmt.Errorf("stub_status is not enabled")
+	}
+
+	original, err := cm.ReadConfig()
+	if err != nil {
+		return false, err
+	}
+
+	content, changed, err := InjectStubStatus(original, s.metrics.URL)
+	if err != nil || !changed {
+		return false, err
+	}
+
+	if err := cm.WriteConfig(content); err != nil {
+		return false, err
+	}
+
+	if err := s.TestConfig(); err != nil {
+		if restoreErr := cm.WriteConfig(original); restoreErr != nil {
+			logrus.Error("Failed to restore config after stub_status injection: ", restoreErr)
+		}
+		return false, fmt.Errorf("injected config is invalid: %w", err)
+	}
+
+	if s.IsRunning() {
+		if err := s.Reload(); err != nil {
+			return true, err
+		}
+	}
+
+	logrus.Infof("stub_status location injected for %s", s.metrics.URL)
+	return true, nil
+}
+
 // Start 启动nginx服务
 func (s *Service) Start() error {
+	return s.StartAs(ActorManager)
+}
+
+// StartAs 启动nginx服务并记录操作者
+func (s *Service) StartAs(actor string) error {
+	err := s.start()
+	s.history().recordStart(actor, err)
+	return err
+}
+
+func (s *Service) start() error {
 	// 检查是否已经运行
 	if s.IsRunning() {
 		return fmt.Errorf("nginx is already running")
@@ -55,75 +140,113 @@ func (s *Service) Start() error {
 		return fmt.Errorf("config test failed: %w", err)
 	}
 
+	// 清理崩溃后残留的PID文件，以便确认新master写入了PID文件
+	if s.getPIDFromFile() > 0 {
+		_ = os.Remove(s.PidFile)
+	}
+
+	// 定位到error.log末尾，启动过程中只检查新增的日志
+	errorLog := NewLogTailer(filepath.Join(s.LogPath, "error.log"))
+	_ = errorLog.ReadNew(func(string) {})
+
 	// 启动nginx
 	cmd := exec.Command(s.ExecutablePath, "-c", s.ConfigPath)
 	cmd.Dir = filepath.Dir(s.ExecutablePath)
+	output, cleanup, err := startOutput(cmd)
+	if err != nil {
+		return fmt.Errorf("failed to capture nginx output: %w", err)
+	}
+	defer cleanup()
 
 	logrus.Infof("starting nginx executable: %s", s.ExecutablePath)
 	if err := cmd.Start(); err != nil {
 		return fmt.Errorf("failed to start nginx: %w", err)
 	}
 
-	// 等待进程完全启动，最多等待5秒
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	// 等待nginx就绪，失败时返回具体原因
 	logrus.Info("waiting for nginx process to initialize...")
-	for i := 0; i < 1000; i++ { // 最多等待5秒 (1000 * 5ms)
-		if cmd.Process != nil {
-			break
+	if err := s.waitForStartup(exited, output, errorLog); err != nil {
+		// master已运行但没有就绪时停止它，避免返回失败而nginx仍在运行
+		if pid := s.getPIDFromFile(); pid > 0 && s.isPIDRunning(pid) {
+			s.history().requestStop()
+			if stopErr := s.stop("stop", stopTimeout); stopErr != nil {
+				return fmt.Errorf("%w; failed to stop the unready master %d: %v", err, pid, stopErr)
+			}
+			return fmt.Errorf("%w; master %d was stopped", err, pid)
 		}
-		time.Sleep(5 * time.Millisecond)
+		return err
 	}
 
-	// 验证是否启动成功
-	if cmd.Process == nil {
-		return fmt.Errorf("nginx process failed to start")
-	}
+	logrus.Infof("Nginx started successfully (PID: %d)", s.getPIDFromFile())
+	return nil
+}
 
-	// 进一步验证nginx是否真正运行
-	//if !s.IsRunning() {
-	//	return fmt.Errorf("nginx failed to start - check error logs")
-	//}
+// Stop 优雅停止nginx服务
+func (s *Service) Stop() error {
+	return s.StopAs(ActorManager)
+}
 
-	logrus.Infof("nginx started successfully (PID: %d)", cmd.Process.Pid)
+// StopAs 优雅停止nginx服务并记录操作者：worker处理完现有请求后退出
+func (s *Service) StopAs(actor string) error {
+	s.history().requestStop()
+	err := s.stop("quit", quitTimeout)
+	s.history().recordStop(actor, err)
+	return err
+}
 
-	logrus.Info("Nginx started successfully")
-	return nil
+// FastStop 快速停止nginx服务
+func (s *Service) FastStop() error {
+	return s.FastStopAs(ActorManager)
 }
 
-// Stop 停止nginx服务
-func (s *Service) Stop() error {
-	if !s.IsRunning() {
-		return fmt.Errorf("nginx is not running")
+// FastStopAs 快速停止nginx服务并记录操作者：立即关闭所有连接
+func (s *Service) FastStopAs(actor string) error {
+	s.history().requestStop()
+	err := s.stop("stop", stopTimeout)
+	s.history().recordStop(actor, err)
+	return err
+}
+
+// stop 通过 nginx -s quit|stop 停止nginx，并等待master进程真正退出
+func (s *Service) stop(signal string, timeout time.Duration) error {
+	pid, err := s.runningMaster()
+	if err != nil {
+		return err
 	}
 
-	// 使用nginx -s quit优雅停止
-	cmd := exec.Command(s.ExecutablePath, "-c", s.ConfigPath, "-s", "quit")
+	cmd := exec.Command(s.ExecutablePath, "-c", s.ConfigPath, "-s", signal)
 	cmd.Dir = filepath.Dir(s.ExecutablePath) // 设置工作目录为nginx安装目录
-	if err := cmd.Run(); err != nil {
-		// 如果优雅停止失败，尝试强制杀死进程
-		logrus.Warn("Graceful shutdown failed, trying force kill")
-		return s.forceKill()
-	}
-	done := make(chan error)
-	go func() {
-		done <- cmd.Wait()
-	}()
-	// 等待进程完全停止
-	deadline := time.NewTimer(5 * time.Second)
-	select {
-	case err := <-done:
-		if err != nil {
-			return err
+	if output, err := cmd.CombinedOutput(); err != nil {
+		// 发送信号失败，尝试强制杀死进程
+		logrus.Warnf("nginx -s %s failed (%s), trying force kill", signal, strings.TrimSpace(string(output)))
+		if err := s.forceKill(pid); err != nil {
+			return fmt.Errorf("failed to stop nginx: %w", err)
 		}
-	case <-deadline.C:
-		logrus.Warn("Graceful shutdown timed out")
 	}
-	return fmt.Errorf("nginx did not stop within timeout")
+
+	// 等待master完全退出
+	if !waitExit(pid, timeout) {
+		return fmt.Errorf("nginx master %d did not exit within %s", pid, timeout)
+	}
+
+	logrus.Infof("Nginx stopped (%s)", signal)
+	return nil
 }
 
 // Restart 重启nginx服务
 func (s *Service) Restart() error {
+	return s.RestartAs(ActorManager)
+}
+
+// RestartAs 重启nginx服务并记录操作者
+func (s *Service) RestartAs(actor string) error {
 	if s.IsRunning() {
-		if err := s.Stop(); err != nil {
+		if err := s.StopAs(actor); err != nil {
 			return fmt.Errorf("failed to stop nginx: %w", err)
 		}
 	}
@@ -131,7 +254,7 @@ func (s *Service) Restart() error {
 	// 等待一下确保完全停止
 	time.Sleep(1 * time.Second)
 
-	return s.Start()
+	return s.StartAs(actor)
 }
 
 // Reload 重新加载配置文件
@@ -142,13 +265,16 @@ func (s *Service) Reload() error {
 
 	// 先测试配置文件
 	if err := s.TestConfig(); err != nil {
+		s.recordReload(err)
 		return fmt.Errorf("config test failed: %w", err)
 	}
 
 	// 发送reload信号
 	cmd := exec.Command(s.ExecutablePath, "-c", s.ConfigPath, "-s", "reload")
 	cmd.Dir = filepath.Dir(s.ExecutablePath) // 设置工作目录为nginx安装目录
-	if err := cmd.Run(); err != nil {
+	err := cmd.Run()
+	s.recordReload(err)
+	if err != nil {
 		return fmt.Errorf("failed to reload nginx: %w", err)
 	}
 
@@ -156,6 +282,39 @@ func (s *Service) Reload() error {
 	return nil
 }
 
+// recordReload 记录reload结果到运行历史和Prometheus指标
+func (s *Service) recordReload(err error) {
+	s.history().recordReload(err)
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	metrics.NginxReloads.Inc(result)
+	metrics.NginxLastReload.Set(float64(time.Now().Unix()))
+	if err != nil {
+		metrics.NginxLastReloadSuccess.Set(0)
+	} else {
+		metrics.NginxLastReloadSuccess.Set(1)
+	}
+}
+
+// Reopen 通知nginx重新打开日志文件
+func (s *Service) Reopen() error {
+	if !s.IsRunning() {
+		return fmt.Errorf("nginx is not running")
+	}
+
+	cmd := exec.Command(s.ExecutablePath, "-c", s.ConfigPath, "-s", "reopen")
+	cmd.Dir = filepath.Dir(s.ExecutablePath) // 设置工作目录为nginx安装目录
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to reopen nginx logs: %s", strings.TrimSpace(string(output)))
+	}
+
+	logrus.Info("Nginx log files reopened")
+	return nil
+}
+
 // IsRunning 检查nginx是否正在运行
 func (s *Service) IsRunning() bool {
 	// 方法1：检查PID文件
@@ -172,6 +331,14 @@ func (s *Service) IsRunning() bool {
 	return s.checkManagedNginxProcess()
 }
 
+// PID 返回运行中的master进程ID，未运行时返回0
+func (s *Service) PID() int {
+	if pid := s.getPIDFromFile(); pid > 0 && s.isPIDRunning(pid) {
+		return pid
+	}
+	return 0
+}
+
 // GetStatus 获取nginx详细状态
 func (s *Service) GetStatus() *Status {
 	status := &Status{
@@ -179,26 +346,102 @@ func (s *Service) GetStatus() *Status {
 	}
 
 	status.IsRunning = s.IsRunning()
+	history := s.history()
 	if status.IsRunning {
 		status.PID = s.getPIDFromFile()
-		status.Uptime = s.getUptime()
+		master, err := process.NewProcess(int32(status.PID))
+		if err != nil {
+			master = nil
+		}
+		history.observe(master)
+		s.fillUptime(status, master)
+	} else {
+		history.observe(nil)
 	}
+	history.apply(status)
 
 	status.Version = s.getVersion()
-	status.ConfigValid = s.TestConfig() == nil
+	status.ConfigValid = s.ConfigValid()
+
+	if status.IsRunning && s.metrics != nil {
+		metrics, err := s.metrics.Scrape(ScrapeStatus)
+		if err != nil {
+			status.MetricsError = err.Error()
+		} else {
+			status.Connections = metrics
+		}
+	}
 
 	return status
 }
 
-// TestConfig 测试nginx配置文件语法
+// configTest 最近一次nginx -t的结果，以及测试时配置文件的状态
+type configTest struct {
+	fingerprint string
+	err         error
+}
+
+// TestConfig 测试nginx配置文件语法，结果同时供ConfigValid复用
 func (s *Service) TestConfig() error {
+	fingerprint := s.configFingerprint()
+
 	cmd := exec.Command(s.ExecutablePath, "-t", "-c", s.ConfigPath)
 	cmd.Dir = filepath.Dir(s.ExecutablePath) // 设置工作目录为nginx安装目录
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("config test failed: %s", string(output))
+		err = fmt.Errorf("config test failed: %s", string(output))
 	}
-	return nil
+
+	s.testMu.Lock()
+	s.lastTest = &configTest{fingerprint: fingerprint, err: err}
+	s.testMu.Unlock()
+	return err
+}
+
+// ConfigValid 配置是否有效。配置文件及其include的文件自上次测试后没有变化时直接使用上次的结果，
+// 避免状态查询、指标抓取和告警评估不断启动nginx -t
+func (s *Service) ConfigValid() bool {
+	fingerprint := s.configFingerprint()
+
+	s.testMu.Lock()
+	last := s.lastTest
+	s.testMu.Unlock()
+	if last != nil && last.fingerprint == fingerprint {
+		return last.err == nil
+	}
+	return s.TestConfig() == nil
+}
+
+// configFingerprint 主配置、include的文件及其所在目录的大小和修改时间；
+// 目录的修改时间在通配符目录中增删文件时变化
+func (s *Service) configFingerprint() string {
+	files := []string{filepath.Clean(s.ConfigPath)}
+	if tree, err := nginxconf.Load(s.ConfigPath); err == nil {
+		for file := range tree.Files {
+			files = append(files, file)
+		}
+	}
+	dirs := make(map[string]bool)
+	for _, file := range files {
+		dirs[filepath.Dir(file)] = true
+	}
+	for dir := range dirs {
+		files = append(files, dir)
+	}
+	sort.Strings(files)
+
+	var b strings.Builder
+	for i, file := range files {
+		if i > 0 && file == files[i-1] {
+			continue
+		}
+		if info, err := os.Stat(file); err == nil {
+			fmt.Fprintf(&b, "%s:%d:%d;", file, info.Size(), info.ModTime().UnixNano())
+		} else {
+			fmt.Fprintf(&b, "%s:-;", file)
+		}
+	}
+	return b.String()
 }
 
 // getPIDFromFile 从PID文件读取进程ID
@@ -256,11 +499,47 @@ func (s *Service) checkManagedNginxProcess() bool {
 }
 
 // forceKill 强制杀死nginx进程
-func (s *Service) forceKill() error {
-	cmd := exec.Command("taskkill", "/F", "/IM", "nginx.exe")
+func (s *Service) forceKill(pid int) error {
+	if signalsSupported {
+		return sendSignal(pid, "KILL")
+	}
+	// 同一主机可能运行多个实例，只结束该master及其子进程
+	cmd := exec.Command("taskkill", "/F", "/T", "/PID", strconv.Itoa(pid))
 	return cmd.Run()
 }
 
+// Version 获取nginx -v报告的版本，如nginx/1.25.0；无法获取时为unknown
+func (s *Service) Version() string {
+	return s.getVersion()
+}
+
+// Prefix 返回nginx的路径前缀（nginx -V中的--prefix），root、alias和日志的相对路径相对于它解析；
+// 编译时未指定时Windows为安装目录，其他系统为/usr/local/nginx；无法执行nginx -V时为空
+func (s *Service) Prefix() string {
+	cmd := exec.Command(s.ExecutablePath, "-V")
+	cmd.Dir = filepath.Dir(s.ExecutablePath) // 设置工作目录为nginx安装目录
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return ""
+	}
+
+	prefix := ""
+	for _, field := range strings.Fields(string(output)) {
+		if strings.HasPrefix(field, "--prefix=") {
+			prefix = strings.Trim(strings.TrimPrefix(field, "--prefix="), `"'`)
+		}
+	}
+	switch {
+	case prefix == "" && runtime.GOOS == "windows":
+		return filepath.Dir(s.ExecutablePath)
+	case prefix == "":
+		return "/usr/local/nginx"
+	case !filepath.IsAbs(prefix):
+		return filepath.Join(filepath.Dir(s.ExecutablePath), prefix)
+	}
+	return filepath.Clean(prefix)
+}
+
 // getVersion 获取nginx版本
 func (s *Service) getVersion() string {
 	cmd := exec.Command(s.ExecutablePath, "-v")
@@ -282,13 +561,21 @@ func (s *Service) getVersion() string {
 	return "unknown"
 }
 
-// getUptime 获取运行时间
-func (s *Service) getUptime() string {
-	pid := s.getPIDFromFile()
-	if pid <= 0 {
-		return "unknown"
+// fillUptime 根据master进程创建时间计算运行时长
+func (s *Service) fillUptime(status *Status, master *process.Process) {
+	status.Uptime = "unknown"
+	if master == nil {
+		return
+	}
+
+	created, err := master.CreateTime()
+	if err != nil {
+		return
 	}
 
-	// 在Windows上，这个功能比较复杂，暂时返回简单信息
-	return "running"
+	startedAt := time.UnixMilli(created)
+	uptime := time.Since(startedAt).Truncate(time.Second)
+	status.StartedAt = &startedAt
+	status.UptimeSeconds = int64(uptime.Seconds())
+	status.Uptime = formatUptime(uptime)
 }
@@ -0,0 +1,34 @@
+//go:build !windows
+
+package nginx
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// signals nginx master可接收的信号
+var signals = map[string]syscall.Signal{
+	"KILL":  syscall.SIGKILL,
+	"TERM":  syscall.SIGTERM,
+	"QUIT":  syscall.SIGQUIT,
+	"HUP":   syscall.SIGHUP,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"WINCH": syscall.SIGWINCH,
+}
+
+// signalsSupported 当前平台是否可以直接向nginx进程发送信号
+const signalsSupported = true
+
+// sendSignal 向指定进程发送信号
+func sendSignal(pid int, name string) error {
+	sig, ok := signals[name]
+	if !ok {
+		return fmt.Errorf("unsupported signal: %s", name)
+	}
+	if err := syscall.Kill(pid, sig); err != nil {
+		return fmt.Errorf("failed to send %s to %d: %w", name, pid, err)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build windows
+
+package nginx
+
+import "fmt"
+
+// signalsSupported Windows下nginx只支持通过 -s 发送stop、quit、reload、reopen
+const signalsSupported = false
+
+// sendSignal Windows不支持POSIX信号
+func sendSignal(pid int, name string) error {
+	return fmt.Errorf("signal %s is not supported on windows", name)
+}
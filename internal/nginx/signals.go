@@ -0,0 +1,95 @@
+package nginx
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	quitTimeout   = 30 * time.Second // 优雅停止需等待worker处理完现有请求
+	stopTimeout   = 10 * time.Second
+	workerTimeout = 30 * time.Second
+)
+
+// RetireWorkers 向master发送WINCH，worker处理完现有请求后退出，master保留；
+// 常用于二进制升级或临时摘除流量。仅支持POSIX信号的平台
+func (s *Service) RetireWorkers() error {
+	pid, err := s.runningMaster()
+	if err != nil {
+		return err
+	}
+
+	if err := sendSignal(pid, "WINCH"); err != nil {
+		return err
+	}
+	if remaining := waitWorkersExit(pid, 0, workerTimeout); remaining > 0 {
+		return fmt.Errorf("%d workers still draining connections after %s", remaining, workerTimeout)
+	}
+
+	logrus.Info("Nginx workers retired")
+	return nil
+}
+
+// ReloadWorkers 直接向master发送HUP重新加载配置，并等待新worker启动；
+// 配置有误时nginx保留旧worker并在error.log记录[emerg]，此时返回错误
+func (s *Service) ReloadWorkers() error {
+	pid, err := s.runningMaster()
+	if err != nil {
+		return err
+	}
+
+	master, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return fmt.Errorf("failed to inspect nginx master: %w", err)
+	}
+	old := make(map[int32]bool)
+	if children, err := master.Children(); err == nil {
+		for _, child := range children {
+			old[child.Pid] = true
+		}
+	}
+
+	errorLog := NewLogTailer(filepath.Join(s.LogPath, "error.log"))
+	_ = errorLog.ReadNew(func(string) {})
+
+	if err := sendSignal(pid, "HUP"); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(workerTimeout)
+	for {
+		if err := checkEmerg(errorLog); err != nil {
+			err = fmt.Errorf("reload failed: %w", err)
+			s.recordReload(err)
+			return err
+		}
+		if children, err := master.Children(); err == nil {
+			for _, child := range children {
+				if !old[child.Pid] {
+					s.recordReload(nil)
+					logrus.Info("Nginx workers reloaded")
+					return nil
+				}
+			}
+		}
+		if time.Now().After(deadline) {
+			err := fmt.Errorf("no new workers started within %s", workerTimeout)
+			s.recordReload(err)
+			return err
+		}
+		time.Sleep(startPollInterval)
+	}
+}
+
+// runningMaster 返回正在运行的master进程ID
+func (s *Service) runningMaster() (int, error) {
+	pid := s.getPIDFromFile()
+	if pid <= 0 || !s.isPIDRunning(pid) {
+		return 0, fmt.Errorf("nginx is not running")
+	}
+	return pid, nil
+}
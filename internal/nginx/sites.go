@@ -0,0 +1,665 @@
+package nginx
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"nginx_manager/internal/nginxconf"
+)
+
+// disabledSitePrefix 停用的站点整块注释掉，每行注释以此开头
+const disabledSitePrefix = " disabled: "
+
+// ErrSiteNotFound 站点不存在
+var ErrSiteNotFound = errors.New("site not found")
+
+var (
+	siteIDChars    = regexp.MustCompile(`[^a-z0-9.-]+`)
+	directiveName  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	siteModifiers  = map[string]bool{"": true, "=": true, "~": true, "~*": true, "^~": true}
+	siteTLSConfigs = []string{"ssl_certificate", "ssl_certificate_key", "ssl_protocols", "ssl_ciphers"}
+)
+
+// Site http块中的一个server块。更新时只修改以下字段对应的指令，
+// 块中的其他指令和注释保持不变
+type Site struct {
+	ID         string     `json:"id"`             // 由第一个server_name和listen端口生成，如example.com_443
+	File       string     `json:"file,omitempty"` // 所在文件，相对于主配置目录；创建时为空表示写入主配置
+	Line       int        `json:"line,omitempty"`
+	Enabled    bool       `json:"enabled"`
+	Listen     []string   `json:"listen"` // 每项为一条listen指令的参数，如"443 ssl"
+	ServerName []string   `json:"server_name"`
+	Root       string     `json:"root,omitempty"`
+	Index      []string   `json:"index,omitempty"`
+	TLS        *SiteTLS   `json:"tls,omitempty"`
+	Locations  []Location `json:"locations"`
+	AccessLog  string     `json:"access_log,omitempty"` // access_log的参数，如"logs/example.log main"
+	ErrorLog   string     `json:"error_log,omitempty"`
+}
+
+// SiteTLS 站点证书配置
+type SiteTLS struct {
+	Certificate    string   `json:"certificate"`
+	CertificateKey string   `json:"certificate_key"`
+	Protocols      []string `json:"protocols,omitempty"`
+	Ciphers        string   `json:"ciphers,omitempty"`
+}
+
+// Location location块，嵌套的块指令不在Directives中，更新时保持不变
+type Location struct {
+	Modifier   string              `json:"modifier,omitempty"` // =、~、~*、^~ 或空
+	Path       string              `json:"path"`
+	Directives []LocationDirective `json:"directives"`
+}
+
+// LocationDirective location中的简单指令
+type LocationDirective struct {
+	Name string   `json:"name"`
+	Args []string `json:"args"`
+}
+
+// siteRef 站点在配置树中的位置
+type siteRef struct {
+	site   Site
+	doc    *nginxconf.Document
+	parent *nginxconf.Directive
+	server *nginxconf.Directive   // 停用的站点为从注释还原出的server块
+	nodes  []*nginxconf.Directive // parent中对应的节点：启用时为server块本身，停用时为注释行
+}
+
+// httpScope 属于http上下文的块：主配置的http块，以及在其中include的文件
+type httpScope struct {
+	doc   *nginxconf.Document
+	block *nginxconf.Directive
+}
+
+// ListSites 列出http块（包括include的文件）中的所有站点
+func (cm *ConfigManager) ListSites() ([]Site, error) {
+	tree, err := nginxconf.Load(cm.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	sites := []Site{}
+	for _, ref := range findSites(tree) {
+		sites = append(sites, ref.site)
+	}
+	return sites, nil
+}
+
+// GetSite 获取单个站点
+func (cm *ConfigManager) GetSite(id string) (*Site, error) {
+	tree, err := nginxconf.Load(cm.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := findSite(tree, id)
+	if err != nil {
+		return nil, err
+	}
+	return &ref.site, nil
+}
+
+// CreateSite 添加站点并用test验证，失败时恢复原配置。site.File为空时写入主配置的http块，
+// 否则写入该文件（相对于主配置目录），文件没有被include时在http块中添加include
+func (cm *ConfigManager) CreateSite(site Site, test func() error) (*Site, error) {
+	if err := site.validate(); err != nil {
+		return nil, err
+	}
+
+	cm.editMu.Lock()
+	defer cm.editMu.Unlock()
+
+	tree, err := nginxconf.Load(cm.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	http := httpBlock(tree)
+	if http == nil {
+		return nil, fmt.Errorf("main config has no http block")
+	}
+
+	server := nginxconf.NewBlock("server", nil)
+	site.apply(server, nil)
+
+	file := tree.Main
+	if site.File != "" {
+		if file, err = cm.siteFile(site.File); err != nil {
+			return nil, err
+		}
+	}
+
+	switch doc, ok := tree.Files[file]; {
+	case file == tree.Main:
+		var last *nginxconf.Directive
+		for _, ref := range findSites(tree) {
+			if ref.parent == http {
+				last = ref.nodes[len(ref.nodes)-1]
+			}
+		}
+		http.InsertAfter(last, server)
+	case ok:
+		if !inHTTPScope(tree, doc) {
+			return nil, fmt.Errorf("%s is not included in the http block", site.File)
+		}
+		doc.Append(server)
+	default:
+		if _, err := os.Stat(file); err == nil {
+			return nil, fmt.Errorf("%s exists but is not included in the http block", site.File)
+		}
+		doc = nginxconf.NewDocument(file)
+		doc.Append(server)
+		tree.Files[file] = doc
+
+		include := coveringInclude(tree, file)
+		if include == nil {
+			include = nginxconf.New("include", site.File)
+			http.InsertAfter(lastChild(http, "include"), include)
+		}
+		tree.AddInclude(include, file)
+	}
+
+	return cm.commitSite(tree, server, nil, test)
+}
+
+// UpdateSite 修改站点的listen、server_name等字段，块中的其他内容保持不变
+func (cm *ConfigManager) UpdateSite(id string, site Site, test func() error) (*Site, error) {
+	if err := site.validate(); err != nil {
+		return nil, err
+	}
+
+	cm.editMu.Lock()
+	defer cm.editMu.Unlock()
+
+	tree, err := nginxconf.Load(cm.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := findSite(tree, id)
+	if err != nil {
+		return nil, err
+	}
+
+	site.apply(ref.server, &ref.site)
+	return cm.commitSiteEdit(tree, ref, test)
+}
+
+// SetSiteEnabled 启用或停用站点，停用时将整个server块注释掉
+func (cm *ConfigManager) SetSiteEnabled(id string, enabled bool, test func() error) (*Site, error) {
+	cm.editMu.Lock()
+	defer cm.editMu.Unlock()
+
+	tree, err := nginxconf.Load(cm.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := findSite(tree, id)
+	if err != nil {
+		return nil, err
+	}
+	if ref.site.Enabled == enabled {
+		return &ref.site, nil
+	}
+
+	marker := ref.server
+	if enabled {
+		ref.parent.ReplaceNodes(ref.nodes, ref.server)
+	} else {
+		comments := nginxconf.CommentOut(ref.server, disabledSitePrefix)
+		ref.parent.ReplaceNodes(ref.nodes, comments...)
+		marker = comments[0]
+	}
+	return cm.commitSite(tree, marker, nil, test)
+}
+
+// DeleteSite 删除站点；站点所在的独立文件因此变空时一并删除，并移除指向它的include
+func (cm *ConfigManager) DeleteSite(id string, test func() error) error {
+	cm.editMu.Lock()
+	defer cm.editMu.Unlock()
+
+	tree, err := nginxconf.Load(cm.ConfigPath)
+	if err != nil {
+		return err
+	}
+	ref, err := findSite(tree, id)
+	if err != nil {
+		return err
+	}
+	ref.parent.ReplaceNodes(ref.nodes)
+
+	var removed []string
+	if ref.doc != tree.Root() && len(ref.doc.Children) == 0 {
+		removed = append(removed, ref.doc.File)
+		for _, scope := range httpScopes(tree) {
+			for _, include := range scope.block.Find("include") {
+				if len(include.Args) > 0 && tree.Resolve(include.Args[0]) == ref.doc.File {
+					scope.block.Remove(include)
+				}
+			}
+		}
+	}
+
+	_, err = cm.commitSite(tree, nil, removed, test)
+	return err
+}
+
+// commitSiteEdit 提交对ref.server的修改，停用的站点重新注释掉
+func (cm *ConfigManager) commitSiteEdit(tree *nginxconf.Tree, ref *siteRef, test func() error) (*Site, error) {
+	marker := ref.server
+	if !ref.site.Enabled {
+		comments := nginxconf.CommentOut(ref.server, disabledSitePrefix)
+		ref.parent.ReplaceNodes(ref.nodes, comments...)
+		marker = comments[0]
+	}
+	return cm.commitSite(tree, marker, nil, test)
+}
+
+// commitSite 写入修改过的文件并验证，返回marker节点对应站点的最新信息
+func (cm *ConfigManager) commitSite(tree *nginxconf.Tree, marker *nginxconf.Directive, removed []string, test func() error) (*Site, error) {
+	index := -1
+	for i, ref := range findSites(tree) {
+		if marker != nil && ref.nodes[0] == marker {
+			index = i
+		}
+	}
+
+	if err := cm.commitTree(tree, removed, test); err != nil {
+		return nil, err
+	}
+
+	if index < 0 {
+		return nil, nil
+	}
+	// 重新加载以获得准确的行号，站点顺序与修改后的树一致
+	reloaded, err := nginxconf.Load(cm.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	refs := findSites(reloaded)
+	if index >= len(refs) {
+		return nil, fmt.Errorf("site not found after saving")
+	}
+	return &refs[index].site, nil
+}
+
+func resolveConfigPath(prefix, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(prefix, path)
+}
+
+// siteFile 将站点文件解析为绝对路径，只允许主配置目录下的文件
+func (cm *ConfigManager) siteFile(name string) (string, error) {
+	prefix := filepath.Dir(filepath.Clean(cm.ConfigPath))
+	file := resolveConfigPath(prefix, name)
+	rel, err := filepath.Rel(prefix, file)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("site file must be inside %s", prefix)
+	}
+	return file, nil
+}
+
+func httpBlock(tree *nginxconf.Tree) *nginxconf.Directive {
+	for _, node := range tree.Root().Find("http") {
+		if node.Block {
+			return node
+		}
+	}
+	return nil
+}
+
+// httpScopes 返回http上下文中的所有块，包括在http块中（直接或间接）include的文件
+func httpScopes(tree *nginxconf.Tree) []httpScope {
+	http := httpBlock(tree)
+	if http == nil {
+		return nil
+	}
+
+	var scopes []httpScope
+	visited := make(map[*nginxconf.Document]bool)
+	var collect func(doc *nginxconf.Document, block *nginxconf.Directive)
+	collect = func(doc *nginxconf.Document, block *nginxconf.Directive) {
+		scopes = append(scopes, httpScope{doc: doc, block: block})
+		for _, include := range block.Find("include") {
+			for _, included := range tree.Included(include) {
+				if !visited[included] {
+					visited[included] = true
+					collect(included, &included.Directive)
+				}
+			}
+		}
+	}
+	collect(tree.Root(), http)
+	return scopes
+}
+
+func inHTTPScope(tree *nginxconf.Tree, doc *nginxconf.Document) bool {
+	for _, scope := range httpScopes(tree) {
+		if scope.doc == doc && scope.block == &doc.Directive {
+			return true
+		}
+	}
+	return false
+}
+
+// coveringInclude 返回http上下文中通配符能匹配file的include指令
+func coveringInclude(tree *nginxconf.Tree, file string) *nginxconf.Directive {
+	for _, scope := range httpScopes(tree) {
+		for _, include := range scope.block.Find("include") {
+			if len(include.Args) == 0 {
+				continue
+			}
+			if ok, _ := filepath.Match(tree.Resolve(include.Args[0]), file); ok {
+				return include
+			}
+		}
+	}
+	return nil
+}
+
+func lastChild(block *nginxconf.Directive, name string) *nginxconf.Directive {
+	found := block.Find(name)
+	if len(found) == 0 {
+		return nil
+	}
+	return found[len(found)-1]
+}
+
+// findSites 按nginx加载顺序找出所有站点，包括注释掉的站点
+func findSites(tree *nginxconf.Tree) []siteRef {
+	var refs []siteRef
+	for _, scope := range httpScopes(tree) {
+		children := scope.block.Children
+		for i := 0; i < len(children); i++ {
+			child := children[i]
+			if child.Name == "server" && child.Block {
+				refs = append(refs, newSiteRef(tree, scope, child, true, []*nginxconf.Directive{child}))
+				continue
+			}
+			if !nginxconf.IsCommentedOut(child, disabledSitePrefix) {
+				continue
+			}
+
+			end := i
+			for end+1 < len(children) && nginxconf.IsCommentedOut(children[end+1], disabledSitePrefix) {
+				end++
+			}
+			nodes := children[i : end+1]
+			i = end
+
+			restored, err := nginxconf.Uncomment(nodes, disabledSitePrefix)
+			if err != nil || len(restored) != 1 || restored[0].Name != "server" || !restored[0].Block {
+				continue
+			}
+			refs = append(refs, newSiteRef(tree, scope, restored[0], false, append([]*nginxconf.Directive{}, nodes...)))
+		}
+	}
+
+	seen := make(map[string]int)
+	for i := range refs {
+		id := refs[i].site.ID
+		seen[id]++
+		if seen[id] > 1 {
+			refs[i].site.ID = fmt.Sprintf("%s-%d", id, seen[id])
+		}
+	}
+	return refs
+}
+
+func findSite(tree *nginxconf.Tree, id string) (*siteRef, error) {
+	for _, ref := range findSites(tree) {
+		if ref.site.ID == id {
+			return &ref, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrSiteNotFound, id)
+}
+
+func newSiteRef(tree *nginxconf.Tree, scope httpScope, server *nginxconf.Directive, enabled bool, nodes []*nginxconf.Directive) siteRef {
+	site := siteFrom(server)
+	site.Enabled = enabled
+	site.Line = nodes[0].Line
+	site.File = scope.doc.File
+	if rel, err := filepath.Rel(tree.Prefix, scope.doc.File); err == nil && !strings.HasPrefix(rel, "..") {
+		site.File = rel
+	}
+	return siteRef{site: site, doc: scope.doc, parent: scope.block, server: server, nodes: nodes}
+}
+
+// siteFrom 从server块读取站点字段
+func siteFrom(server *nginxconf.Directive) Site {
+	site := Site{
+		ID:         siteID(server),
+		Listen:     []string{},
+		ServerName: []string{},
+		Root:       server.Value("root"),
+		AccessLog:  server.Value("access_log"),
+		ErrorLog:   server.Value("error_log"),
+		Locations:  []Location{},
+	}
+
+	for _, child := range server.Children {
+		if child.Block {
+			if child.Name == "location" && len(child.Args) > 0 {
+				site.Locations = append(site.Locations, locationFrom(child))
+			}
+			continue
+		}
+		switch child.Name {
+		case "listen":
+			site.Listen = append(site.Listen, strings.Join(child.Args, " "))
+		case "server_name":
+			site.ServerName = append(site.ServerName, child.Args...)
+		case "index":
+			site.Index = append(site.Index, child.Args...)
+		}
+	}
+
+	if cert := server.First("ssl_certificate"); cert != nil {
+		site.TLS = &SiteTLS{
+			Certificate:    server.Value("ssl_certificate"),
+			CertificateKey: server.Value("ssl_certificate_key"),
+			Ciphers:        server.Value("ssl_ciphers"),
+		}
+		if protocols := server.First("ssl_protocols"); protocols != nil {
+			site.TLS.Protocols = protocols.Args
+		}
+	}
+	return site
+}
+
+func locationFrom(node *nginxconf.Directive) Location {
+	loc := Location{Path: node.Args[len(node.Args)-1], Directives: []LocationDirective{}}
+	if len(node.Args) > 1 {
+		loc.Modifier = node.Args[0]
+	}
+	for _, child := range node.Children {
+		if !child.Block && !child.IsComment() {
+			loc.Directives = append(loc.Directives, LocationDirective{Name: child.Name, Args: child.Args})
+		}
+	}
+	return loc
+}
+
+// siteID 由第一个server_name和第一个listen的端口生成站点ID
+func siteID(server *nginxconf.Directive) string {
+	name := "default"
+	if names := server.First("server_name"); names != nil && len(names.Args) > 0 && names.Args[0] != "_" && names.Args[0] != "" {
+		name = strings.ReplaceAll(strings.ToLower(names.Args[0]), "*", "wildcard")
+	}
+
+	port := "80"
+	if listen := server.First("listen"); listen != nil && len(listen.Args) > 0 {
+		if strings.HasPrefix(listen.Args[0], "unix:") {
+			port = "unix"
+		} else if addr, ok := probeAddress(listen.Args[0]); ok {
+			_, port, _ = net.SplitHostPort(addr)
+		}
+	}
+	return strings.Trim(siteIDChars.ReplaceAllString(name, "-"), "-") + "_" + port
+}
+
+func (s *Site) validate() error {
+	if len(s.Listen) == 0 {
+		return fmt.Errorf("at least one listen address is required")
+	}
+	for _, listen := range s.Listen {
+		if strings.TrimSpace(listen) == "" {
+			return fmt.Errorf("listen address cannot be empty")
+		}
+	}
+	if s.TLS != nil && (s.TLS.Certificate == "" || s.TLS.CertificateKey == "") {
+		return fmt.Errorf("tls requires certificate and certificate_key")
+	}
+
+	seen := make(map[string]bool)
+	for i := range s.Locations {
+		loc := &s.Locations[i]
+		if err := loc.validate(); err != nil {
+			return err
+		}
+		key := strings.Join(loc.args(), " ")
+		if seen[key] {
+			return fmt.Errorf("duplicate location %s", key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// apply 把站点字段写入server块；prev不为nil时只修改与prev不同的字段，
+// 以免改写未变化的指令
+func (s *Site) apply(server *nginxconf.Directive, prev *Site) {
+	changed := func(field func(*Site) interface{}) bool {
+		return prev == nil || !reflect.DeepEqual(field(s), field(prev))
+	}
+
+	if changed(func(x *Site) interface{} { return x.Listen }) {
+		var values [][]string
+		for _, listen := range s.Listen {
+			values = append(values, strings.Fields(listen))
+		}
+		server.Set("listen", values...)
+	}
+	if changed(func(x *Site) interface{} { return x.ServerName }) {
+		server.Set("server_name", single(s.ServerName...)...)
+	}
+	if changed(func(x *Site) interface{} { return x.Root }) {
+		server.Set("root", single(nonEmpty(s.Root)...)...)
+	}
+	if changed(func(x *Site) interface{} { return x.Index }) {
+		server.Set("index", single(s.Index...)...)
+	}
+	if changed(func(x *Site) interface{} { return x.TLS }) {
+		if s.TLS == nil {
+			for _, name := range siteTLSConfigs {
+				server.Set(name)
+			}
+		} else {
+			server.Set("ssl_certificate", single(s.TLS.Certificate)...)
+			server.Set("ssl_certificate_key", single(s.TLS.CertificateKey)...)
+			server.Set("ssl_protocols", single(s.TLS.Protocols...)...)
+			server.Set("ssl_ciphers", single(nonEmpty(s.TLS.Ciphers)...)...)
+		}
+	}
+	if changed(func(x *Site) interface{} { return x.AccessLog }) {
+		server.Set("access_log", single(strings.Fields(s.AccessLog)...)...)
+	}
+	if changed(func(x *Site) interface{} { return x.ErrorLog }) {
+		server.Set("error_log", single(strings.Fields(s.ErrorLog)...)...)
+	}
+	if changed(func(x *Site) interface{} { return x.Locations }) {
+		syncLocations(server, s.Locations)
+	}
+}
+
+// syncLocations 按修饰符和路径匹配已有的location块，只修改其中的简单指令；
+// 新的location添加在最后一个location之后，不再需要的删除
+func syncLocations(server *nginxconf.Directive, locations []Location) {
+	var existing []*nginxconf.Directive
+	var last *nginxconf.Directive
+	for _, child := range server.Children {
+		if child.Name == "location" && child.Block {
+			existing = append(existing, child)
+			last = child
+		}
+	}
+
+	used := make(map[*nginxconf.Directive]bool)
+	for _, loc := range locations {
+		args := []string{loc.Path}
+		if loc.Modifier != "" {
+			args = []string{loc.Modifier, loc.Path}
+		}
+
+		var node *nginxconf.Directive
+		for _, candidate := range existing {
+			if !used[candidate] && strings.Join(candidate.Args, " ") == strings.Join(args, " ") {
+				node = candidate
+				break
+			}
+		}
+		if node == nil {
+			node = nginxconf.NewBlock("location", args)
+			if last != nil {
+				server.InsertAfter(last, node)
+			} else {
+				server.Append(node)
+			}
+			last = node
+		}
+		used[node] = true
+		syncDirectives(node, loc.Directives)
+	}
+
+	for _, node := range existing {
+		if !used[node] {
+			server.Remove(node)
+		}
+	}
+}
+
+// syncDirectives 使块中的简单指令与directives一致，嵌套的块保持不变
+func syncDirectives(block *nginxconf.Directive, directives []LocationDirective) {
+	values := make(map[string][][]string)
+	var names []string
+	for _, d := range directives {
+		if _, ok := values[d.Name]; !ok {
+			names = append(names, d.Name)
+		}
+		values[d.Name] = append(values[d.Name], d.Args)
+	}
+
+	for _, child := range append([]*nginxconf.Directive{}, block.Children...) {
+		if !child.Block && !child.IsComment() {
+			if _, ok := values[child.Name]; !ok {
+				block.Set(child.Name)
+			}
+		}
+	}
+	for _, name := range names {
+		block.Set(name, values[name]...)
+	}
+}
+
+// single 参数为空时不生成指令，否则生成一条指令
+func single(args ...string) [][]string {
+	if len(args) == 0 {
+		return nil
+	}
+	return [][]string{args}
+}
+
+func nonEmpty(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return []string{value}
+}
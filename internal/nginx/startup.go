@@ -0,0 +1,174 @@
+package nginx
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"nginx_manager/internal/nginxconf"
+)
+
+const (
+	startTimeout      = 10 * time.Second
+	startPollInterval = 100 * time.Millisecond
+	probeTimeout      = 200 * time.Millisecond
+)
+
+// ListenAddresses 解析配置中所有listen指令对应的TCP地址，通配地址转换为本机回环地址以便探测；
+// udp（stream）和quic（HTTP/3）监听无法用TCP连接探测，不包括在内
+func ListenAddresses(configPath string) ([]string, error) {
+	tree, err := nginxconf.Load(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	addrs := []string{}
+	tree.Walk(func(node *nginxconf.Directive, parents []*nginxconf.Directive) bool {
+		if node.Name != "listen" || len(node.Args) == 0 {
+			return true
+		}
+		for _, param := range node.Args[1:] {
+			if param == "udp" || param == "quic" {
+				return true
+			}
+		}
+		addr, ok := probeAddress(node.Args[0])
+		if ok && !seen[addr] {
+			seen[addr] = true
+			addrs = append(addrs, addr)
+		}
+		return true
+	})
+	return addrs, nil
+}
+
+// probeAddress 将listen参数（80、127.0.0.1:8080、[::]:443、*:80）转换为可连接的地址
+func probeAddress(listen string) (string, bool) {
+	if strings.HasPrefix(listen, "unix:") || strings.Contains(listen, "$") {
+		return "", false
+	}
+
+	host, port := "", listen
+	if strings.HasPrefix(listen, "[") {
+		end := strings.Index(listen, "]")
+		if end < 0 {
+			return "", false
+		}
+		host = listen[1:end]
+		port = strings.TrimPrefix(listen[end+1:], ":")
+		if port == "" {
+			port = "80"
+		}
+	} else if i := strings.LastIndex(listen, ":"); i >= 0 {
+		host, port = listen[:i], listen[i+1:]
+	} else if _, err := strconv.Atoi(listen); err != nil {
+		// 只有主机名，使用默认端口
+		host, port = listen, "80"
+	}
+
+	if _, err := strconv.Atoi(port); err != nil {
+		return "", false
+	}
+	switch host {
+	case "", "*", "0.0.0.0":
+		host = "127.0.0.1"
+	case "::":
+		host = "::1"
+	}
+	return net.JoinHostPort(host, port), true
+}
+
+// unreachable 返回无法建立TCP连接的地址
+func unreachable(addrs []string) []string {
+	var failed []string
+	for _, addr := range addrs {
+		conn, err := net.DialTimeout("tcp", addr, probeTimeout)
+		if err != nil {
+			failed = append(failed, addr)
+			continue
+		}
+		conn.Close()
+	}
+	return failed
+}
+
+// waitForStartup 等待nginx真正启动：PID文件写入、master存活、error.log无[emerg]、所有监听地址可连接。
+// exited在启动命令退出时收到其结果（Unix下nginx转入后台后启动命令会立即以0退出）
+func (s *Service) waitForStartup(exited <-chan error, output func() string, errorLog *LogTailer) error {
+	addrs, err := ListenAddresses(s.ConfigPath)
+	if err != nil {
+		addrs = nil
+	}
+
+	deadline := time.Now().Add(startTimeout)
+	var emerg []string
+	var pending []string
+	for {
+		_ = errorLog.ReadNew(func(line string) {
+			if strings.Contains(line, "[emerg]") {
+				emerg = append(emerg, line)
+			}
+		})
+		if len(emerg) > 0 {
+			return fmt.Errorf("nginx failed to start: %s", strings.Join(emerg, "; "))
+		}
+
+		select {
+		case err := <-exited:
+			exited = nil
+			if err != nil {
+				if out := strings.TrimSpace(output()); out != "" {
+					return fmt.Errorf("nginx exited during startup: %s", out)
+				}
+				return fmt.Errorf("nginx exited during startup: %w", err)
+			}
+		default:
+		}
+
+		pid := s.getPIDFromFile()
+		switch {
+		case pid <= 0:
+			pending = []string{"PID file " + s.PidFile + " was not written"}
+		case !s.isPIDRunning(pid):
+			pending = []string{fmt.Sprintf("master process %d is not alive", pid)}
+		default:
+			pending = pending[:0]
+			for _, addr := range unreachable(addrs) {
+				pending = append(pending, addr+" is not accepting connections")
+			}
+			if len(pending) == 0 {
+				return nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("nginx did not become ready within %s: %s", startTimeout, strings.Join(pending, ", "))
+		}
+		time.Sleep(startPollInterval)
+	}
+}
+
+// startOutput 为启动命令创建输出文件；使用文件而不是管道，避免转入后台的nginx继承管道导致等待阻塞
+func startOutput(cmd *exec.Cmd) (read func() string, cleanup func(), err error) {
+	file, err := os.CreateTemp("", "nginx-start-*.log")
+	if err != nil {
+		return nil, nil, err
+	}
+	cmd.Stdout = file
+	cmd.Stderr = file
+
+	read = func() string {
+		data, _ := os.ReadFile(file.Name())
+		return string(data)
+	}
+	cleanup = func() {
+		file.Close()
+		os.Remove(file.Name())
+	}
+	return read, cleanup, nil
+}
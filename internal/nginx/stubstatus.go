@@ -0,0 +1,252 @@
+package nginx
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stubStatusMarker 自动注入的status配置块标记，用于识别和避免重复注入
+const stubStatusMarker = "# nginx-manager: stub_status"
+
+// ConnectionMetrics stub_status连接指标
+type ConnectionMetrics struct {
+	Active       int64     `json:"active"`
+	Reading      int64     `json:"reading"`
+	Writing      int64     `json:"writing"`
+	Waiting      int64     `json:"waiting"`
+	Accepts      int64     `json:"accepts"`
+	Handled      int64     `json:"handled"`
+	Requests     int64     `json:"requests"`
+	AcceptsRate  float64   `json:"accepts_rate"`
+	HandledRate  float64   `json:"handled_rate"`
+	RequestsRate float64   `json:"requests_rate"`
+	RatesValid   bool      `json:"rates_valid"` // 有上次抓取结果可用于计算速率
+	ScrapedAt    time.Time `json:"scraped_at"`
+}
+
+// 抓取stub_status的使用方，各自以上次抓取为基准计算速率，互不干扰
+const (
+	ScrapeStatus  = "status"
+	ScrapeMetrics = "metrics"
+	ScrapeHistory = "history"
+	ScrapeAlerts  = "alerts"
+)
+
+// MetricsCollector 抓取nginx stub_status并计算速率
+type MetricsCollector struct {
+	URL    string
+	client *http.Client
+	mu     sync.Mutex
+	last   map[string]*ConnectionMetrics // 每个使用方上次的抓取结果
+	latest *ConnectionMetrics
+}
+
+func NewMetricsCollector(statusURL string) *MetricsCollector {
+	return &MetricsCollector{
+		URL:    statusURL,
+		client: &http.Client{Timeout: 3 * time.Second},
+		last:   make(map[string]*ConnectionMetrics),
+	}
+}
+
+// Scrape 抓取一次stub_status，速率根据与同一使用方上次抓取的差值计算，即各自的采样周期内的平均值
+func (m *MetricsCollector) Scrape(consumer string) (*ConnectionMetrics, error) {
+	resp, err := m.client.Get(m.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scrape stub_status: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("stub_status returned HTTP %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stub_status: %w", err)
+	}
+
+	metrics, err := ParseStubStatus(string(body))
+	if err != nil {
+		return nil, err
+	}
+	metrics.ScrapedAt = time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 计数器回退说明nginx已重启，此时不计算速率
+	if prev := m.last[consumer]; prev != nil && metrics.Accepts >= prev.Accepts && metrics.Requests >= prev.Requests {
+		if elapsed := metrics.ScrapedAt.Sub(prev.ScrapedAt).Seconds(); elapsed > 0 {
+			metrics.AcceptsRate = float64(metrics.Accepts-prev.Accepts) / elapsed
+			metrics.HandledRate = float64(metrics.Handled-prev.Handled) / elapsed
+			metrics.RequestsRate = float64(metrics.Requests-prev.Requests) / elapsed
+			metrics.RatesValid = true
+		}
+	}
+	m.last[consumer] = metrics
+	m.latest = metrics
+
+	return metrics, nil
+}
+
+// Latest 返回最近一次抓取结果
+func (m *MetricsCollector) Latest() *ConnectionMetrics {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.latest
+}
+
+// ParseStubStatus 解析stub_status输出
+func ParseStubStatus(body string) (*ConnectionMetrics, error) {
+	lines := strings.Split(strings.TrimSpace(body), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[0], "Active connections:") {
+		return nil, fmt.Errorf("unexpected stub_status output")
+	}
+
+	metrics := &ConnectionMetrics{}
+	var err error
+	if metrics.Active, err = strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(lines[0], "Active connections:")), 10, 64); err != nil {
+		return nil, fmt.Errorf("invalid active connections: %w", err)
+	}
+
+	counters := strings.Fields(lines[2])
+	if len(counters) != 3 {
+		return nil, fmt.Errorf("invalid stub_status counters: %s", lines[2])
+	}
+	for i, dst := range []*int64{&metrics.Accepts, &metrics.Handled, &metrics.Requests} {
+		if *dst, err = strconv.ParseInt(counters[i], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid stub_status counter: %w", err)
+		}
+	}
+
+	// Reading: 6 Writing: 179 Waiting: 106
+	fields := strings.Fields(lines[3])
+	for i := 0; i+1 < len(fields); i += 2 {
+		value, err := strconv.ParseInt(fields[i+1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid stub_status state: %w", err)
+		}
+		switch fields[i] {
+		case "Reading:":
+			metrics.Reading = value
+		case "Writing:":
+			metrics.Writing = value
+		case "Waiting:":
+			metrics.Waiting = value
+		}
+	}
+
+	return metrics, nil
+}
+
+// StubStatusBlock 根据status地址生成仅允许本机访问的server配置块
+func StubStatusBlock(statusURL string) (string, error) {
+	u, err := url.Parse(statusURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid stub_status url: %w", err)
+	}
+
+	host, port := u.Hostname(), u.Port()
+	if port == "" {
+		port = "80"
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return "", fmt.Errorf("stub_status url must point to localhost: %s", statusURL)
+	}
+	if host == "localhost" {
+		host = "127.0.0.1"
+	}
+
+	path := u.Path
+	if path == "" {
+		path = "/"
+	}
+
+	return fmt.Sprintf(`    %s begin
+    server {
+        listen       %s;
+        server_name  localhost;
+
+        location = %s {
+            stub_status;
+            access_log off;
+            allow 127.0.0.1;
+            allow ::1;
+            deny all;
+        }
+    }
+    %s end
+`, stubStatusMarker, net.JoinHostPort(host, port), path, stubStatusMarker), nil
+}
+
+// InjectStubStatus 在http块末尾注入stub_status配置，已存在时不做修改
+func InjectStubStatus(content, statusURL string) (string, bool, error) {
+	if strings.Contains(content, stubStatusMarker) {
+		return content, false, nil
+	}
+
+	block, err := StubStatusBlock(statusURL)
+	if err != nil {
+		return content, false, err
+	}
+
+	end, err := findBlockEnd(content, "http")
+	if err != nil {
+		return content, false, err
+	}
+
+	return content[:end] + "\n" + block + content[end:], true, nil
+}
+
+// findBlockEnd 返回指定顶层块结束大括号的位置，跳过注释和引号中的内容
+func findBlockEnd(content, name string) (int, error) {
+	depth := 0
+	inBlock := false
+	var word strings.Builder
+	var quote byte
+
+	for i := 0; i < len(content); i++ {
+		ch := content[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '#':
+			for i < len(content) && content[i] != '\n' {
+				i++
+			}
+			word.Reset()
+		case ch == '{':
+			if depth == 0 && strings.TrimSpace(word.String()) == name {
+				inBlock = true
+			}
+			depth++
+			word.Reset()
+		case ch == '}':
+			depth--
+			if depth == 0 && inBlock {
+				return i, nil
+			}
+			word.Reset()
+		case ch == ';':
+			word.Reset()
+		default:
+			word.WriteByte(ch)
+		}
+	}
+
+	return 0, fmt.Errorf("%s block not found in config", name)
+}
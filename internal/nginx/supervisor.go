@@ -0,0 +1,291 @@
+package nginx
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	SupervisorIdle      = "idle"       // 尚未观察到nginx运行
+	SupervisorWatching  = "watching"   // nginx运行中，监视异常退出
+	SupervisorStopped   = "stopped"    // nginx被有意停止，不自动重启
+	SupervisorBackoff   = "backoff"    // 等待下一次重启
+	SupervisorStarting  = "starting"   // 已执行启动，等待确认
+	SupervisorCrashLoop = "crash_loop" // 重启次数超限，放弃自动重启
+
+	SupervisorEventCrashed       = "crashed"
+	SupervisorEventStopped       = "stopped"
+	SupervisorEventRestarting    = "restarting"
+	SupervisorEventRestarted     = "restarted"
+	SupervisorEventRestartFailed = "restart_failed"
+	SupervisorEventCrashLoop     = "crash_loop"
+	SupervisorEventRecovered     = "recovered"
+
+	maxSupervisorEvents = 100
+)
+
+// SupervisorPolicy 守护策略
+type SupervisorPolicy struct {
+	CheckInterval  time.Duration
+	BackoffInitial time.Duration
+	BackoffMax     time.Duration
+	MaxRestarts    int           // Window内最多自动重启次数
+	Window         time.Duration // 统计重启次数的时间窗口
+	ErrorLogLines  int           // 崩溃时附带的error.log行数
+}
+
+// SupervisorEvent 守护进程的一次动作或观察
+type SupervisorEvent struct {
+	Type     string    `json:"type"`
+	Message  string    `json:"message"`
+	At       time.Time `json:"at"`
+	Attempt  int       `json:"attempt,omitempty"`
+	ErrorLog []string  `json:"error_log,omitempty"`
+}
+
+// SupervisorState 守护进程当前状态
+type SupervisorState struct {
+	State         string            `json:"state"`
+	Restarts      int               `json:"restarts"` // 当前窗口内的自动重启次数
+	MaxRestarts   int               `json:"max_restarts"`
+	NextRestartAt *time.Time        `json:"next_restart_at,omitempty"`
+	LastCrashAt   *time.Time        `json:"last_crash_at,omitempty"`
+	Events        []SupervisorEvent `json:"events"`
+}
+
+// Supervisor nginx守护进程：master异常退出后按指数退避自动重启
+type Supervisor struct {
+	service *Service
+	policy  SupervisorPolicy
+	notify  func(SupervisorEvent)
+
+	mu           sync.Mutex
+	state        string
+	running      bool
+	runningSince time.Time
+	restarts     []time.Time
+	nextRestart  time.Time
+	lastCrash    time.Time
+	events       []SupervisorEvent
+}
+
+// NewSupervisor 创建守护进程，notify在每个事件发生时调用，可为nil
+func NewSupervisor(service *Service, policy SupervisorPolicy, notify func(SupervisorEvent)) *Supervisor {
+	if policy.CheckInterval <= 0 {
+		policy.CheckInterval = 5 * time.Second
+	}
+	if policy.BackoffInitial <= 0 {
+		policy.BackoffInitial = 2 * time.Second
+	}
+	if policy.BackoffMax < policy.BackoffInitial {
+		policy.BackoffMax = policy.BackoffInitial
+	}
+	return &Supervisor{
+		service: service,
+		policy:  policy,
+		notify:  notify,
+		state:   SupervisorIdle,
+	}
+}
+
+// Run 定期检查nginx状态，阻塞运行
+func (sv *Supervisor) Run() {
+	ticker := time.NewTicker(sv.policy.CheckInterval)
+	defer ticker.Stop()
+
+	sv.Check(time.Now())
+	for now := range ticker.C {
+		sv.Check(now)
+	}
+}
+
+// Check 执行一次检查
+func (sv *Supervisor) Check(now time.Time) {
+	running := sv.service.IsRunning()
+
+	sv.mu.Lock()
+	wasRunning := sv.running
+	sv.running = running
+
+	if running {
+		if !wasRunning {
+			sv.runningSince = now
+			if sv.state == SupervisorCrashLoop || sv.state == SupervisorBackoff {
+				// 在放弃或等待期间被手动启动
+				sv.restarts = nil
+				sv.emit(SupervisorEvent{Type: SupervisorEventRecovered, Message: "nginx is running again, supervision resumed", At: now})
+			}
+		}
+		sv.state = SupervisorWatching
+		sv.mu.Unlock()
+		return
+	}
+
+	switch {
+	case wasRunning:
+		if sv.intentionalStop() {
+			sv.state = SupervisorStopped
+			sv.emit(SupervisorEvent{Type: SupervisorEventStopped, Message: "nginx was stopped intentionally, not restarting", At: now})
+			sv.mu.Unlock()
+			return
+		}
+		sv.lastCrash = now
+		sv.emit(SupervisorEvent{
+			Type:     SupervisorEventCrashed,
+			Message:  "nginx master process exited unexpectedly",
+			At:       now,
+			ErrorLog: sv.errorLog(),
+		})
+		sv.schedule(now)
+	case sv.state == SupervisorStarting:
+		// 启动命令成功但nginx没有运行起来
+		sv.emit(SupervisorEvent{
+			Type:     SupervisorEventRestartFailed,
+			Message:  "nginx exited right after restart",
+			At:       now,
+			Attempt:  len(sv.restarts),
+			ErrorLog: sv.errorLog(),
+		})
+		sv.schedule(now)
+	}
+
+	if sv.state != SupervisorBackoff || now.Before(sv.nextRestart) {
+		sv.mu.Unlock()
+		return
+	}
+
+	// 等待重启期间通过管理器停止，视为放弃恢复
+	if sv.service.history().stopRequestedSince(sv.lastCrash) {
+		sv.state = SupervisorStopped
+		sv.emit(SupervisorEvent{Type: SupervisorEventStopped, Message: "stop requested while waiting to restart, not restarting", At: now})
+		sv.mu.Unlock()
+		return
+	}
+
+	sv.restarts = append(sv.restarts, now)
+	attempt := len(sv.restarts)
+	sv.state = SupervisorStarting
+	sv.emit(SupervisorEvent{Type: SupervisorEventRestarting, Message: fmt.Sprintf("restarting nginx (attempt %d)", attempt), At: now, Attempt: attempt})
+	sv.mu.Unlock()
+
+	err := sv.service.StartAs(ActorSupervisor)
+
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+	if sv.state != SupervisorStarting {
+		return
+	}
+	if err != nil {
+		sv.emit(SupervisorEvent{
+			Type:     SupervisorEventRestartFailed,
+			Message:  fmt.Sprintf("failed to restart nginx: %v", err),
+			At:       time.Now(),
+			Attempt:  attempt,
+			ErrorLog: sv.errorLog(),
+		})
+		sv.schedule(time.Now())
+		return
+	}
+	sv.emit(SupervisorEvent{Type: SupervisorEventRestarted, Message: "nginx restarted by supervisor", At: time.Now(), Attempt: attempt})
+}
+
+// State 返回守护进程当前状态
+func (sv *Supervisor) State() SupervisorState {
+	sv.mu.Lock()
+	defer sv.mu.Unlock()
+
+	state := SupervisorState{
+		State:       sv.state,
+		Restarts:    len(sv.recentRestarts(time.Now())),
+		MaxRestarts: sv.policy.MaxRestarts,
+		Events:      append([]SupervisorEvent{}, sv.events...),
+	}
+	if sv.state == SupervisorBackoff {
+		t := sv.nextRestart
+		state.NextRestartAt = &t
+	}
+	if !sv.lastCrash.IsZero() {
+		t := sv.lastCrash
+		state.LastCrashAt = &t
+	}
+	return state
+}
+
+// intentionalStop 判断nginx退出是否是预期的：通过管理器请求了停止，
+// 或PID文件已被删除（nginx正常退出时会删除PID文件，崩溃时不会）
+func (sv *Supervisor) intentionalStop() bool {
+	if sv.service.history().stopRequestedSince(sv.runningSince) {
+		return true
+	}
+	_, err := os.Stat(sv.service.PidFile)
+	return os.IsNotExist(err)
+}
+
+// schedule 按指数退避安排下一次重启，超过重启次数限制时放弃，调用方需持有锁
+func (sv *Supervisor) schedule(now time.Time) {
+	sv.restarts = sv.recentRestarts(now)
+	if sv.policy.MaxRestarts > 0 && len(sv.restarts) >= sv.policy.MaxRestarts {
+		sv.state = SupervisorCrashLoop
+		sv.emit(SupervisorEvent{
+			Type:    SupervisorEventCrashLoop,
+			Message: fmt.Sprintf("nginx crashed %d times within %s, giving up automatic restarts", len(sv.restarts), sv.policy.Window),
+			At:      now,
+		})
+		return
+	}
+
+	delay := sv.policy.BackoffInitial
+	for i := 0; i < len(sv.restarts) && delay < sv.policy.BackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > sv.policy.BackoffMax {
+		delay = sv.policy.BackoffMax
+	}
+	sv.state = SupervisorBackoff
+	sv.nextRestart = now.Add(delay)
+	logrus.Warnf("Supervisor will restart nginx in %s", delay)
+}
+
+// recentRestarts 返回窗口内的重启记录，调用方需持有锁
+func (sv *Supervisor) recentRestarts(now time.Time) []time.Time {
+	if sv.policy.Window <= 0 {
+		return sv.restarts
+	}
+	recent := []time.Time{}
+	for _, t := range sv.restarts {
+		if now.Sub(t) < sv.policy.Window {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+// errorLog 读取error.log末尾若干行
+func (sv *Supervisor) errorLog() []string {
+	if sv.policy.ErrorLogLines <= 0 {
+		return nil
+	}
+	lines, err := TailLines(filepath.Join(sv.service.LogPath, "error.log"), sv.policy.ErrorLogLines)
+	if err != nil {
+		logrus.Debug("Failed to read error log for supervisor: ", err)
+		return nil
+	}
+	return lines
+}
+
+// emit 记录事件并通知，调用方需持有锁
+func (sv *Supervisor) emit(event SupervisorEvent) {
+	logrus.Infof("Supervisor %s: %s", event.Type, event.Message)
+	sv.events = append(sv.events, event)
+	if len(sv.events) > maxSupervisorEvents {
+		sv.events = sv.events[len(sv.events)-maxSupervisorEvents:]
+	}
+	if sv.notify != nil {
+		sv.notify(event)
+	}
+}
@@ -0,0 +1,115 @@
+package nginx
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/host"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/mem"
+)
+
+// HostStats 主机资源使用情况
+type HostStats struct {
+	Hostname      string        `json:"hostname"`
+	OS            string        `json:"os"`
+	Uptime        uint64        `json:"uptime"`
+	CPUCount      int           `json:"cpu_count"`
+	CPUPercent    float64       `json:"cpu_percent"`
+	MemoryTotal   uint64        `json:"memory_total"`
+	MemoryUsed    uint64        `json:"memory_used"`
+	MemoryPercent float64       `json:"memory_percent"`
+	Disks         []DiskUsage   `json:"disks"`
+	Load          *load.AvgStat `json:"load,omitempty"`
+}
+
+// DiskUsage nginx相关目录所在磁盘的使用情况
+type DiskUsage struct {
+	Path        string  `json:"path"`
+	Total       uint64  `json:"total"`
+	Used        uint64  `json:"used"`
+	Free        uint64  `json:"free"`
+	UsedPercent float64 `json:"used_percent"`
+}
+
+// SystemInfo 主机和nginx进程的资源监控数据
+type SystemInfo struct {
+	Host         HostStats     `json:"host"`
+	Processes    []ProcessInfo `json:"processes"`
+	ProcessError string        `json:"process_error,omitempty"`
+	UpdatedAt    time.Time     `json:"updated_at"`
+}
+
+// GetSystemInfo 获取主机资源和nginx各进程的资源占用
+func (s *Service) GetSystemInfo() *SystemInfo {
+	info := &SystemInfo{
+		Host:      s.hostStats(),
+		Processes: []ProcessInfo{},
+		UpdatedAt: time.Now(),
+	}
+
+	procs, err := s.Processes()
+	if err != nil {
+		info.ProcessError = err.Error()
+	} else {
+		info.Processes = procs
+	}
+
+	return info
+}
+
+// hostStats 采集主机指标，单项失败时保留零值（如Windows不支持load）
+func (s *Service) hostStats() HostStats {
+	stats := HostStats{
+		OS:    runtime.GOOS,
+		Disks: []DiskUsage{},
+	}
+
+	if h, err := host.Info(); err == nil {
+		stats.Hostname = h.Hostname
+		stats.Uptime = h.Uptime
+	}
+	if count, err := cpu.Counts(true); err == nil {
+		stats.CPUCount = count
+	}
+	if percent, err := cpu.Percent(0, false); err == nil && len(percent) > 0 {
+		stats.CPUPercent = percent[0]
+	}
+	if vm, err := mem.VirtualMemory(); err == nil {
+		stats.MemoryTotal = vm.Total
+		stats.MemoryUsed = vm.Used
+		stats.MemoryPercent = vm.UsedPercent
+	}
+	if runtime.GOOS != "windows" {
+		if avg, err := load.Avg(); err == nil {
+			stats.Load = avg
+		}
+	}
+
+	// 同一磁盘只统计一次，以容量和剩余空间识别同一文件系统
+	seen := make(map[string]bool)
+	for _, path := range []string{filepath.Dir(s.ExecutablePath), filepath.Dir(s.ConfigPath), s.LogPath} {
+		usage, err := disk.Usage(path)
+		if err != nil {
+			continue
+		}
+		key := fmt.Sprintf("%d-%d", usage.Total, usage.Free)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		stats.Disks = append(stats.Disks, DiskUsage{
+			Path:        usage.Path,
+			Total:       usage.Total,
+			Used:        usage.Used,
+			Free:        usage.Free,
+			UsedPercent: usage.UsedPercent,
+		})
+	}
+
+	return stats
+}
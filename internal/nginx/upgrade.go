@@ -0,0 +1,383 @@
+package nginx
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/v3/process"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	UpgradeStepTest    = "test"
+	UpgradeStepInstall = "install"
+	UpgradeStepSpawn   = "spawn"
+	UpgradeStepVerify  = "verify"
+	UpgradeStepRetire  = "retire_workers"
+	UpgradeStepQuit    = "quit_old_master"
+	UpgradeStepRevert  = "rollback"
+
+	UpgradeRunning = "running"
+	UpgradeDone    = "done"
+	UpgradeFailed  = "failed"
+
+	upgradeSpawnTimeout  = 10 * time.Second
+	upgradeRetireTimeout = 30 * time.Second
+)
+
+// UpgradeEvent 二进制升级过程中的一步进展
+type UpgradeEvent struct {
+	Step    string    `json:"step"`
+	Status  string    `json:"status"`
+	Message string    `json:"message"`
+	At      time.Time `json:"at"`
+}
+
+// AllowUpgradesFrom 设置升级时可使用的可执行文件所在目录，为空时禁用升级
+func (s *Service) AllowUpgradesFrom(dir string) {
+	s.upgradeDir = dir
+}
+
+// upgradeExecutable 检查升级用的可执行文件：必须是upgradeDir中（解析符号链接后）的普通可执行文件，
+// checksum不为空时还必须与文件的SHA-256一致；通过后才会执行该文件
+func (s *Service) upgradeExecutable(executable, checksum string) (string, error) {
+	if s.upgradeDir == "" {
+		return "", fmt.Errorf("binary upgrade is disabled; set upgrade.dir to the directory holding new nginx binaries")
+	}
+	dir, err := filepath.EvalSymlinks(s.upgradeDir)
+	if err != nil {
+		return "", fmt.Errorf("upgrade directory %s: %w", s.upgradeDir, err)
+	}
+	if !filepath.IsAbs(executable) {
+		executable = filepath.Join(dir, executable)
+	}
+	path, err := filepath.EvalSymlinks(executable)
+	if err != nil {
+		return "", fmt.Errorf("executable not found: %s", executable)
+	}
+	if rel, err := filepath.Rel(dir, path); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("executable %s is outside the upgrade directory %s", executable, s.upgradeDir)
+	}
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", fmt.Errorf("executable not found: %s", executable)
+	}
+	if info.Mode().Perm()&0111 == 0 {
+		return "", fmt.Errorf("%s is not executable", executable)
+	}
+
+	if checksum != "" {
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return "", err
+		}
+		if !strings.EqualFold(sum, checksum) {
+			return "", fmt.Errorf("sha256 of %s is %s, expected %s", executable, sum, checksum)
+		}
+	}
+	return path, nil
+}
+
+func fileSHA256(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Upgrade 平滑升级nginx二进制
+func (s *Service) Upgrade(executable, checksum string, progress func(UpgradeEvent)) error {
+	return s.UpgradeAs(ActorManager, executable, checksum, progress)
+}
+
+// UpgradeAs 平滑升级nginx二进制并记录操作者：用新可执行文件替换当前文件，
+// 向旧master发送USR2启动新master，验证健康后WINCH退役旧worker，最后QUIT旧master；
+// 任一步骤失败时恢复旧文件并让旧master继续服务。executable必须位于升级目录中，checksum为可选的SHA-256
+func (s *Service) UpgradeAs(actor, executable, checksum string, progress func(UpgradeEvent)) error {
+	if !s.upgradeMu.TryLock() {
+		return fmt.Errorf("another upgrade is in progress")
+	}
+	defer s.upgradeMu.Unlock()
+
+	if progress == nil {
+		progress = func(UpgradeEvent) {}
+	}
+	report := func(step, status, format string, args ...interface{}) {
+		event := UpgradeEvent{Step: step, Status: status, Message: fmt.Sprintf(format, args...), At: time.Now()}
+		logrus.Infof("Upgrade %s %s: %s", step, status, event.Message)
+		progress(event)
+	}
+	fail := func(step string, err error) error {
+		report(step, UpgradeFailed, "%v", err)
+		return fmt.Errorf("upgrade failed at %s: %w", step, err)
+	}
+
+	if !signalsSupported {
+		return fail(UpgradeStepTest, fmt.Errorf("binary upgrade requires POSIX signals and is not supported on this platform"))
+	}
+	oldPID := s.getPIDFromFile()
+	if oldPID <= 0 || !s.isPIDRunning(oldPID) {
+		return fail(UpgradeStepTest, fmt.Errorf("nginx is not running"))
+	}
+
+	// 1. 用新二进制测试当前配置，执行前先确认是升级目录中允许的文件
+	executable, err := s.upgradeExecutable(executable, checksum)
+	if err != nil {
+		return fail(UpgradeStepTest, err)
+	}
+	report(UpgradeStepTest, UpgradeRunning, "testing configuration with %s", executable)
+	cmd := exec.Command(executable, "-t", "-c", s.ConfigPath)
+	cmd.Dir = filepath.Dir(s.ExecutablePath)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fail(UpgradeStepTest, fmt.Errorf("config test failed: %s", strings.TrimSpace(string(output))))
+	}
+	report(UpgradeStepTest, UpgradeDone, "configuration test passed")
+
+	// 2. 安装新二进制：USR2会按原路径重新执行，所以新文件必须放到原路径上。
+	// 运行中的可执行文件不能直接覆盖，先重命名旧文件再复制新文件
+	backup := s.ExecutablePath + ".old"
+	installed := false
+	if filepath.Clean(executable) != filepath.Clean(s.ExecutablePath) {
+		report(UpgradeStepInstall, UpgradeRunning, "installing %s to %s", executable, s.ExecutablePath)
+		if err := installExecutable(executable, s.ExecutablePath, backup); err != nil {
+			return fail(UpgradeStepInstall, err)
+		}
+		installed = true
+		report(UpgradeStepInstall, UpgradeDone, "previous executable kept at %s", backup)
+	}
+
+	rollback := func(step string, err error, newPID int, retired bool) error {
+		report(UpgradeStepRevert, UpgradeRunning, "rolling back to master %d", oldPID)
+		if retired {
+			// 旧master的worker已退役，HUP让其按配置重新启动worker
+			if err := sendSignal(oldPID, "HUP"); err != nil {
+				logrus.Error("Failed to restart old workers: ", err)
+			}
+		}
+		if newPID > 0 {
+			if err := sendSignal(newPID, "QUIT"); err != nil {
+				logrus.Error("Failed to stop new master: ", err)
+			}
+			waitExit(newPID, upgradeSpawnTimeout)
+		}
+		if installed {
+			if err := os.Rename(backup, s.ExecutablePath); err != nil {
+				logrus.Error("Failed to restore previous executable: ", err)
+			}
+		}
+		// 新master退出后旧master会把nginx.pid.oldbin恢复为nginx.pid；如未恢复则手动写回
+		if s.getPIDFromFile() != oldPID {
+			_ = os.WriteFile(s.PidFile, []byte(fmt.Sprintf("%d\n", oldPID)), 0644)
+		}
+		report(UpgradeStepRevert, UpgradeDone, "old master %d is serving", oldPID)
+		return fail(step, err)
+	}
+
+	// 3. USR2启动新master，等待新PID文件出现
+	errorLog := NewLogTailer(filepath.Join(s.LogPath, "error.log"))
+	_ = errorLog.ReadNew(func(string) {})
+
+	report(UpgradeStepSpawn, UpgradeRunning, "sending USR2 to master %d", oldPID)
+	if err := sendSignal(oldPID, "USR2"); err != nil {
+		return rollback(UpgradeStepSpawn, err, 0, false)
+	}
+	newPID, err := s.waitNewMaster(oldPID, errorLog)
+	if err != nil {
+		return rollback(UpgradeStepSpawn, err, newPID, false)
+	}
+	report(UpgradeStepSpawn, UpgradeDone, "new master %d started", newPID)
+
+	// 4. 验证新master及其worker健康
+	report(UpgradeStepVerify, UpgradeRunning, "checking new master %d", newPID)
+	if err := s.verifyMaster(newPID, errorLog); err != nil {
+		return rollback(UpgradeStepVerify, err, newPID, false)
+	}
+	report(UpgradeStepVerify, UpgradeDone, "new master %d is healthy", newPID)
+
+	// 5. WINCH让旧worker处理完现有连接后退出
+	report(UpgradeStepRetire, UpgradeRunning, "sending WINCH to old master %d", oldPID)
+	if err := sendSignal(oldPID, "WINCH"); err != nil {
+		return rollback(UpgradeStepRetire, err, newPID, false)
+	}
+	remaining := waitWorkersExit(oldPID, newPID, upgradeRetireTimeout)
+	if err := s.verifyMaster(newPID, errorLog); err != nil {
+		return rollback(UpgradeStepRetire, err, newPID, true)
+	}
+	if remaining > 0 {
+		report(UpgradeStepRetire, UpgradeDone, "%d old workers still draining connections", remaining)
+	} else {
+		report(UpgradeStepRetire, UpgradeDone, "old workers exited")
+	}
+
+	// 6. QUIT旧master完成升级
+	report(UpgradeStepQuit, UpgradeRunning, "sending QUIT to old master %d", oldPID)
+	if err := sendSignal(oldPID, "QUIT"); err != nil {
+		return fail(UpgradeStepQuit, err)
+	}
+	if !waitExit(oldPID, upgradeRetireTimeout) {
+		report(UpgradeStepQuit, UpgradeDone, "old master %d is still shutting down", oldPID)
+	} else {
+		report(UpgradeStepQuit, UpgradeDone, "upgrade complete, master %d is serving", newPID)
+	}
+
+	s.history().recordStart(actor, nil)
+	return nil
+}
+
+// waitNewMaster 等待新master写入PID文件
+func (s *Service) waitNewMaster(oldPID int, errorLog *LogTailer) (int, error) {
+	deadline := time.Now().Add(upgradeSpawnTimeout)
+	for time.Now().Before(deadline) {
+		if err := checkEmerg(errorLog); err != nil {
+			return 0, err
+		}
+		if pid := s.getPIDFromFile(); pid > 0 && pid != oldPID && s.isPIDRunning(pid) {
+			return pid, nil
+		}
+		time.Sleep(startPollInterval)
+	}
+	return 0, fmt.Errorf("new master did not start within %s", upgradeSpawnTimeout)
+}
+
+// verifyMaster 检查master存活、已有worker、监听地址可连接且没有新的[emerg]日志
+func (s *Service) verifyMaster(pid int, errorLog *LogTailer) error {
+	if err := checkEmerg(errorLog); err != nil {
+		return err
+	}
+	if !s.isPIDRunning(pid) {
+		return fmt.Errorf("master %d exited", pid)
+	}
+
+	master, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return fmt.Errorf("failed to inspect master %d: %w", pid, err)
+	}
+	deadline := time.Now().Add(upgradeSpawnTimeout)
+	for {
+		if children, err := master.Children(); err == nil && len(children) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("master %d has no worker processes", pid)
+		}
+		time.Sleep(startPollInterval)
+	}
+
+	addrs, _ := ListenAddresses(s.ConfigPath)
+	if failed := unreachable(addrs); len(failed) > 0 {
+		return fmt.Errorf("%s not accepting connections", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// checkEmerg 检查error.log新增内容中是否有[emerg]
+func checkEmerg(errorLog *LogTailer) error {
+	var emerg []string
+	_ = errorLog.ReadNew(func(line string) {
+		if strings.Contains(line, "[emerg]") {
+			emerg = append(emerg, line)
+		}
+	})
+	if len(emerg) > 0 {
+		return fmt.Errorf("%s", strings.Join(emerg, "; "))
+	}
+	return nil
+}
+
+// waitWorkersExit 等待旧master的worker退出，返回超时后仍在运行的worker数；
+// 新master由旧master fork产生，也是其子进程，需要排除
+func waitWorkersExit(pid, newMaster int, timeout time.Duration) int {
+	master, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return 0
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		children, err := master.Children()
+		if err != nil {
+			return 0
+		}
+		workers := 0
+		for _, child := range children {
+			if int(child.Pid) == newMaster {
+				continue
+			}
+			// 已退出但尚未被回收的进程不再计入
+			if status, err := child.Status(); err == nil && len(status) > 0 && status[0] == process.Zombie {
+				continue
+			}
+			workers++
+		}
+		if workers == 0 {
+			return 0
+		}
+		if time.Now().After(deadline) {
+			return workers
+		}
+		time.Sleep(startPollInterval)
+	}
+}
+
+// waitExit 等待进程退出
+func waitExit(pid int, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if exists, err := process.PidExists(int32(pid)); err == nil && !exists {
+			return true
+		}
+		time.Sleep(startPollInterval)
+	}
+	return false
+}
+
+// installExecutable 将旧文件重命名为backup，再把新文件复制到原路径
+func installExecutable(src, dst, backup string) error {
+	info, err := os.Stat(dst)
+	if err != nil {
+		return fmt.Errorf("failed to stat current executable: %w", err)
+	}
+	if err := os.Rename(dst, backup); err != nil {
+		return fmt.Errorf("failed to back up current executable: %w", err)
+	}
+
+	if err := copyExecutable(src, dst, info.Mode()); err != nil {
+		os.Remove(dst)
+		if restoreErr := os.Rename(backup, dst); restoreErr != nil {
+			logrus.Error("Failed to restore previous executable: ", restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+func copyExecutable(src, dst string, mode os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open new executable: %w", err)
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return fmt.Errorf("failed to install new executable: %w", err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to install new executable: %w", err)
+	}
+	return out.Close()
+}
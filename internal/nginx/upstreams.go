@@ -0,0 +1,412 @@
+package nginx
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"nginx_manager/internal/nginxconf"
+)
+
+// server行尾注释中的状态标记：恢复排空时据此去掉排空时加上的backup，
+// 健康检查只恢复自己标记down的server
+const (
+	drainingMarker   = "nginx-manager: draining"
+	healthDownMarker = "nginx-manager: health check failed"
+)
+
+// upstream中server的状态操作
+const (
+	ServerUp    = "up"    // 去掉down，结束排空
+	ServerDown  = "down"  // 标记down，不再接收请求
+	ServerDrain = "drain" // 改为backup，只在其他server都不可用时接收请求
+
+	serverFailed    = "failed"    // 健康检查失败，标记down
+	serverRecovered = "recovered" // 健康检查恢复，去掉健康检查标记的down
+)
+
+// ErrUpstreamNotFound upstream或其中的server不存在
+var ErrUpstreamNotFound = errors.New("upstream not found")
+
+// noBackupMethods 不支持backup参数的负载均衡方式
+var noBackupMethods = map[string]bool{"hash": true, "ip_hash": true, "random": true}
+
+// Upstream upstream块
+type Upstream struct {
+	Name    string           `json:"name"`
+	Context string           `json:"context"` // http或stream
+	File    string           `json:"file"`
+	Line    int              `json:"line"`
+	Method  string           `json:"method"` // 负载均衡方式，如round_robin、least_conn、ip_hash
+	Servers []UpstreamServer `json:"servers"`
+}
+
+// UpstreamServer upstream中的一条server指令
+type UpstreamServer struct {
+	Address     string   `json:"address"`
+	Weight      int      `json:"weight,omitempty"`
+	MaxFails    *int     `json:"max_fails,omitempty"`
+	FailTimeout string   `json:"fail_timeout,omitempty"`
+	Backup      bool     `json:"backup"`
+	Down        bool     `json:"down"`
+	Draining    bool     `json:"draining"`
+	HealthDown  bool     `json:"health_down"`      // 被健康检查自动标记down
+	Params      []string `json:"params,omitempty"` // 其他参数，如max_conns=100、resolve
+	Line        int      `json:"line,omitempty"`
+
+	Health *ServerHealth `json:"health,omitempty"` // 启用健康检查时的探测结果
+}
+
+// upstreamRef upstream在配置树中的位置
+type upstreamRef struct {
+	context string
+	block   *nginxconf.Directive
+}
+
+// ListUpstreams 列出http和stream中的所有upstream
+func (cm *ConfigManager) ListUpstreams() ([]Upstream, error) {
+	tree, err := nginxconf.Load(cm.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+
+	upstreams := []Upstream{}
+	for _, ref := range findUpstreams(tree) {
+		upstreams = append(upstreams, ref.upstream(tree))
+	}
+	return upstreams, nil
+}
+
+// GetUpstream 按名称获取upstream，context为空时先找http再找stream
+func (cm *ConfigManager) GetUpstream(name, context string) (*Upstream, error) {
+	tree, err := nginxconf.Load(cm.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := findUpstream(tree, name, context)
+	if err != nil {
+		return nil, err
+	}
+	upstream := ref.upstream(tree)
+	return &upstream, nil
+}
+
+// AddUpstreamServer 在upstream末尾添加server
+func (cm *ConfigManager) AddUpstreamServer(name, context string, server UpstreamServer, test func() error) (*Upstream, error) {
+	if strings.TrimSpace(server.Address) == "" || strings.ContainsAny(server.Address, " \t;{}") {
+		return nil, fmt.Errorf("invalid server address %q", server.Address)
+	}
+
+	return cm.editUpstream(name, context, test, func(ref *upstreamRef) error {
+		if ref.server(server.Address) != nil {
+			return fmt.Errorf("server %s already exists in upstream %s", server.Address, name)
+		}
+		if server.Backup && noBackupMethods[ref.method()] {
+			return fmt.Errorf("upstream %s uses %s, which does not support backup servers", name, ref.method())
+		}
+		node := nginxconf.New("server", server.args()...)
+		ref.block.InsertAfter(lastChild(ref.block, "server"), node)
+		return nil
+	})
+}
+
+// RemoveUpstreamServer 从upstream删除server
+func (cm *ConfigManager) RemoveUpstreamServer(name, context, address string, test func() error) (*Upstream, error) {
+	return cm.editUpstream(name, context, test, func(ref *upstreamRef) error {
+		node := ref.server(address)
+		if node == nil {
+			return fmt.Errorf("%w: server %s in %s", ErrUpstreamNotFound, address, name)
+		}
+		if len(ref.block.Find("server")) == 1 {
+			return fmt.Errorf("cannot remove the only server of upstream %s", name)
+		}
+		ref.block.Remove(node)
+		return nil
+	})
+}
+
+// SetUpstreamServerState 标记server为up、down或drain。force为false时
+// 拒绝让upstream失去最后一个可用的server
+func (cm *ConfigManager) SetUpstreamServerState(name, context, address, state string, force bool, test func() error) (*Upstream, error) {
+	switch state {
+	case ServerUp, ServerDown, ServerDrain:
+	default:
+		return nil, fmt.Errorf("invalid server state %q", state)
+	}
+	return cm.setServerState(name, context, address, state, force, test)
+}
+
+func (cm *ConfigManager) setServerState(name, context, address, state string, force bool, test func() error) (*Upstream, error) {
+	return cm.editUpstream(name, context, test, func(ref *upstreamRef) error {
+		node := ref.server(address)
+		if node == nil {
+			return fmt.Errorf("%w: server %s in %s", ErrUpstreamNotFound, address, name)
+		}
+		current := parseUpstreamServer(ref.block, node)
+
+		switch state {
+		case ServerUp:
+			args := withFlag(node.Args, "down", false)
+			if current.Draining {
+				args = withFlag(args, "backup", false)
+				removeMarker(ref.block, node, drainingMarker)
+			}
+			removeMarker(ref.block, node, healthDownMarker)
+			node.SetArgs(args...)
+		case ServerDown:
+			if !current.Down && !force && ref.lastAvailable(node) {
+				return fmt.Errorf("%s is the last available server in upstream %s", address, name)
+			}
+			// 手动标记后健康检查不再自动恢复
+			removeMarker(ref.block, node, healthDownMarker)
+			node.SetArgs(withFlag(node.Args, "down", true)...)
+		case ServerDrain:
+			if current.Draining {
+				return nil
+			}
+			if current.Backup {
+				return fmt.Errorf("%s is already a backup server", address)
+			}
+			if noBackupMethods[ref.method()] {
+				return fmt.Errorf("upstream %s uses %s, which does not support draining; mark the server down instead", name, ref.method())
+			}
+			if !force && ref.lastAvailable(node) {
+				return fmt.Errorf("%s is the last available server in upstream %s", address, name)
+			}
+			node.SetArgs(withFlag(node.Args, "backup", true)...)
+			addMarker(ref.block, node, drainingMarker)
+		case serverFailed:
+			if current.Down {
+				return nil
+			}
+			if !force && ref.lastAvailable(node) {
+				return fmt.Errorf("%s is the last available server in upstream %s", address, name)
+			}
+			node.SetArgs(withFlag(node.Args, "down", true)...)
+			addMarker(ref.block, node, healthDownMarker)
+		case serverRecovered:
+			if !current.HealthDown {
+				return nil
+			}
+			node.SetArgs(withFlag(node.Args, "down", false)...)
+			removeMarker(ref.block, node, healthDownMarker)
+		}
+		return nil
+	})
+}
+
+// editUpstream 在配置树中修改upstream并写入、验证，返回修改后的upstream
+func (cm *ConfigManager) editUpstream(name, context string, test func() error, edit func(ref *upstreamRef) error) (*Upstream, error) {
+	cm.editMu.Lock()
+	defer cm.editMu.Unlock()
+
+	tree, err := nginxconf.Load(cm.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	ref, err := findUpstream(tree, name, context)
+	if err != nil {
+		return nil, err
+	}
+	if err := edit(ref); err != nil {
+		return nil, err
+	}
+	if err := cm.commitTree(tree, nil, test); err != nil {
+		return nil, err
+	}
+
+	reloaded, err := nginxconf.Load(cm.ConfigPath)
+	if err != nil {
+		return nil, err
+	}
+	if ref, err = findUpstream(reloaded, name, ref.context); err != nil {
+		return nil, err
+	}
+	upstream := ref.upstream(reloaded)
+	return &upstream, nil
+}
+
+// findUpstreams 找出http和stream上下文中的upstream块
+func findUpstreams(tree *nginxconf.Tree) []upstreamRef {
+	var refs []upstreamRef
+	tree.Walk(func(node *nginxconf.Directive, parents []*nginxconf.Directive) bool {
+		if node.Name == "upstream" && node.Block && len(node.Args) > 0 && len(parents) == 1 {
+			if context := parents[0].Name; context == "http" || context == "stream" {
+				refs = append(refs, upstreamRef{context: context, block: node})
+			}
+			return false
+		}
+		return true
+	})
+	return refs
+}
+
+func findUpstream(tree *nginxconf.Tree, name, context string) (*upstreamRef, error) {
+	refs := findUpstreams(tree)
+	for _, want := range []string{"http", "stream"} {
+		if context != "" && context != want {
+			continue
+		}
+		for i := range refs {
+			if refs[i].context == want && refs[i].block.Args[0] == name {
+				return &refs[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUpstreamNotFound, name)
+}
+
+func (r *upstreamRef) upstream(tree *nginxconf.Tree) Upstream {
+	upstream := Upstream{
+		Name:    r.block.Args[0],
+		Context: r.context,
+		File:    r.block.File,
+		Line:    r.block.Line,
+		Method:  r.method(),
+		Servers: []UpstreamServer{},
+	}
+	if rel, err := filepath.Rel(tree.Prefix, r.block.File); err == nil && !strings.HasPrefix(rel, "..") {
+		upstream.File = rel
+	}
+	for _, node := range r.block.Find("server") {
+		if !node.Block && len(node.Args) > 0 {
+			upstream.Servers = append(upstream.Servers, parseUpstreamServer(r.block, node))
+		}
+	}
+	return upstream
+}
+
+// method 负载均衡方式，没有指定时为round_robin
+func (r *upstreamRef) method() string {
+	for _, child := range r.block.Children {
+		switch child.Name {
+		case "least_conn", "ip_hash", "hash", "random", "least_time", "sticky":
+			return child.Name
+		}
+	}
+	return "round_robin"
+}
+
+func (r *upstreamRef) server(address string) *nginxconf.Directive {
+	for _, node := range r.block.Find("server") {
+		if !node.Block && len(node.Args) > 0 && node.Args[0] == address {
+			return node
+		}
+	}
+	return nil
+}
+
+// lastAvailable 去掉node后是否没有其他未down的主server
+func (r *upstreamRef) lastAvailable(node *nginxconf.Directive) bool {
+	for _, other := range r.block.Find("server") {
+		if other == node || other.Block || len(other.Args) == 0 {
+			continue
+		}
+		s := parseUpstreamServer(r.block, other)
+		if !s.Down && !s.Backup {
+			return false
+		}
+	}
+	return true
+}
+
+func parseUpstreamServer(block, node *nginxconf.Directive) UpstreamServer {
+	server := UpstreamServer{Address: node.Args[0], Line: node.Line}
+	for _, arg := range node.Args[1:] {
+		key, value, _ := strings.Cut(arg, "=")
+		switch key {
+		case "weight":
+			server.Weight, _ = strconv.Atoi(value)
+		case "max_fails":
+			if n, err := strconv.Atoi(value); err == nil {
+				server.MaxFails = &n
+			}
+		case "fail_timeout":
+			server.FailTimeout = value
+		case "backup":
+			server.Backup = true
+		case "down":
+			server.Down = true
+		default:
+			server.Params = append(server.Params, arg)
+		}
+	}
+	server.Draining = hasMarker(block, node, drainingMarker)
+	server.HealthDown = server.Down && hasMarker(block, node, healthDownMarker)
+	return server
+}
+
+// args 生成server指令的参数
+func (s *UpstreamServer) args() []string {
+	args := []string{s.Address}
+	if s.Weight > 0 {
+		args = append(args, fmt.Sprintf("weight=%d", s.Weight))
+	}
+	if s.MaxFails != nil {
+		args = append(args, fmt.Sprintf("max_fails=%d", *s.MaxFails))
+	}
+	if s.FailTimeout != "" {
+		args = append(args, "fail_timeout="+s.FailTimeout)
+	}
+	args = append(args, s.Params...)
+	if s.Backup {
+		args = append(args, "backup")
+	}
+	if s.Down {
+		args = append(args, "down")
+	}
+	return args
+}
+
+// withFlag 添加或去掉down、backup等无值参数，其他参数保持原有顺序
+func withFlag(args []string, flag string, on bool) []string {
+	result := []string{}
+	found := false
+	for _, arg := range args {
+		if arg == flag {
+			found = true
+			if !on {
+				continue
+			}
+		}
+		result = append(result, arg)
+	}
+	if on && !found {
+		result = append(result, flag)
+	}
+	return result
+}
+
+func hasMarker(block, node *nginxconf.Directive, marker string) bool {
+	comment := block.TrailingComment(node)
+	return comment != nil && strings.Contains(comment.Comment, marker)
+}
+
+// addMarker 在行尾注释中追加标记，保留用户原有的注释
+func addMarker(block, node *nginxconf.Directive, marker string) {
+	if hasMarker(block, node, marker) {
+		return
+	}
+	text := " " + marker
+	if comment := block.TrailingComment(node); comment != nil {
+		text = comment.Comment + " #" + text
+	}
+	block.SetTrailingComment(node, text)
+}
+
+// removeMarker 去掉行尾注释中的标记，注释因此为空时删除注释
+func removeMarker(block, node *nginxconf.Directive, marker string) {
+	comment := block.TrailingComment(node)
+	if comment == nil || !strings.Contains(comment.Comment, marker) {
+		return
+	}
+	text := strings.Replace(comment.Comment, " # "+marker, "", 1)
+	text = strings.Replace(text, " "+marker, "", 1)
+	text = strings.TrimPrefix(text, " #")
+	if strings.TrimSpace(text) == "" {
+		text = ""
+	}
+	block.SetTrailingComment(node, text)
+}
@@ -0,0 +1,410 @@
+package nginxconf
+
+import (
+	"sort"
+	"strings"
+)
+
+// New 创建简单指令
+func New(name string, args ...string) *Directive {
+	return &Directive{Name: name, Args: args}
+}
+
+// NewBlock 创建块指令
+func NewBlock(name string, args []string, children ...*Directive) *Directive {
+	return &Directive{Name: name, Args: args, Block: true, Children: children}
+}
+
+// NewComment 创建注释，text不含#
+func NewComment(text string) *Directive {
+	return &Directive{Name: "#", Comment: text}
+}
+
+// SetArgs 修改参数，参数不变时保留原始文本
+func (d *Directive) SetArgs(args ...string) {
+	if equalArgs(d.Args, args) {
+		return
+	}
+	d.Args = args
+	d.dirty = true
+}
+
+// Find 返回名为name的直接子指令
+func (d *Directive) Find(name string) []*Directive {
+	var found []*Directive
+	for _, child := range d.Children {
+		if child.Name == name {
+			found = append(found, child)
+		}
+	}
+	return found
+}
+
+// First 返回第一个名为name的直接子指令
+func (d *Directive) First(name string) *Directive {
+	for _, child := range d.Children {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// Value 返回第一个名为name的子指令的参数，以空格连接
+func (d *Directive) Value(name string) string {
+	if child := d.First(name); child != nil {
+		return strings.Join(child.Args, " ")
+	}
+	return ""
+}
+
+// Index 返回子节点的位置，不存在时返回-1
+func (d *Directive) Index(child *Directive) int {
+	for i, c := range d.Children {
+		if c == child {
+			return i
+		}
+	}
+	return -1
+}
+
+// Insert 在位置i插入子节点
+func (d *Directive) Insert(i int, nodes ...*Directive) {
+	if i < 0 || i > len(d.Children) {
+		i = len(d.Children)
+	}
+	children := make([]*Directive, 0, len(d.Children)+len(nodes))
+	children = append(children, d.Children[:i]...)
+	children = append(children, nodes...)
+	d.Children = append(children, d.Children[i:]...)
+}
+
+// Append 在块末尾添加子节点
+func (d *Directive) Append(nodes ...*Directive) {
+	d.Insert(len(d.Children), nodes...)
+}
+
+// InsertAfter 在ref之后（包括ref同一行的行尾注释）插入子节点，ref不存在时添加到末尾
+func (d *Directive) InsertAfter(ref *Directive, nodes ...*Directive) {
+	i := d.Index(ref)
+	if i < 0 {
+		d.Append(nodes...)
+		return
+	}
+	d.Insert(d.lineEnd(i)+1, nodes...)
+}
+
+// InsertBefore 在ref之前插入子节点，ref上方紧挨着的注释行仍留在ref之前；ref不存在时添加到末尾
+func (d *Directive) InsertBefore(ref *Directive, nodes ...*Directive) {
+	i := d.Index(ref)
+	if i < 0 {
+		d.Append(nodes...)
+		return
+	}
+	d.Insert(d.lineStart(i), nodes...)
+}
+
+// Remove 删除子节点，同时删除它的行尾注释
+func (d *Directive) Remove(child *Directive) bool {
+	i := d.Index(child)
+	if i < 0 {
+		return false
+	}
+	end := d.lineEnd(i)
+	d.Children = append(d.Children[:i], d.Children[end+1:]...)
+	return true
+}
+
+// RemoveWithComments 删除子节点，同时删除紧挨在它上方的注释行和行尾注释
+func (d *Directive) RemoveWithComments(child *Directive) bool {
+	i := d.Index(child)
+	if i < 0 {
+		return false
+	}
+	d.Children = append(d.Children[:d.lineStart(i)], d.Children[d.lineEnd(i)+1:]...)
+	return true
+}
+
+// Replace 用node替换子节点old，解析得到的node沿用old的前导空白
+func (d *Directive) Replace(old, node *Directive) bool {
+	i := d.Index(old)
+	if i < 0 {
+		return false
+	}
+	if node.parsed {
+		node.pre = old.pre
+		if !old.parsed {
+			node.pre = "\n"
+		}
+	}
+	d.Children[i] = node
+	return true
+}
+
+// ReplaceNodes 用nodes替换从old[0]开始的连续子节点old
+func (d *Directive) ReplaceNodes(old []*Directive, nodes ...*Directive) bool {
+	if len(old) == 0 {
+		return false
+	}
+	i := d.Index(old[0])
+	if i < 0 || i+len(old) > len(d.Children) {
+		return false
+	}
+	if len(nodes) > 0 && nodes[0].parsed {
+		nodes[0].pre = old[0].pre
+	}
+	rest := append([]*Directive{}, d.Children[i+len(old):]...)
+	d.Children = append(append(d.Children[:i], nodes...), rest...)
+	return true
+}
+
+// Reorder 把子节点nodes按给定顺序放回它们原来占据的位置。每个节点连同紧挨在上方的
+// 注释行和行尾注释一起移动，原位置的前导空白保持不变
+func (d *Directive) Reorder(nodes []*Directive) bool {
+	type group struct{ start, end int }
+	groups := make(map[*Directive]group, len(nodes))
+	var slots []group
+	for _, node := range nodes {
+		i := d.Index(node)
+		if i < 0 {
+			return false
+		}
+		if _, ok := groups[node]; ok {
+			return false
+		}
+		g := group{start: d.lineStart(i), end: d.lineEnd(i)}
+		groups[node] = g
+		slots = append(slots, g)
+	}
+	sort.Slice(slots, func(i, j int) bool { return slots[i].start < slots[j].start })
+	pres := make([]string, len(slots))
+	for k, slot := range slots {
+		pres[k] = d.Children[slot.start].pre
+	}
+
+	children := make([]*Directive, 0, len(d.Children))
+	for i, k := 0, 0; i < len(d.Children); i++ {
+		if k >= len(slots) || i != slots[k].start {
+			children = append(children, d.Children[i])
+			continue
+		}
+		g := groups[nodes[k]]
+		children = append(children, d.Children[g.start:g.end+1]...)
+		if first := d.Children[g.start]; first.parsed && d.Children[slots[k].start].parsed {
+			first.pre = pres[k]
+		}
+		i = slots[k].end
+		k++
+	}
+	d.Children = children
+	return true
+}
+
+// CommentOut 把解析得到的节点逐行注释掉，每行注释以prefix开头，
+// 返回的注释节点可用Uncomment原样还原
+func CommentOut(node *Directive, prefix string) []*Directive {
+	indent := nodeIndent(node, "")
+	lines := strings.Split(node.Text(indent), "\n")
+
+	comments := make([]*Directive, len(lines))
+	for i, line := range lines {
+		text := prefix + strings.TrimPrefix(line, indent)
+		if strings.TrimSpace(line) == "" {
+			// 空行不留行尾空白
+			text = strings.TrimRight(prefix, " \t")
+		}
+		comments[i] = &Directive{
+			Name:    "#",
+			Comment: text,
+			File:    node.File,
+			Line:    node.Line + i,
+			parsed:  true,
+			pre:     "\n" + indent,
+			raw:     "#" + text,
+		}
+	}
+	comments[0].pre = node.pre
+	if !node.parsed {
+		comments[0].pre = "\n" + indent
+	}
+	return comments
+}
+
+// IsCommentedOut 是否为CommentOut生成的注释行
+func IsCommentedOut(node *Directive, prefix string) bool {
+	return node.IsComment() && (strings.HasPrefix(node.Comment, prefix) || node.Comment == strings.TrimRight(prefix, " \t"))
+}
+
+// Uncomment 把CommentOut生成的连续注释还原为指令；注释不是以prefix开头或内容不是合法配置时返回错误
+func Uncomment(comments []*Directive, prefix string) ([]*Directive, error) {
+	if len(comments) == 0 {
+		return nil, nil
+	}
+
+	var b strings.Builder
+	for i, comment := range comments {
+		if !IsCommentedOut(comment, prefix) {
+			return nil, &SyntaxError{File: comment.File, Line: comment.Line, Message: "not a commented-out directive"}
+		}
+		blank := comment.Comment == strings.TrimRight(prefix, " \t")
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		if i > 0 && !blank {
+			b.WriteString(nodeIndent(comment, ""))
+		}
+		if !blank {
+			b.WriteString(strings.TrimPrefix(comment.Comment, prefix))
+		}
+	}
+
+	first := comments[0]
+	doc, err := Parse(first.File, b.String())
+	if err != nil {
+		return nil, err
+	}
+	doc.Walk(func(node *Directive, parents []*Directive) bool {
+		node.Line += first.Line - 1
+		return true
+	})
+	if len(doc.Children) > 0 {
+		doc.Children[0].pre = first.pre
+	}
+	return doc.Children, nil
+}
+
+// TrailingComment 返回子节点child同一行的行尾注释，没有时返回nil
+func (d *Directive) TrailingComment(child *Directive) *Directive {
+	i := d.Index(child)
+	if i < 0 || d.lineEnd(i) == i {
+		return nil
+	}
+	return d.Children[i+1]
+}
+
+// SetTrailingComment 设置子节点child的行尾注释，text为空时删除
+func (d *Directive) SetTrailingComment(child *Directive, text string) {
+	if comment := d.TrailingComment(child); comment != nil {
+		if text == "" {
+			d.Children = append(d.Children[:d.Index(comment)], d.Children[d.Index(comment)+1:]...)
+			return
+		}
+		comment.Comment = text
+		comment.raw = "#" + text
+		return
+	}
+	if text == "" || d.Index(child) < 0 {
+		return
+	}
+	d.Insert(d.Index(child)+1, &Directive{
+		Name:    "#",
+		Comment: text,
+		File:    child.File,
+		Line:    child.Line,
+		parsed:  true,
+		pre:     " ",
+		raw:     "#" + text,
+	})
+}
+
+// Set 将名为name的简单指令设置为values，每个元素对应一条指令：
+// 已有的指令按顺序原地修改，多余的删除，缺少的添加在同名指令之后，
+// 没有同名指令时添加在第一个块指令之前
+func (d *Directive) Set(name string, values ...[]string) {
+	var existing []*Directive
+	for _, child := range d.Children {
+		if child.Name == name && !child.Block {
+			existing = append(existing, child)
+		}
+	}
+
+	for i, node := range existing {
+		if i < len(values) {
+			node.SetArgs(values[i]...)
+		} else {
+			d.Remove(node)
+		}
+	}
+	if len(values) <= len(existing) {
+		return
+	}
+
+	var added []*Directive
+	for _, args := range values[len(existing):] {
+		added = append(added, New(name, args...))
+	}
+	if len(existing) > 0 {
+		d.InsertAfter(existing[len(existing)-1], added...)
+		return
+	}
+	d.Insert(d.simpleEnd(), added...)
+}
+
+// Walk 深度优先遍历所有节点，parents为从外到内的块指令；fn返回false时不进入该块
+func (d *Directive) Walk(fn func(node *Directive, parents []*Directive) bool) {
+	walk(d, nil, fn)
+}
+
+func walk(block *Directive, parents []*Directive, fn func(*Directive, []*Directive) bool) {
+	for _, child := range block.Children {
+		if fn(child, parents) && child.Block {
+			walk(child, append(parents[:len(parents):len(parents)], child), fn)
+		}
+	}
+}
+
+// lineEnd 返回位置i的节点及其行尾注释中最后一个的位置
+func (d *Directive) lineEnd(i int) int {
+	for i+1 < len(d.Children) {
+		next := d.Children[i+1]
+		if !next.IsComment() || !next.parsed || strings.Contains(next.pre, "\n") {
+			break
+		}
+		i++
+	}
+	return i
+}
+
+// lineStart 返回位置i的节点上方紧挨着的注释行（中间没有空行）中第一个的位置
+func (d *Directive) lineStart(i int) int {
+	for i > 0 && strings.Count(d.Children[i].pre, "\n") == 1 {
+		prev := d.Children[i-1]
+		if !prev.IsComment() || !prev.parsed || !strings.Contains(prev.pre, "\n") {
+			break
+		}
+		i--
+	}
+	return i
+}
+
+// simpleEnd 新简单指令的插入位置：第一个块指令之前最后一条简单指令之后
+func (d *Directive) simpleEnd() int {
+	pos := -1
+	for i, child := range d.Children {
+		if child.Block {
+			if pos < 0 {
+				return i
+			}
+			break
+		}
+		if !child.IsComment() {
+			pos = i
+		}
+	}
+	if pos < 0 {
+		return len(d.Children)
+	}
+	return d.lineEnd(pos) + 1
+}
+
+func equalArgs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
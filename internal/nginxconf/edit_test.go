@@ -0,0 +1,70 @@
+package nginxconf
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommentOutUncomment(t *testing.T) {
+	const prefix = " disabled: "
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"simple directive", "http {\n    gzip on;\n}\n"},
+		{"block", "http {\n    server {\n        listen 80;\n        server_name example.com;\n    }\n}\n"},
+		{"blank line and comment inside", "http {\n    server {\n        listen 80;\n\n        # static files\n        location / {\n            root html;\n        }\n    }\n}\n"},
+		{"quoted args", "http {\n    server {\n        return 200 \"a;b {c}\";\n    }\n}\n"},
+		{"tab indent", "http {\n\tserver {\n\t\tlisten 80;\n\t}\n}\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse("nginx.conf", tt.content)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			http := doc.Children[0]
+			node := http.Children[0]
+
+			comments := CommentOut(node, prefix)
+			http.ReplaceNodes([]*Directive{node}, comments...)
+			disabled := doc.String()
+			for _, line := range strings.Split(strings.TrimSuffix(disabled, "\n"), "\n")[1:] {
+				if line == "}" {
+					continue
+				}
+				if trimmed := strings.TrimLeft(line, " \t"); !strings.HasPrefix(trimmed, "#"+strings.TrimRight(prefix, " ")) {
+					t.Errorf("line %q is not commented out", line)
+				}
+			}
+
+			// 注释后的文本重新解析也应得到同样的注释行
+			reparsed, err := Parse("nginx.conf", disabled)
+			if err != nil {
+				t.Fatalf("Parse commented-out config: %v", err)
+			}
+			restored, err := Uncomment(reparsed.Children[0].Children, prefix)
+			if err != nil {
+				t.Fatalf("Uncomment: %v", err)
+			}
+			if len(restored) != 1 || restored[0].Name != node.Name {
+				t.Fatalf("Uncomment returned %d nodes, want the original %s", len(restored), node.Name)
+			}
+			reparsed.Children[0].ReplaceNodes(reparsed.Children[0].Children, restored...)
+			if got := reparsed.String(); got != tt.content {
+				t.Errorf("round trip = %q, want %q", got, tt.content)
+			}
+		})
+	}
+}
+
+func TestUncommentRejectsForeignComments(t *testing.T) {
+	doc, err := Parse("nginx.conf", "# just a note\n")
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if _, err := Uncomment(doc.Children, " disabled: "); err == nil {
+		t.Error("Uncomment accepted a comment without the prefix")
+	}
+}
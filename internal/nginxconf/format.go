@@ -0,0 +1,290 @@
+package nginxconf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FormatOptions 格式化选项
+type FormatOptions struct {
+	Indent string // 每级缩进，为空时使用4个空格
+	Align  bool   // 对齐连续简单指令（中间没有空行和注释行）的参数
+}
+
+// token 指令中的一个词或注释，保留原始的引号和转义
+type token struct {
+	text    string
+	comment bool
+	newline bool // 原文中与前一个词之间有换行
+}
+
+// Format 按统一风格输出配置：每级固定缩进，"{"与指令同行，"}"单独一行，
+// 连续空行合并为一行，块首尾的空行去掉；注释保留在原来的位置（行尾注释仍在行尾），
+// 参数保持原有的引号写法，跨行的参数按行对齐到第一个参数
+func Format(doc *Document, opts FormatOptions) string {
+	if opts.Indent == "" {
+		opts.Indent = defaultIndent
+	}
+	f := &formatter{opts: opts}
+	f.writeBlock(&doc.Directive, "", true)
+	if f.b.Len() == 0 {
+		return ""
+	}
+	return f.b.String() + "\n"
+}
+
+// FormatString 解析并格式化配置内容，格式化前后的指令、参数和注释必须完全一致
+func FormatString(file, content string, opts FormatOptions) (string, error) {
+	doc, err := Parse(file, content)
+	if err != nil {
+		return "", err
+	}
+	formatted := Format(doc, opts)
+
+	check, err := Parse(file, formatted)
+	if err != nil {
+		return "", fmt.Errorf("formatted config does not parse: %w", err)
+	}
+	if path := diffNodes(&doc.Directive, &check.Directive); path != "" {
+		return "", fmt.Errorf("formatting changed the config at %s", path)
+	}
+	return formatted, nil
+}
+
+type formatter struct {
+	opts FormatOptions
+	b    strings.Builder
+}
+
+func (f *formatter) writeBlock(block *Directive, indent string, root bool) {
+	widths := f.nameWidths(block, root)
+	first := true
+
+	for i, child := range block.Children {
+		if trailing(block, i, root) {
+			f.b.WriteString(" " + commentText(child))
+			continue
+		}
+
+		if f.b.Len() > 0 {
+			f.b.WriteString("\n")
+			if !first && blankBefore(child) {
+				f.b.WriteString("\n")
+			}
+		}
+		f.b.WriteString(indent)
+		first = false
+
+		if child.IsComment() {
+			f.b.WriteString(commentText(child))
+			continue
+		}
+		f.writeHeader(child, indent, widths[i])
+		if !child.Block {
+			continue
+		}
+		if len(child.Children) == 0 {
+			f.b.WriteString("}")
+			continue
+		}
+		f.writeBlock(child, indent+f.opts.Indent, false)
+		f.b.WriteString("\n" + indent + "}")
+	}
+}
+
+// writeHeader 输出指令名和参数，以";"或"{"结尾
+func (f *formatter) writeHeader(d *Directive, indent string, width int) {
+	tokens := nodeTokens(d)
+	name := tokens[0].text
+	f.b.WriteString(name)
+
+	cont := "\n" + indent + strings.Repeat(" ", len(name)+1)
+	afterComment := tokens[0].comment
+	for i, tok := range tokens[1:] {
+		switch {
+		case afterComment || tok.newline:
+			f.b.WriteString(cont)
+		case i == 0 && width > len(name):
+			f.b.WriteString(strings.Repeat(" ", width-len(name)+1))
+		default:
+			f.b.WriteString(" ")
+		}
+		f.b.WriteString(tok.text)
+		afterComment = tok.comment
+	}
+
+	end := ";"
+	if d.Block {
+		end = " {"
+	}
+	if afterComment {
+		f.b.WriteString(cont)
+		end = strings.TrimPrefix(end, " ")
+	}
+	f.b.WriteString(end)
+}
+
+// nameWidths 开启对齐时返回每条简单指令的指令名宽度
+func (f *formatter) nameWidths(block *Directive, root bool) []int {
+	widths := make([]int, len(block.Children))
+	if !f.opts.Align {
+		return widths
+	}
+
+	var run []int
+	flush := func() {
+		if len(run) > 1 {
+			width := 0
+			for _, i := range run {
+				if n := len(nodeTokens(block.Children[i])[0].text); n > width {
+					width = n
+				}
+			}
+			for _, i := range run {
+				widths[i] = width
+			}
+		}
+		run = nil
+	}
+
+	for i, child := range block.Children {
+		if trailing(block, i, root) {
+			continue
+		}
+		if !alignable(child) || (len(run) > 0 && blankBefore(child)) {
+			flush()
+		}
+		if alignable(child) {
+			run = append(run, i)
+		}
+	}
+	flush()
+	return widths
+}
+
+// alignable 单行的简单指令才参与对齐
+func alignable(d *Directive) bool {
+	if d.IsComment() || d.Block {
+		return false
+	}
+	tokens := nodeTokens(d)
+	for _, tok := range tokens[1:] {
+		if tok.comment || tok.newline {
+			return false
+		}
+	}
+	return len(tokens) > 1
+}
+
+// trailing 位置i的节点是否为前一行的行尾注释；块的第一个子节点可以是"{"所在行的注释
+func trailing(block *Directive, i int, root bool) bool {
+	child := block.Children[i]
+	if !child.IsComment() || !child.parsed || strings.Contains(child.pre, "\n") {
+		return false
+	}
+	return i > 0 || !root
+}
+
+// blankBefore 节点之前是否保留一个空行，新增的块指令之前总是空一行
+func blankBefore(d *Directive) bool {
+	if !d.parsed {
+		return d.Block
+	}
+	return strings.Count(d.pre, "\n") > 1
+}
+
+func commentText(d *Directive) string {
+	return "#" + strings.TrimRight(d.Comment, " \t\r")
+}
+
+// nodeTokens 指令名和参数。未修改的节点从原始文本中读取，保留引号写法、换行和块头中的注释
+func nodeTokens(d *Directive) []token {
+	if !d.parsed || d.dirty {
+		tokens := []token{{text: d.Name}}
+		for _, arg := range d.Args {
+			tokens = append(tokens, token{text: Quote(arg)})
+		}
+		return tokens
+	}
+
+	var tokens []token
+	src := d.raw
+	newline := false
+	for i := 0; i < len(src); {
+		ch := src[i]
+		switch {
+		case isSpace(ch):
+			if ch == '\n' {
+				newline = true
+			}
+			i++
+			continue
+		case ch == ';' || ch == '{':
+			return tokens
+		case ch == '#':
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			tokens = append(tokens, token{text: strings.TrimRight(src[i:i+end], " \t\r"), comment: true, newline: newline})
+			i += end
+		default:
+			end := wordEnd(src, i)
+			tokens = append(tokens, token{text: src[i:end], newline: newline})
+			i = end
+		}
+		newline = false
+	}
+	return tokens
+}
+
+// wordEnd 返回从start开始的参数的结束位置，规则与readWord一致
+func wordEnd(src string, start int) int {
+	i := start
+	if q := src[i]; q == '"' || q == '\'' {
+		for i++; i < len(src); i++ {
+			switch src[i] {
+			case '\\':
+				i++
+			case q:
+				return i + 1
+			}
+		}
+		return len(src)
+	}
+
+	for ; i < len(src); i++ {
+		switch ch := src[i]; {
+		case isSpace(ch) || ch == ';':
+			return i
+		case ch == '{' && (i == start || src[i-1] != '$'):
+			return i
+		case ch == '\\':
+			i++
+		}
+	}
+	if i > len(src) {
+		return len(src)
+	}
+	return i
+}
+
+// diffNodes 比较两棵树的指令、参数和注释，返回第一个不同之处的位置，相同时返回空
+func diffNodes(a, b *Directive) string {
+	if len(a.Children) != len(b.Children) {
+		return fmt.Sprintf("line %d: %d nodes instead of %d", b.Line, len(b.Children), len(a.Children))
+	}
+	for i, x := range a.Children {
+		y := b.Children[i]
+		if x.Name != y.Name || x.Block != y.Block || !equalArgs(x.Args, y.Args) ||
+			strings.TrimRight(x.Comment, " \t\r") != strings.TrimRight(y.Comment, " \t\r") {
+			return fmt.Sprintf("line %d", x.Line)
+		}
+		if x.Block {
+			if path := diffNodes(x, y); path != "" {
+				return path
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,70 @@
+package nginxconf
+
+import "testing"
+
+func TestFormatStringIdempotent(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		opts    FormatOptions
+		want    string
+	}{
+		{
+			name:    "indent and braces",
+			content: "http{\nserver {listen 80;\n}}\n",
+			want:    "http {\n    server {\n        listen 80;\n    }\n}\n",
+		},
+		{
+			name:    "blank lines",
+			content: "user nobody;\n\n\n\nevents {\n\n    worker_connections 1024;\n\n}\n",
+			want:    "user nobody;\n\nevents {\n    worker_connections 1024;\n}\n",
+		},
+		{
+			name:    "comments stay in place",
+			content: "# top\nhttp {\n  # inside\n  sendfile on; # trailing\n}\n",
+			want:    "# top\nhttp {\n    # inside\n    sendfile on; # trailing\n}\n",
+		},
+		{
+			name:    "quotes are kept",
+			content: "http {\nadd_header X-Test 'a b';\nreturn 200 \"ok\";\n}\n",
+			want:    "http {\n    add_header X-Test 'a b';\n    return 200 \"ok\";\n}\n",
+		},
+		{
+			name:    "tab indent",
+			content: "events {\nworker_connections 1024;\n}\n",
+			opts:    FormatOptions{Indent: "\t"},
+			want:    "events {\n\tworker_connections 1024;\n}\n",
+		},
+		{
+			name:    "align",
+			content: "server {\nlisten 80;\nserver_name example.com;\nroot /srv;\n}\n",
+			opts:    FormatOptions{Align: true},
+			want:    "server {\n    listen      80;\n    server_name example.com;\n    root        /srv;\n}\n",
+		},
+		{
+			name:    "empty",
+			content: "",
+			want:    "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			once, err := FormatString("nginx.conf", tt.content, tt.opts)
+			if err != nil {
+				t.Fatalf("FormatString: %v", err)
+			}
+			if once != tt.want {
+				t.Errorf("FormatString() = %q, want %q", once, tt.want)
+			}
+
+			twice, err := FormatString("nginx.conf", once, tt.opts)
+			if err != nil {
+				t.Fatalf("FormatString on formatted output: %v", err)
+			}
+			if twice != once {
+				t.Errorf("formatting is not idempotent:\nfirst:  %q\nsecond: %q", once, twice)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package nginxconf
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Directive 配置中的一条指令或注释。块指令的子节点在Children中；
+// 注释的Name为"#"，内容（不含#）在Comment中
+type Directive struct {
+	Name     string       `json:"name"`
+	Args     []string     `json:"args,omitempty"`
+	Block    bool         `json:"block,omitempty"`
+	Children []*Directive `json:"children,omitempty"`
+	Comment  string       `json:"comment,omitempty"`
+	File     string       `json:"file,omitempty"`
+	Line     int          `json:"line"`
+
+	// 以下字段保存原始文本，未修改的部分按原样输出
+	parsed bool   // 由解析得到，pre/raw/tail有效
+	pre    string // 节点之前的空白
+	raw    string // 简单指令或注释的原始文本；块指令为块头（到"{"为止）
+	tail   string // 块内"}"之前的空白
+	dirty  bool   // 名称或参数已修改，需要重新生成
+}
+
+// Document 一个配置文件，根节点为不带块头的块
+type Document struct {
+	Directive
+	source string
+}
+
+// SyntaxError 配置语法错误
+type SyntaxError struct {
+	File    string
+	Line    int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Message)
+}
+
+// IsComment 是否为注释
+func (d *Directive) IsComment() bool {
+	return d.Name == "#"
+}
+
+// ParseFile 解析配置文件
+func ParseFile(path string) (*Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return Parse(path, string(data))
+}
+
+// Parse 解析配置内容，file仅用于错误信息和节点位置
+func Parse(file, content string) (*Document, error) {
+	p := &parser{file: file, src: content, line: 1}
+	doc := &Document{source: content}
+	doc.Block = true
+	doc.File = file
+	doc.parsed = true
+
+	if err := p.parseBlock(&doc.Directive, false); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// NewDocument 创建空的配置文件
+func NewDocument(file string) *Document {
+	doc := &Document{}
+	doc.Block = true
+	doc.File = file
+	doc.parsed = true
+	doc.tail = "\n"
+	return doc
+}
+
+// Modified 内容是否与解析时不同
+func (d *Document) Modified() bool {
+	return d.String() != d.source
+}
+
+type parser struct {
+	file string
+	src  string
+	pos  int
+	line int
+}
+
+func (p *parser) errorf(line int, format string, args ...interface{}) error {
+	return &SyntaxError{File: p.file, Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+// parseBlock 解析块内容直到"}"（inner为true时）或文件结束
+func (p *parser) parseBlock(block *Directive, inner bool) error {
+	for {
+		pre := p.skipSpace()
+
+		if p.pos >= len(p.src) {
+			if inner {
+				return p.errorf(p.line, "unexpected end of file, expecting \"}\"")
+			}
+			block.tail = pre
+			return nil
+		}
+
+		switch p.src[p.pos] {
+		case '}':
+			if !inner {
+				return p.errorf(p.line, "unexpected \"}\"")
+			}
+			p.pos++
+			block.tail = pre
+			return nil
+		case '#':
+			start := p.pos
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+			block.Children = append(block.Children, &Directive{
+				Name:    "#",
+				Comment: p.src[start+1 : p.pos],
+				File:    p.file,
+				Line:    p.line,
+				parsed:  true,
+				pre:     pre,
+				raw:     p.src[start:p.pos],
+			})
+			continue
+		}
+
+		node, err := p.parseDirective()
+		if err != nil {
+			return err
+		}
+		node.pre = pre
+		block.Children = append(block.Children, node)
+
+		if node.Block {
+			if err := p.parseBlock(node, true); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// parseDirective 读取指令的各个参数，直到";"或"{"
+func (p *parser) parseDirective() (*Directive, error) {
+	start := p.pos
+	node := &Directive{File: p.file, Line: p.line, parsed: true}
+	var words []string
+
+	for {
+		p.skipSpace()
+		if p.pos >= len(p.src) {
+			return nil, p.errorf(p.line, "unexpected end of file, expecting \";\" or \"}\"")
+		}
+
+		switch p.src[p.pos] {
+		case ';', '{':
+			if len(words) == 0 {
+				return nil, p.errorf(p.line, "unexpected %q", p.src[p.pos])
+			}
+			node.Block = p.src[p.pos] == '{'
+			p.pos++
+			node.Name, node.Args = words[0], words[1:]
+			node.raw = p.src[start:p.pos]
+			return node, nil
+		case '}':
+			return nil, p.errorf(p.line, "unexpected \"}\"")
+		case '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		}
+
+		word, err := p.readWord()
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, word)
+	}
+}
+
+// readWord 读取一个参数，处理引号和转义
+func (p *parser) readWord() (string, error) {
+	line := p.line
+	var b strings.Builder
+
+	if q := p.src[p.pos]; q == '"' || q == '\'' {
+		p.pos++
+		for p.pos < len(p.src) {
+			ch := p.src[p.pos]
+			switch {
+			case ch == q:
+				p.pos++
+				return b.String(), nil
+			case ch == '\\' && p.pos+1 < len(p.src):
+				b.WriteString(unescape(p.src[p.pos+1]))
+				p.pos += 2
+				continue
+			case ch == '\n':
+				p.line++
+			}
+			b.WriteByte(ch)
+			p.pos++
+		}
+		return "", p.errorf(line, "unexpected end of file, unterminated string")
+	}
+
+	for p.pos < len(p.src) {
+		ch := p.src[p.pos]
+		switch {
+		case isSpace(ch) || ch == ';':
+			return b.String(), nil
+		case ch == '{':
+			// ${name}形式的变量不结束参数
+			if !strings.HasSuffix(b.String(), "$") {
+				return b.String(), nil
+			}
+		case ch == '\\' && p.pos+1 < len(p.src):
+			b.WriteString(unescape(p.src[p.pos+1]))
+			p.pos += 2
+			continue
+		}
+		b.WriteByte(ch)
+		p.pos++
+	}
+	return b.String(), nil
+}
+
+// unescape 与nginx一致：只处理\" \' \\ \t \r \n，其他转义保留反斜杠
+func unescape(ch byte) string {
+	switch ch {
+	case '"', '\'', '\\':
+		return string(ch)
+	case 't':
+		return "\t"
+	case 'r':
+		return "\r"
+	case 'n':
+		return "\n"
+	}
+	return "\\" + string(ch)
+}
+
+func (p *parser) skipSpace() string {
+	start := p.pos
+	for p.pos < len(p.src) && isSpace(p.src[p.pos]) {
+		if p.src[p.pos] == '\n' {
+			p.line++
+		}
+		p.pos++
+	}
+	return p.src[start:p.pos]
+}
+
+func isSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n'
+}
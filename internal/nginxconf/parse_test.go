@@ -0,0 +1,57 @@
+package nginxconf
+
+import "testing"
+
+func TestParseRoundTrip(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"empty", ""},
+		{"only whitespace", "\n\n  \n"},
+		{"simple directive", "worker_processes auto;\n"},
+		{"no trailing newline", "worker_processes auto;"},
+		{"comments", "# main config\nuser nobody; # worker user\n\n#events {}\n"},
+		{"nested blocks", "http {\n    server {\n        listen 80;\n        location / {\n            root html;\n        }\n    }\n}\n"},
+		{"irregular spacing", "http{\n\tserver   {listen  80 ;}\n\n\n   }\n"},
+		{"quoted args", "log_format main '$remote_addr - \"$request\"' \"$status\";\n"},
+		{"escapes", "return 200 \"a\\\"b\\\\c\\n\";\nset $x 'it\\'s';\n"},
+		{"variables in braces", "set $a ${host}x;\nif ($request_uri ~* \"^/(a|b){2}\") { return 404; }\n"},
+		{"multi-line args", "log_format main\n    '$remote_addr'\n    '$status';\n"},
+		{"crlf", "events {\r\n    worker_connections 1024;\r\n}\r\n"},
+		{"empty block", "events {}\n"},
+		{"hash inside arg", "add_header X-Tag a#b;\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Parse("nginx.conf", tt.content)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := doc.String(); got != tt.content {
+				t.Errorf("String() = %q, want %q", got, tt.content)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"unclosed block", "http {\n    server {\n"},
+		{"unexpected brace", "}\n"},
+		{"missing semicolon", "worker_processes auto\n"},
+		{"unterminated quote", "return 200 \"abc;\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse("nginx.conf", tt.content); err == nil {
+				t.Errorf("Parse(%q) succeeded, want an error", tt.content)
+			}
+		})
+	}
+}
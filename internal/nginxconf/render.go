@@ -0,0 +1,151 @@
+package nginxconf
+
+import (
+	"strings"
+)
+
+// defaultIndent 新增节点无法从同级节点推断缩进时使用
+const defaultIndent = "    "
+
+// String 输出配置文本。解析得到且未修改的节点保留原始文本（包括空白和注释），
+// 新增或修改的节点按同级节点的缩进重新生成
+func (d *Document) String() string {
+	var b strings.Builder
+	writeChildren(&b, &d.Directive, "")
+	b.WriteString(d.tail)
+	return b.String()
+}
+
+// Text 输出单个节点的文本（不含前导空白），indent为节点所在行的缩进
+func (d *Directive) Text(indent string) string {
+	var b strings.Builder
+	writeNode(&b, d, indent)
+	return b.String()
+}
+
+func writeChildren(b *strings.Builder, block *Directive, indent string) {
+	for i, child := range block.Children {
+		switch {
+		case child.parsed:
+			b.WriteString(child.pre)
+		case i == 0 && b.Len() == 0:
+			// 新文件的第一个节点
+		case i > 0 && child.Block:
+			b.WriteString("\n\n" + indent)
+		default:
+			b.WriteString("\n" + indent)
+		}
+		writeNode(b, child, nodeIndent(child, indent))
+	}
+}
+
+func writeNode(b *strings.Builder, d *Directive, indent string) {
+	if d.parsed && !d.dirty {
+		b.WriteString(d.raw)
+	} else if d.IsComment() {
+		b.WriteString("#" + d.Comment)
+	} else {
+		b.WriteString(d.Name)
+		for _, arg := range d.Args {
+			b.WriteString(" " + Quote(arg))
+		}
+		if d.Block {
+			b.WriteString(" {")
+		} else {
+			b.WriteString(";")
+		}
+	}
+
+	if !d.Block {
+		return
+	}
+	writeChildren(b, d, childIndent(d, indent))
+	if d.parsed {
+		b.WriteString(d.tail)
+	} else {
+		b.WriteString("\n" + indent)
+	}
+	b.WriteString("}")
+}
+
+// nodeIndent 解析得到的节点使用原有缩进
+func nodeIndent(d *Directive, indent string) string {
+	if d.parsed {
+		if i := strings.LastIndexByte(d.pre, '\n'); i >= 0 {
+			return d.pre[i+1:]
+		}
+	}
+	return indent
+}
+
+// childIndent 子节点的缩进：优先沿用已有子节点的缩进，否则比块多一级
+func childIndent(d *Directive, indent string) string {
+	for _, child := range d.Children {
+		if child.parsed {
+			if i := strings.LastIndexByte(child.pre, '\n'); i >= 0 {
+				return child.pre[i+1:]
+			}
+		}
+	}
+	return indent + indentUnit(indent)
+}
+
+func indentUnit(indent string) string {
+	if strings.HasPrefix(indent, "\t") {
+		return "\t"
+	}
+	return defaultIndent
+}
+
+// Quote 必要时给参数加引号，使nginx解析后得到原值
+func Quote(arg string) string {
+	if arg == "" {
+		return `""`
+	}
+
+	plain := true
+	for i := 0; i < len(arg); i++ {
+		switch ch := arg[i]; {
+		case isSpace(ch) || ch == ';' || ch == '"' || ch == '\'':
+			plain = false
+		case ch == '{' && (i == 0 || arg[i-1] != '$'):
+			plain = false
+		case ch == '#' && i == 0:
+			plain = false
+		case ch == '\\' && escapes(arg, i):
+			plain = false
+		}
+	}
+	if plain {
+		return arg
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(arg); i++ {
+		switch ch := arg[i]; {
+		case ch == '"':
+			b.WriteString(`\"`)
+		case ch == '\\' && escapes(arg, i):
+			b.WriteString(`\\`)
+		case ch == '\t':
+			b.WriteString(`\t`)
+		case ch == '\r':
+			b.WriteString(`\r`)
+		case ch == '\n':
+			b.WriteString(`\n`)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// escapes 位置i的反斜杠是否会被nginx当作转义符
+func escapes(arg string, i int) bool {
+	if i+1 >= len(arg) {
+		return true
+	}
+	return strings.IndexByte(`"'\trn`, arg[i+1]) >= 0
+}
@@ -0,0 +1,46 @@
+package nginxconf
+
+import "testing"
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		arg  string
+		want string
+	}{
+		{"", `""`},
+		{"html", "html"},
+		{"$host$request_uri", "$host$request_uri"},
+		{"${host}x", "${host}x"},
+		{"a#b", "a#b"},
+		{`C:\nginx`, `"C:\\nginx"`},
+		{`a\b`, `a\b`},
+		{"a b", `"a b"`},
+		{"a\tb", `"a\tb"`},
+		{"a;b", `"a;b"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{"it's", `"it's"`},
+		{"{x}", `"{x}"`},
+		{"#tag", `"#tag"`},
+		{`a\"`, `"a\\\""`},
+		{`a\`, `"a\\"`},
+		{`\n`, `"\\n"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			got := Quote(tt.arg)
+			if got != tt.want {
+				t.Errorf("Quote(%q) = %s, want %s", tt.arg, got, tt.want)
+			}
+
+			// nginx解析引号后的参数必须得到原值
+			doc, err := Parse("nginx.conf", "set $v "+got+";\n")
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if args := doc.Children[0].Args; len(args) != 2 || args[1] != tt.arg {
+				t.Errorf("parsed args = %q, want [$v %q]", args, tt.arg)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package nginxconf
+
+import (
+	"path/filepath"
+	"sort"
+)
+
+// Tree 主配置文件及其通过include引入的文件
+type Tree struct {
+	Main   string
+	Prefix string // 相对路径的基准目录，即主配置所在目录
+	Files  map[string]*Document
+
+	includes map[*Directive][]string
+}
+
+// Load 解析主配置文件及其include的所有文件；通配符没有匹配到文件时忽略
+func Load(main string) (*Tree, error) {
+	t := newTree(main)
+	if err := t.load(t.Main); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// LoadContent 与Load相同，但主配置使用content（如编辑器中尚未保存的内容），include的文件从磁盘读取
+func LoadContent(main, content string) (*Tree, error) {
+	t := newTree(main)
+	doc, err := Parse(t.Main, content)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.add(t.Main, doc); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func newTree(main string) *Tree {
+	return &Tree{
+		Main:     filepath.Clean(main),
+		Prefix:   filepath.Dir(main),
+		Files:    make(map[string]*Document),
+		includes: make(map[*Directive][]string),
+	}
+}
+
+func (t *Tree) load(file string) error {
+	if _, ok := t.Files[file]; ok {
+		return nil
+	}
+	doc, err := ParseFile(file)
+	if err != nil {
+		return err
+	}
+	return t.add(file, doc)
+}
+
+// add 加入已解析的文件并加载它include的文件
+func (t *Tree) add(file string, doc *Document) error {
+	t.Files[file] = doc
+
+	var includes []*Directive
+	doc.Walk(func(node *Directive, parents []*Directive) bool {
+		if node.Name == "include" && !node.Block && len(node.Args) > 0 {
+			includes = append(includes, node)
+		}
+		return true
+	})
+
+	for _, node := range includes {
+		matches, err := filepath.Glob(t.Resolve(node.Args[0]))
+		if err != nil {
+			continue
+		}
+		sort.Strings(matches)
+		t.includes[node] = matches
+		for _, match := range matches {
+			if err := t.load(match); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Resolve 按nginx的规则把相对路径解析为相对于主配置目录的路径
+func (t *Tree) Resolve(path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(t.Prefix, path)
+}
+
+// Root 主配置文件
+func (t *Tree) Root() *Document {
+	return t.Files[t.Main]
+}
+
+// Included include指令引入的文件
+func (t *Tree) Included(include *Directive) []*Document {
+	var docs []*Document
+	for _, file := range t.includes[include] {
+		if doc, ok := t.Files[file]; ok {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+// AddInclude 记录include指令引入了file，用于在内存中新增文件后保持树的完整
+func (t *Tree) AddInclude(include *Directive, file string) {
+	for _, existing := range t.includes[include] {
+		if existing == file {
+			return
+		}
+	}
+	t.includes[include] = append(t.includes[include], file)
+	sort.Strings(t.includes[include])
+}
+
+// Walk 按nginx加载配置的顺序遍历所有节点，include指令处展开被引入的文件；
+// parents为从外到内的块指令（不包括include），fn返回false时不进入该块或文件
+func (t *Tree) Walk(fn func(node *Directive, parents []*Directive) bool) {
+	t.walk(&t.Root().Directive, nil, map[*Document]bool{t.Root(): true}, fn)
+}
+
+func (t *Tree) walk(block *Directive, parents []*Directive, active map[*Document]bool, fn func(*Directive, []*Directive) bool) {
+	for _, child := range block.Children {
+		if !fn(child, parents) {
+			continue
+		}
+		if child.Block {
+			t.walk(child, append(parents[:len(parents):len(parents)], child), active, fn)
+			continue
+		}
+		for _, doc := range t.Included(child) {
+			// 防止文件互相include导致死循环
+			if active[doc] {
+				continue
+			}
+			active[doc] = true
+			t.walk(&doc.Directive, parents, active, fn)
+			delete(active, doc)
+		}
+	}
+}
+
+// Modified 返回内容已修改的文件
+func (t *Tree) Modified() map[string]string {
+	changed := make(map[string]string)
+	for file, doc := range t.Files {
+		if doc.Modified() {
+			changed[file] = doc.String()
+		}
+	}
+	return changed
+}
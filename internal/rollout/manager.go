@@ -0,0 +1,529 @@
+package rollout
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"nginx_manager/internal/agent"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	maxRollouts        = 50
+	healthCheckTimeout = 5 * time.Second
+)
+
+var healthClient = &http.Client{Timeout: healthCheckTimeout}
+
+// Manager 按计划把配置分批发布到多个agent：先在金丝雀主机上验证、应用、reload并做健康检查，
+// 再按批次继续；任一主机失败时把所有已应用的主机恢复为原配置
+type Manager struct {
+	fleet    *agent.Fleet
+	mu       sync.Mutex
+	rollouts []*Rollout
+	dataFile string
+	seq      int64
+}
+
+// NewManager 创建发布管理器，发布记录保存在dataFile中
+func NewManager(fleet *agent.Fleet, dataFile string) *Manager {
+	m := &Manager{
+		fleet:    fleet,
+		dataFile: dataFile,
+	}
+	if err := m.load(); err != nil {
+		logrus.Warn("Failed to load rollouts: ", err)
+	}
+	return m
+}
+
+// Create 创建并开始发布
+func (m *Manager) Create(plan Plan, actor string) (*Rollout, error) {
+	if err := plan.normalize(); err != nil {
+		return nil, err
+	}
+	for _, name := range plan.Agents {
+		if _, ok := m.fleet.Client(name); !ok {
+			return nil, fmt.Errorf("agent %s not found", name)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// 同一主机同时只能参与一个发布
+	for _, r := range m.rollouts {
+		if !r.Active() {
+			continue
+		}
+		for _, name := range plan.Agents {
+			if r.host(name) != nil {
+				return nil, fmt.Errorf("agent %s is part of active rollout %s", name, r.ID)
+			}
+		}
+	}
+
+	now := time.Now()
+	m.seq++
+	r := &Rollout{
+		ID:        strconv.FormatInt(m.seq, 10),
+		Plan:      plan,
+		Status:    StatusRunning,
+		Batches:   plan.batches(),
+		CreatedBy: actor,
+		CreatedAt: now,
+		UpdatedAt: now,
+		control:   make(chan string, 1),
+	}
+	for i, batch := range r.Batches {
+		for _, name := range batch {
+			r.Hosts = append(r.Hosts, &HostState{Agent: name, Batch: i, Status: HostPending, UpdatedAt: now})
+		}
+	}
+	r.record("", fmt.Sprintf("rollout %q created by %s: canary %s, %d batches", plan.Name, actor, plan.Canary, len(r.Batches)))
+
+	m.rollouts = append(m.rollouts, r)
+	m.trim()
+	m.save()
+
+	go m.run(r)
+	return r.snapshot(), nil
+}
+
+// List 返回所有发布记录，最新的在前，不包含配置内容
+func (m *Manager) List() []*Rollout {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := make([]*Rollout, 0, len(m.rollouts))
+	for i := len(m.rollouts) - 1; i >= 0; i-- {
+		r := m.rollouts[i].snapshot()
+		r.Plan.Content = ""
+		list = append(list, r)
+	}
+	return list
+}
+
+// Get 返回指定发布
+func (m *Manager) Get(id string) (*Rollout, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r := m.find(id)
+	if r == nil {
+		return nil, false
+	}
+	return r.snapshot(), true
+}
+
+// Approve 批准暂停中的发布继续进行
+func (m *Manager) Approve(id, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r := m.find(id)
+	if r == nil {
+		return fmt.Errorf("rollout %s not found", id)
+	}
+	if r.Status != StatusPaused || r.abortRequested {
+		return fmt.Errorf("rollout %s is not waiting for approval", id)
+	}
+	r.Status = StatusRunning
+	r.record("", "approved by "+actor)
+	m.save()
+	r.control <- "approve"
+	return nil
+}
+
+// Pause 在当前批次完成后暂停发布
+func (m *Manager) Pause(id, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r := m.find(id)
+	if r == nil {
+		return fmt.Errorf("rollout %s not found", id)
+	}
+	if r.Status != StatusRunning || r.pauseRequested {
+		return fmt.Errorf("rollout %s is not running", id)
+	}
+	r.pauseRequested = true
+	r.record("", "pause requested by "+actor+", will pause after the current batch")
+	m.save()
+	return nil
+}
+
+// Abort 中止发布：暂停中立即结束，进行中则在当前批次完成后结束；
+// rollback为true时把已应用的主机恢复为原配置
+func (m *Manager) Abort(id string, rollback bool, actor string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r := m.find(id)
+	if r == nil {
+		return fmt.Errorf("rollout %s not found", id)
+	}
+	if !r.Active() || r.abortRequested {
+		return fmt.Errorf("rollout %s is not active", id)
+	}
+	r.abortRequested = true
+	r.rollbackOnAbort = rollback
+	r.record("", fmt.Sprintf("abort requested by %s (rollback: %v)", actor, rollback))
+	m.save()
+	if r.Status == StatusPaused {
+		r.control <- "abort"
+	}
+	return nil
+}
+
+// run 依次执行各批次
+func (m *Manager) run(r *Rollout) {
+	for i, batch := range r.Batches {
+		if !m.checkpoint(r, i) {
+			return
+		}
+		if err := m.applyBatch(r, i, batch); err != nil {
+			m.rollback(r, StatusRolledBack, err.Error())
+			return
+		}
+	}
+	if !m.checkpoint(r, len(r.Batches)) {
+		return
+	}
+	m.finish(r, StatusSucceeded, fmt.Sprintf("configuration applied to %d hosts", len(r.Hosts)))
+}
+
+// checkpoint 在批次开始前处理暂停和中止，返回false表示发布已结束；
+// batch等于批次数时只检查中止请求
+func (m *Manager) checkpoint(r *Rollout, batch int) bool {
+	m.mu.Lock()
+	last := batch == len(r.Batches)
+	pause := !last && (r.pauseRequested || r.Plan.pauseBefore(batch))
+	for {
+		if r.abortRequested {
+			m.mu.Unlock()
+			m.abort(r)
+			return false
+		}
+		if !pause {
+			if !last {
+				r.CurrentBatch = batch
+			}
+			m.mu.Unlock()
+			return true
+		}
+
+		r.Status = StatusPaused
+		r.pauseRequested = false
+		r.record("", fmt.Sprintf("paused before batch %d, waiting for approval", batch))
+		m.save()
+		m.mu.Unlock()
+
+		<-r.control
+
+		m.mu.Lock()
+		pause = false
+	}
+}
+
+// applyBatch 并发更新一个批次的主机，返回第一个失败
+func (m *Manager) applyBatch(r *Rollout, batch int, agents []string) error {
+	if batch == 0 {
+		m.event(r, "", "starting canary "+agents[0])
+	} else {
+		m.event(r, "", fmt.Sprintf("starting batch %d: %s", batch, strings.Join(agents, ", ")))
+	}
+
+	errs := make([]error, len(agents))
+	var wg sync.WaitGroup
+	for i, name := range agents {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			errs[i] = m.applyHost(r, name)
+		}(i, name)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("%s: %w", agents[i], err)
+		}
+	}
+	return nil
+}
+
+// applyHost 在一台主机上验证、保存、reload并做健康检查
+func (m *Manager) applyHost(r *Rollout, name string) error {
+	plan := r.Plan
+	client, ok := m.fleet.Client(name)
+	if !ok {
+		return m.failHost(r, name, fmt.Errorf("agent is no longer registered"))
+	}
+
+	m.setHost(r, name, HostValidating, "running nginx -t", false)
+	previous, err := client.ReadConfig(plan.Instance)
+	if err != nil {
+		return m.failHost(r, name, err)
+	}
+	m.mu.Lock()
+	r.host(name).previous = previous
+	m.mu.Unlock()
+	if err := client.ValidateConfig(plan.Instance, plan.Content); err != nil {
+		return m.failHost(r, name, err)
+	}
+
+	// 保存失败时文件可能已部分写入，也按已应用处理以便回滚
+	m.setHost(r, name, HostApplying, "saving configuration", true)
+	if err := client.SaveConfig(plan.Instance, plan.Content); err != nil {
+		return m.failHost(r, name, err)
+	}
+
+	m.setHost(r, name, HostReloading, "reloading nginx", true)
+	if err := client.Reload(plan.Instance); err != nil {
+		return m.failHost(r, name, err)
+	}
+
+	m.setHost(r, name, HostChecking, "waiting "+plan.HealthDelay+" before health check", true)
+	time.Sleep(plan.healthDelay())
+	if err := checkHealth(client, plan); err != nil {
+		return m.failHost(r, name, err)
+	}
+
+	m.setHost(r, name, HostSucceeded, "configuration applied", true)
+	return nil
+}
+
+// checkHealth reload后检查nginx仍在运行、配置有效，以及可选的HTTP健康检查
+func checkHealth(client *agent.Client, plan Plan) error {
+	status, err := client.Status(plan.Instance)
+	if err != nil {
+		return err
+	}
+	if !status.IsRunning {
+		return fmt.Errorf("nginx is not running after reload")
+	}
+	if !status.ConfigValid {
+		return fmt.Errorf("configuration is invalid after reload")
+	}
+
+	if plan.HealthURL == "" {
+		return nil
+	}
+	url := strings.ReplaceAll(plan.HealthURL, "{host}", client.URL.Hostname())
+	resp, err := healthClient.Get(url)
+	if err != nil {
+		return fmt.Errorf("health check %s failed: %w", url, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("health check %s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+// rollback 把已应用的主机恢复为原配置并结束发布
+func (m *Manager) rollback(r *Rollout, status, reason string) {
+	m.mu.Lock()
+	type target struct{ name, previous string }
+	var targets []target
+	for _, host := range r.Hosts {
+		if host.Applied {
+			targets = append(targets, target{host.Agent, host.previous})
+		}
+	}
+	m.mu.Unlock()
+
+	if len(targets) > 0 {
+		m.event(r, "", fmt.Sprintf("rolling back %d hosts: %s", len(targets), reason))
+	}
+
+	var failed []string
+	for _, t := range targets {
+		client, ok := m.fleet.Client(t.name)
+		var err error
+		if !ok {
+			err = fmt.Errorf("agent is no longer registered")
+		} else if err = client.SaveConfig(r.Plan.Instance, t.previous); err == nil {
+			err = client.Reload(r.Plan.Instance)
+		}
+		if err != nil {
+			failed = append(failed, t.name)
+			m.setHost(r, t.name, HostFailed, "rollback failed: "+err.Error(), true)
+			continue
+		}
+		m.setHost(r, t.name, HostRolledBack, "previous configuration restored", false)
+	}
+
+	if len(failed) > 0 {
+		reason += "; rollback failed on " + strings.Join(failed, ", ")
+	}
+	m.finish(r, status, reason)
+}
+
+// abort 处理中止请求
+func (m *Manager) abort(r *Rollout) {
+	m.mu.Lock()
+	rollback := r.rollbackOnAbort
+	m.mu.Unlock()
+
+	if rollback {
+		m.rollback(r, StatusAborted, "aborted")
+		return
+	}
+	m.finish(r, StatusAborted, "aborted, hosts already updated keep the new configuration")
+}
+
+func (m *Manager) finish(r *Rollout, status, message string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	r.Status = status
+	r.Message = message
+	r.FinishedAt = &now
+	r.record("", "rollout "+status+": "+message)
+	m.save()
+}
+
+func (m *Manager) failHost(r *Rollout, name string, err error) error {
+	m.mu.Lock()
+	applied := r.host(name).Applied
+	m.mu.Unlock()
+	m.setHost(r, name, HostFailed, err.Error(), applied)
+	return err
+}
+
+func (m *Manager) setHost(r *Rollout, name, status, message string, applied bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	host := r.host(name)
+	host.Status = status
+	host.Message = message
+	host.Applied = applied
+	host.UpdatedAt = time.Now()
+	r.record(name, status+": "+message)
+	m.save()
+}
+
+func (m *Manager) event(r *Rollout, agentName, message string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r.record(agentName, message)
+	m.save()
+}
+
+// find 按ID查找发布，调用方需持有锁
+func (m *Manager) find(id string) *Rollout {
+	for _, r := range m.rollouts {
+		if r.ID == id {
+			return r
+		}
+	}
+	return nil
+}
+
+// trim 只保留最近的发布记录，进行中的发布不会被删除，调用方需持有锁
+func (m *Manager) trim() {
+	for excess := len(m.rollouts) - maxRollouts; excess > 0; excess-- {
+		for i, r := range m.rollouts {
+			if !r.Active() {
+				m.rollouts = append(m.rollouts[:i], m.rollouts[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// save 保存发布记录，调用方需持有锁
+func (m *Manager) save() {
+	if m.dataFile == "" {
+		return
+	}
+
+	data, err := json.MarshalIndent(m.rollouts, "", "  ")
+	if err != nil {
+		logrus.Warn("Failed to encode rollouts: ", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(m.dataFile), 0755); err != nil {
+		logrus.Warn("Failed to create rollout data directory: ", err)
+		return
+	}
+	if err := os.WriteFile(m.dataFile, data, 0644); err != nil {
+		logrus.Warn("Failed to save rollouts: ", err)
+	}
+}
+
+// load 读取发布记录，控制端重启前未完成的发布标记为中断
+func (m *Manager) load() error {
+	if m.dataFile == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(m.dataFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, &m.rollouts); err != nil {
+		return err
+	}
+	for _, r := range m.rollouts {
+		if id, err := strconv.ParseInt(r.ID, 10, 64); err == nil && id > m.seq {
+			m.seq = id
+		}
+		if r.Active() {
+			r.Status = StatusInterrupted
+			r.Message = "controller restarted during the rollout, check the hosts before retrying"
+		}
+	}
+	return nil
+}
+
+// host 查找主机进度，调用方需持有锁
+func (r *Rollout) host(name string) *HostState {
+	for _, host := range r.Hosts {
+		if host.Agent == name {
+			return host
+		}
+	}
+	return nil
+}
+
+// record 记录事件，调用方需持有锁
+func (r *Rollout) record(agentName, message string) {
+	now := time.Now()
+	r.UpdatedAt = now
+	r.Events = append(r.Events, Event{At: now, Agent: agentName, Message: message})
+	if agentName != "" {
+		logrus.Infof("Rollout %s [%s] %s", r.ID, agentName, message)
+	} else {
+		logrus.Infof("Rollout %s: %s", r.ID, message)
+	}
+}
+
+// snapshot 复制发布状态供接口返回，调用方需持有锁
+func (r *Rollout) snapshot() *Rollout {
+	c := *r
+	c.Hosts = make([]*HostState, len(r.Hosts))
+	for i, host := range r.Hosts {
+		h := *host
+		c.Hosts[i] = &h
+	}
+	c.Events = append([]Event{}, r.Events...)
+	c.control = nil
+	return &c
+}
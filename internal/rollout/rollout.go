@@ -0,0 +1,169 @@
+package rollout
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	StatusRunning     = "running"
+	StatusPaused      = "paused"      // 等待批准继续
+	StatusSucceeded   = "succeeded"   // 所有主机已应用
+	StatusRolledBack  = "rolled_back" // 失败后已回滚已应用的主机
+	StatusAborted     = "aborted"
+	StatusInterrupted = "interrupted" // 控制端在发布过程中重启
+
+	HostPending    = "pending"
+	HostValidating = "validating"
+	HostApplying   = "applying"
+	HostReloading  = "reloading"
+	HostChecking   = "checking"
+	HostSucceeded  = "succeeded"
+	HostFailed     = "failed"
+	HostRolledBack = "rolled_back"
+
+	PauseCanary = "canary" // 金丝雀成功后暂停等待批准，其余批次自动进行
+	PauseBatch  = "batch"  // 每个批次完成后都暂停
+	PauseNone   = "none"   // 不暂停
+
+	defaultHealthDelay = 5 * time.Second
+)
+
+// Plan 发布计划
+type Plan struct {
+	Name        string   `json:"name"`
+	Content     string   `json:"content"`
+	Instance    string   `json:"instance,omitempty"` // agent上的实例，为空时使用默认实例
+	Agents      []string `json:"agents"`             // 目标agent，按发布顺序
+	Canary      string   `json:"canary"`             // 金丝雀主机，默认为第一个目标
+	BatchSize   int      `json:"batch_size"`         // 金丝雀之后每批主机数
+	Pause       string   `json:"pause"`
+	HealthURL   string   `json:"health_url,omitempty"` // 可选的HTTP健康检查地址，{host}替换为agent主机名
+	HealthDelay string   `json:"health_delay"`         // reload后等待多久再做健康检查，如"10s"
+}
+
+// HostState 单个主机的发布进度
+type HostState struct {
+	Agent     string    `json:"agent"`
+	Batch     int       `json:"batch"`
+	Status    string    `json:"status"`
+	Message   string    `json:"message,omitempty"`
+	Applied   bool      `json:"applied"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	previous string // 应用前的配置，用于回滚
+}
+
+// Event 发布过程中的一条记录
+type Event struct {
+	At      time.Time `json:"at"`
+	Agent   string    `json:"agent,omitempty"`
+	Message string    `json:"message"`
+}
+
+// Rollout 一次发布
+type Rollout struct {
+	ID           string       `json:"id"`
+	Plan         Plan         `json:"plan"`
+	Status       string       `json:"status"`
+	Message      string       `json:"message,omitempty"`
+	Batches      [][]string   `json:"batches"` // 第0批为金丝雀
+	CurrentBatch int          `json:"current_batch"`
+	Hosts        []*HostState `json:"hosts"`
+	Events       []Event      `json:"events"`
+	CreatedBy    string       `json:"created_by"`
+	CreatedAt    time.Time    `json:"created_at"`
+	UpdatedAt    time.Time    `json:"updated_at"`
+	FinishedAt   *time.Time   `json:"finished_at,omitempty"`
+
+	control         chan string
+	pauseRequested  bool
+	abortRequested  bool
+	rollbackOnAbort bool
+}
+
+// Active 发布是否仍在进行
+func (r *Rollout) Active() bool {
+	return r.Status == StatusRunning || r.Status == StatusPaused
+}
+
+// normalize 校验计划并填充默认值
+func (p *Plan) normalize() error {
+	if p.Content == "" {
+		return fmt.Errorf("content is required")
+	}
+	if len(p.Agents) == 0 {
+		return fmt.Errorf("at least one agent is required")
+	}
+
+	seen := make(map[string]bool)
+	for _, name := range p.Agents {
+		if seen[name] {
+			return fmt.Errorf("agent %s is listed twice", name)
+		}
+		seen[name] = true
+	}
+	if p.Canary == "" {
+		p.Canary = p.Agents[0]
+	} else if !seen[p.Canary] {
+		return fmt.Errorf("canary %s is not one of the target agents", p.Canary)
+	}
+
+	if p.BatchSize <= 0 {
+		p.BatchSize = 1
+	}
+	switch p.Pause {
+	case "":
+		p.Pause = PauseCanary
+	case PauseCanary, PauseBatch, PauseNone:
+	default:
+		return fmt.Errorf("invalid pause mode %q", p.Pause)
+	}
+	if p.HealthDelay == "" {
+		p.HealthDelay = defaultHealthDelay.String()
+	} else if d, err := time.ParseDuration(p.HealthDelay); err != nil || d < 0 {
+		return fmt.Errorf("invalid health_delay %q", p.HealthDelay)
+	}
+	if p.Name == "" {
+		p.Name = fmt.Sprintf("rollout to %d hosts", len(p.Agents))
+	}
+	return nil
+}
+
+// batches 金丝雀单独为第一批，其余主机按BatchSize分批
+func (p *Plan) batches() [][]string {
+	batches := [][]string{{p.Canary}}
+	var current []string
+	for _, name := range p.Agents {
+		if name == p.Canary {
+			continue
+		}
+		current = append(current, name)
+		if len(current) == p.BatchSize {
+			batches = append(batches, current)
+			current = nil
+		}
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+// healthDelay 已在normalize中校验
+func (p *Plan) healthDelay() time.Duration {
+	d, _ := time.ParseDuration(p.HealthDelay)
+	return d
+}
+
+// pauseBefore 第batch批开始前是否需要暂停等待批准
+func (p *Plan) pauseBefore(batch int) bool {
+	switch p.Pause {
+	case PauseCanary:
+		return batch == 1
+	case PauseBatch:
+		return batch > 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,463 @@
+package templates
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	"nginx_manager/internal/nginxconf"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// 模板生成的配置类型
+const (
+	KindMain = "main" // 完整的nginx.conf
+	KindHTTP = "http" // http块中的片段（server、upstream等），可放在被include的conf.d文件中
+)
+
+// 参数类型
+const (
+	ParamString = "string"
+	ParamInt    = "int"
+	ParamBool   = "bool"
+	ParamList   = "list" // 字符串列表，如多个server_name
+)
+
+// fileExt 模板文件扩展名
+const fileExt = ".tmpl"
+
+//go:embed builtin/*.tmpl
+var builtinFS embed.FS
+
+var (
+	// ErrNotFound 模板不存在
+	ErrNotFound = errors.New("template not found")
+
+	templateName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	paramName    = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Param 模板参数声明
+type Param struct {
+	Name        string      `json:"name" yaml:"name"`
+	Type        string      `json:"type" yaml:"type"` // string、int、bool或list，默认为string
+	Description string      `json:"description,omitempty" yaml:"description,omitempty"`
+	Default     interface{} `json:"default,omitempty" yaml:"default,omitempty"`
+	Required    bool        `json:"required,omitempty" yaml:"required,omitempty"`
+	Pattern     string      `json:"pattern,omitempty" yaml:"pattern,omitempty"` // string和list中每一项需匹配的正则
+	Options     []string    `json:"options,omitempty" yaml:"options,omitempty"` // 可选值
+	Min         *int        `json:"min,omitempty" yaml:"min,omitempty"`
+	Max         *int        `json:"max,omitempty" yaml:"max,omitempty"`
+}
+
+// Template 参数化的配置模板
+type Template struct {
+	Name        string  `json:"name" yaml:"-"` // 即文件名
+	Title       string  `json:"title" yaml:"title"`
+	Description string  `json:"description,omitempty" yaml:"description,omitempty"`
+	Kind        string  `json:"kind" yaml:"kind"`
+	Builtin     bool    `json:"builtin" yaml:"-"`
+	Params      []Param `json:"params" yaml:"params"`
+	Body        string  `json:"body" yaml:"-"` // text/template模板，参数通过 {{ .name }} 引用
+}
+
+// Library 内置模板和用户保存在dir中的模板，用户模板不能与内置模板同名
+type Library struct {
+	mu      sync.Mutex
+	dir     string
+	builtin map[string]*Template
+}
+
+// NewLibrary 加载内置模板，用户模板保存在dir中
+func NewLibrary(dir string) *Library {
+	l := &Library{dir: dir, builtin: make(map[string]*Template)}
+
+	entries, err := builtinFS.ReadDir("builtin")
+	if err != nil {
+		logrus.Warn("Failed to read builtin templates: ", err)
+		return l
+	}
+	for _, entry := range entries {
+		data, err := builtinFS.ReadFile("builtin/" + entry.Name())
+		if err != nil {
+			logrus.Warnf("Failed to read builtin template %s: %v", entry.Name(), err)
+			continue
+		}
+		tmpl, err := Parse(strings.TrimSuffix(entry.Name(), fileExt), data)
+		if err != nil {
+			logrus.Warnf("Invalid builtin template %s: %v", entry.Name(), err)
+			continue
+		}
+		tmpl.Builtin = true
+		l.builtin[tmpl.Name] = tmpl
+	}
+	return l
+}
+
+// List 列出所有模板，内置模板在前
+func (l *Library) List() ([]*Template, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	list := make([]*Template, 0, len(l.builtin))
+	for _, tmpl := range l.builtin {
+		list = append(list, tmpl)
+	}
+
+	var users []*Template
+	entries, err := os.ReadDir(l.dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), fileExt)
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), fileExt) || l.builtin[name] != nil {
+			continue
+		}
+		tmpl, err := l.load(name)
+		if err != nil {
+			logrus.Warnf("Skipping template %s: %v", entry.Name(), err)
+			continue
+		}
+		users = append(users, tmpl)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return append(list, users...), nil
+}
+
+// Get 获取模板
+func (l *Library) Get(name string) (*Template, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if tmpl, ok := l.builtin[name]; ok {
+		return tmpl, nil
+	}
+	if !templateName.MatchString(name) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	return l.load(name)
+}
+
+// Save 保存用户模板，已存在时覆盖
+func (l *Library) Save(tmpl *Template) error {
+	if !templateName.MatchString(tmpl.Name) {
+		return fmt.Errorf("invalid template name %q: use lowercase letters, digits, - and _", tmpl.Name)
+	}
+	if err := tmpl.validate(); err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.builtin[tmpl.Name]; ok {
+		return fmt.Errorf("%s is a builtin template and cannot be overwritten", tmpl.Name)
+	}
+	data, err := tmpl.Marshal()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(l.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create template directory: %w", err)
+	}
+	if err := os.WriteFile(l.path(tmpl.Name), data, 0644); err != nil {
+		return fmt.Errorf("failed to save template: %w", err)
+	}
+
+	logrus.Infof("Template saved: %s", tmpl.Name)
+	return nil
+}
+
+// Delete 删除用户模板
+func (l *Library) Delete(name string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.builtin[name]; ok {
+		return fmt.Errorf("%s is a builtin template and cannot be deleted", name)
+	}
+	if !templateName.MatchString(name) {
+		return fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err := os.Remove(l.path(name)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		return fmt.Errorf("failed to delete template: %w", err)
+	}
+
+	logrus.Infof("Template deleted: %s", name)
+	return nil
+}
+
+func (l *Library) path(name string) string {
+	return filepath.Join(l.dir, name+fileExt)
+}
+
+func (l *Library) load(name string) (*Template, error) {
+	data, err := os.ReadFile(l.path(name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return Parse(name, data)
+}
+
+// Parse 解析模板文件：以 --- 包围的YAML头声明标题和参数，其后为模板内容
+func Parse(name string, data []byte) (*Template, error) {
+	content := strings.ReplaceAll(string(data), "\r\n", "\n")
+	if !strings.HasPrefix(content, "---\n") {
+		return nil, fmt.Errorf("template must start with a --- header")
+	}
+	header, body, ok := strings.Cut(content[len("---\n"):], "\n---\n")
+	if !ok {
+		return nil, fmt.Errorf("template header is not closed with ---")
+	}
+
+	tmpl := &Template{}
+	if err := yaml.Unmarshal([]byte(header), tmpl); err != nil {
+		return nil, fmt.Errorf("invalid template header: %w", err)
+	}
+	tmpl.Name = name
+	tmpl.Body = body
+	if tmpl.Params == nil {
+		tmpl.Params = []Param{}
+	}
+	if err := tmpl.validate(); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// Marshal 生成模板文件内容
+func (t *Template) Marshal() ([]byte, error) {
+	header, err := yaml.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	return []byte("---\n" + string(header) + "---\n" + t.Body), nil
+}
+
+// Render 校验参数并渲染模板，values中没有的参数使用默认值。生成的配置需能被解析
+func (t *Template) Render(values map[string]interface{}) (string, error) {
+	data := make(map[string]interface{}, len(t.Params))
+	for _, p := range t.Params {
+		value, err := p.resolve(values[p.Name])
+		if err != nil {
+			return "", err
+		}
+		data[p.Name] = value
+	}
+	for name := range values {
+		if _, ok := data[name]; !ok {
+			return "", fmt.Errorf("unknown parameter %q", name)
+		}
+	}
+
+	parsed, err := t.compile()
+	if err != nil {
+		return "", err
+	}
+	var out bytes.Buffer
+	if err := parsed.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+	if _, err := nginxconf.Parse(t.Name, out.String()); err != nil {
+		return "", fmt.Errorf("rendered config is invalid: %w", err)
+	}
+	return out.String(), nil
+}
+
+func (t *Template) compile() (*template.Template, error) {
+	parsed, err := template.New(t.Name).Option("missingkey=error").Funcs(funcs).Parse(t.Body)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template body: %w", err)
+	}
+	return parsed, nil
+}
+
+func (t *Template) validate() error {
+	switch t.Kind {
+	case "":
+		t.Kind = KindHTTP
+	case KindMain, KindHTTP:
+	default:
+		return fmt.Errorf("invalid template kind %q", t.Kind)
+	}
+	if t.Title == "" {
+		t.Title = t.Name
+	}
+
+	seen := make(map[string]bool)
+	for i := range t.Params {
+		p := &t.Params[i]
+		if !paramName.MatchString(p.Name) {
+			return fmt.Errorf("invalid parameter name %q", p.Name)
+		}
+		if seen[p.Name] {
+			return fmt.Errorf("duplicate parameter %s", p.Name)
+		}
+		seen[p.Name] = true
+
+		switch p.Type {
+		case "":
+			p.Type = ParamString
+		case ParamString, ParamInt, ParamBool, ParamList:
+		default:
+			return fmt.Errorf("parameter %s has invalid type %q", p.Name, p.Type)
+		}
+		if p.Pattern != "" {
+			if _, err := regexp.Compile(p.Pattern); err != nil {
+				return fmt.Errorf("parameter %s has invalid pattern: %w", p.Name, err)
+			}
+		}
+		if p.Default != nil {
+			if _, err := p.convert(p.Default); err != nil {
+				return fmt.Errorf("invalid default: %w", err)
+			}
+		}
+	}
+
+	_, err := t.compile()
+	return err
+}
+
+// resolve 将参数值转换为声明的类型并校验，缺少时使用默认值
+func (p *Param) resolve(value interface{}) (interface{}, error) {
+	if value == nil || value == "" {
+		if p.Required && p.Default == nil {
+			return nil, fmt.Errorf("parameter %s is required", p.Name)
+		}
+		value = p.Default
+	}
+	if value == nil {
+		switch p.Type {
+		case ParamInt:
+			return 0, nil
+		case ParamBool:
+			return false, nil
+		case ParamList:
+			return []string{}, nil
+		}
+		return "", nil
+	}
+	return p.convert(value)
+}
+
+func (p *Param) convert(value interface{}) (interface{}, error) {
+	switch p.Type {
+	case ParamInt:
+		var n int
+		switch v := value.(type) {
+		case int:
+			n = v
+		case float64:
+			if v != float64(int(v)) {
+				return nil, fmt.Errorf("parameter %s must be an integer", p.Name)
+			}
+			n = int(v)
+		case string:
+			var err error
+			if n, err = strconv.Atoi(strings.TrimSpace(v)); err != nil {
+				return nil, fmt.Errorf("parameter %s must be an integer", p.Name)
+			}
+		default:
+			return nil, fmt.Errorf("parameter %s must be an integer", p.Name)
+		}
+		if p.Min != nil && n < *p.Min {
+			return nil, fmt.Errorf("parameter %s must be at least %d", p.Name, *p.Min)
+		}
+		if p.Max != nil && n > *p.Max {
+			return nil, fmt.Errorf("parameter %s must be at most %d", p.Name, *p.Max)
+		}
+		return n, nil
+	case ParamBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+		return nil, fmt.Errorf("parameter %s must be true or false", p.Name)
+	case ParamList:
+		var items []string
+		switch v := value.(type) {
+		case string:
+			items = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+		case []interface{}:
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("parameter %s must be a list of strings", p.Name)
+				}
+				items = append(items, s)
+			}
+		case []string:
+			items = v
+		default:
+			return nil, fmt.Errorf("parameter %s must be a list of strings", p.Name)
+		}
+		for _, item := range items {
+			if err := p.check(item); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		s, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("parameter %s must be a string", p.Name)
+		}
+		if err := p.check(s); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+}
+
+// check 校验字符串值：可选值、正则，且不能包含会改变配置结构的字符
+func (p *Param) check(s string) error {
+	if strings.ContainsAny(s, ";{}\n\r") {
+		return fmt.Errorf("parameter %s cannot contain ; { } or line breaks", p.Name)
+	}
+	if len(p.Options) > 0 {
+		found := false
+		for _, option := range p.Options {
+			if option == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("parameter %s must be one of %s", p.Name, strings.Join(p.Options, ", "))
+		}
+	}
+	if p.Pattern != "" && !regexp.MustCompile(p.Pattern).MatchString(s) {
+		return fmt.Errorf("parameter %s does not match %s", p.Name, p.Pattern)
+	}
+	return nil
+}
+
+// funcs 模板中可用的函数
+var funcs = template.FuncMap{
+	"join":  strings.Join,
+	"quote": nginxconf.Quote,
+}
@@ -0,0 +1,290 @@
+package timeseries
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Point 时间序列中的一个数据点
+type Point struct {
+	T int64   `json:"t"` // Unix秒
+	V float64 `json:"v"`
+}
+
+// Tier 一个精度层级：按Resolution聚合，保留Retention时长
+type Tier struct {
+	Resolution time.Duration
+	Retention  time.Duration
+}
+
+// DefaultTiers 默认层级：原始精度保留1天，1分钟均值保留7天，1小时均值保留90天
+func DefaultTiers(interval time.Duration) []Tier {
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return []Tier{
+		{Resolution: interval, Retention: 24 * time.Hour},
+		{Resolution: time.Minute, Retention: 7 * 24 * time.Hour},
+		{Resolution: time.Hour, Retention: 90 * 24 * time.Hour},
+	}
+}
+
+// ring 固定容量的环形缓冲区
+type ring struct {
+	Points []Point `json:"points"`
+	Next   int     `json:"next"`
+	Full   bool    `json:"full"`
+}
+
+func newRing(capacity int) *ring {
+	return &ring{Points: make([]Point, capacity)}
+}
+
+func (r *ring) push(p Point) {
+	r.Points[r.Next] = p
+	r.Next = (r.Next + 1) % len(r.Points)
+	if r.Next == 0 {
+		r.Full = true
+	}
+}
+
+// ordered 按时间先后返回所有点
+func (r *ring) ordered() []Point {
+	if !r.Full {
+		return append([]Point(nil), r.Points[:r.Next]...)
+	}
+	return append(append([]Point(nil), r.Points[r.Next:]...), r.Points[:r.Next]...)
+}
+
+// bucket 降采样时正在累积的桶
+type bucket struct {
+	Start int64   `json:"start"`
+	Sum   float64 `json:"sum"`
+	Count int     `json:"count"`
+}
+
+// series 一条时间序列在各层级上的数据
+type series struct {
+	Rings   []*ring   `json:"rings"`
+	Pending []*bucket `json:"pending"`
+}
+
+// Store 嵌入式时间序列存储，定期持久化到磁盘
+type Store struct {
+	path   string
+	tiers  []Tier
+	mu     sync.RWMutex
+	series map[string]*series
+}
+
+func NewStore(path string, tiers []Tier) *Store {
+	return &Store{
+		path:   path,
+		tiers:  tiers,
+		series: make(map[string]*series),
+	}
+}
+
+func (s *Store) newSeries() *series {
+	ser := &series{}
+	for _, tier := range s.tiers {
+		capacity := int(tier.Retention / tier.Resolution)
+		if capacity < 1 {
+			capacity = 1
+		}
+		ser.Rings = append(ser.Rings, newRing(capacity))
+		ser.Pending = append(ser.Pending, nil)
+	}
+	return ser
+}
+
+// Add 记录一个样本；第一层直接写入，其余层按各自精度取平均后写入
+func (s *Store) Add(name string, t time.Time, value float64) {
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ser, ok := s.series[name]
+	if !ok {
+		ser = s.newSeries()
+		s.series[name] = ser
+	}
+
+	for i, tier := range s.tiers {
+		start := t.Truncate(tier.Resolution).Unix()
+		if i == 0 {
+			ser.Rings[i].push(Point{T: start, V: value})
+			continue
+		}
+
+		pending := ser.Pending[i]
+		if pending != nil && pending.Start != start {
+			ser.Rings[i].push(Point{T: pending.Start, V: pending.Sum / float64(pending.Count)})
+			pending = nil
+		}
+		if pending == nil {
+			pending = &bucket{Start: start}
+			ser.Pending[i] = pending
+		}
+		pending.Sum += value
+		pending.Count++
+	}
+}
+
+// Names 返回所有序列名
+func (s *Store) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.series))
+	for name := range s.series {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Query 查询[from, to]内的数据并按step取平均；自动选择能覆盖from且精度足够的层级
+func (s *Store) Query(name string, from, to time.Time, step time.Duration) ([]Point, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	ser, ok := s.series[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown series: %s", name)
+	}
+
+	tier := s.pickTier(from, step)
+	points := ser.Rings[tier].ordered()
+	if pending := ser.Pending[tier]; pending != nil && pending.Count > 0 {
+		points = append(points, Point{T: pending.Start, V: pending.Sum / float64(pending.Count)})
+	}
+
+	if step < s.tiers[tier].Resolution {
+		step = s.tiers[tier].Resolution
+	}
+	return downsample(points, from.Unix(), to.Unix(), int64(step.Seconds())), nil
+}
+
+// pickTier 在保留时长覆盖from的层级中，选择精度不细于step的最粗层级；
+// 没有满足精度要求的层级时选择覆盖from的最精细层级
+func (s *Store) pickTier(from time.Time, step time.Duration) int {
+	age := time.Since(from)
+	best := -1
+	for i, tier := range s.tiers {
+		if age > tier.Retention {
+			continue
+		}
+		if best == -1 || tier.Resolution <= step {
+			best = i
+		}
+	}
+	if best == -1 {
+		return len(s.tiers) - 1
+	}
+	return best
+}
+
+// downsample 将数据点按step分桶取平均
+func downsample(points []Point, from, to, step int64) []Point {
+	result := []Point{}
+	if step <= 0 {
+		step = 1
+	}
+
+	var current *bucket
+	for _, p := range points {
+		if p.T < from || p.T > to {
+			continue
+		}
+		start := p.T - p.T%step
+		if current != nil && current.Start != start {
+			result = append(result, Point{T: current.Start, V: current.Sum / float64(current.Count)})
+			current = nil
+		}
+		if current == nil {
+			current = &bucket{Start: start}
+		}
+		current.Sum += p.V
+		current.Count++
+	}
+	if current != nil {
+		result = append(result, Point{T: current.Start, V: current.Sum / float64(current.Count)})
+	}
+	return result
+}
+
+// snapshot 持久化文件格式
+type snapshot struct {
+	Tiers  []Tier             `json:"tiers"`
+	Series map[string]*series `json:"series"`
+}
+
+// Save 将所有序列写入磁盘，先写临时文件再重命名以免损坏
+func (s *Store) Save() error {
+	s.mu.RLock()
+	data, err := json.Marshal(snapshot{Tiers: s.tiers, Series: s.series})
+	s.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode metrics history: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create metrics history directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write metrics history: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Load 从磁盘恢复序列；层级配置变化时丢弃旧数据
+func (s *Store) Load() error {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read metrics history: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("failed to decode metrics history: %w", err)
+	}
+	if !sameTiers(snap.Tiers, s.tiers) {
+		return fmt.Errorf("metrics history tiers changed, discarding old data")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, ser := range snap.Series {
+		if len(ser.Rings) == len(s.tiers) && len(ser.Pending) == len(s.tiers) {
+			s.series[name] = ser
+		}
+	}
+	return nil
+}
+
+func sameTiers(a, b []Tier) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -1,21 +1,39 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	"nginx_manager/internal/agent"
+	"nginx_manager/internal/audit"
 	"nginx_manager/internal/config"
 	"nginx_manager/internal/handler"
+	"nginx_manager/internal/instance"
 	"nginx_manager/internal/middleware"
+	"nginx_manager/internal/rollout"
+	"nginx_manager/internal/templates"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
+	configPath := flag.String("config", "./configs/config.yaml", "配置文件路径")
+	mode := flag.String("mode", "", "运行模式：standalone、agent或controller，覆盖server.mode")
+	port := flag.Int("port", 0, "监听端口，覆盖server.port")
+	flag.Parse()
+
 	// 加载配置
-	if err := config.LoadConfig("./configs/config.yaml"); err != nil {
+	if err := config.LoadConfig(*configPath); err != nil {
 		log.Fatal("Failed to load config: ", err)
 	}
+	if *mode != "" {
+		config.AppConfig.Server.Mode = *mode
+	}
+	if *port != 0 {
+		config.AppConfig.Server.Port = *port
+	}
 
 	// 配置日志
 	if config.AppConfig.Server.Debug {
@@ -28,62 +46,283 @@ func main() {
 
 	// 创建Gin引擎
 	r := gin.Default()
+	addr := fmt.Sprintf("%s:%d", config.AppConfig.Server.Host, config.AppConfig.Server.Port)
 
-	// 中间件
-	r.Use(middleware.CORSMiddleware(), middleware.AuthMiddleware())
+	switch config.AppConfig.Server.Mode {
+	case config.ModeStandalone:
+		r.Use(middleware.MetricsMiddleware(), middleware.CORSMiddleware(), middleware.AuthMiddleware())
+		setupNginx(r, newRegistry())
+		setupUI(r)
+	case config.ModeAgent:
+		runAgent(r, addr)
+		return
+	case config.ModeController:
+		r.Use(middleware.MetricsMiddleware(), middleware.CORSMiddleware(), middleware.AuthMiddleware())
+		setupController(r)
+		setupUI(r)
+	default:
+		log.Fatalf("Unknown server mode %q", config.AppConfig.Server.Mode)
+	}
 
-	// 创建处理器
-	nginxHandler := handler.NewNginxHandler()
-	configHandler := handler.NewConfigHandler()
-	wsHandler := handler.NewWebSocketHandler()
+	// 启动服务器
+	logrus.Infof("Starting %s server on %s://%s", config.AppConfig.Server.Mode, "http", addr)
 
-	// API路由
-	api := r.Group("/api")
-	{
+	if err := r.Run(addr); err != nil {
+		log.Fatal("Failed to start server: ", err)
+	}
+}
+
+// newRegistry 创建nginx实例注册表
+func newRegistry() *instance.Registry {
+	registry, err := instance.NewRegistry(config.AppConfig)
+	if err != nil {
+		log.Fatal("Failed to load nginx instances: ", err)
+	}
+	if all := registry.All(); len(all) > 1 {
+		logrus.Infof("Alerts, metrics history and system monitoring cover only the default instance %s", registry.Default().Name)
+	}
+	return registry
+}
+
+// setupNginx 注册管理本机nginx的API，standalone和agent模式共用
+func setupNginx(r *gin.Engine, registry *instance.Registry) {
+	nginxHandler := handler.NewNginxHandler(registry)
+	configHandler := handler.NewConfigHandler(registry)
+	wsHandler := handler.NewWebSocketHandler(registry)
+	logHandler := handler.NewLogHandler(registry)
+	metricsHandler := handler.NewMetricsHandler(registry)
+	systemHandler := handler.NewSystemHandler(registry)
+	historyHandler := handler.NewHistoryHandler(registry)
+	alertHandler := handler.NewAlertHandler(registry)
+	supervisorHandler := handler.NewSupervisorHandler(registry, alertHandler.Engine())
+	instanceHandler := handler.NewInstanceHandler(registry)
+	siteHandler := handler.NewSiteHandler(registry)
+	auditLog := audit.NewLog(config.AppConfig.Audit.DataFile)
+	upstreamHandler := handler.NewUpstreamHandler(registry, auditLog, alertHandler.Engine())
+	auditHandler := handler.NewAuditHandler(auditLog)
+	templateHandler := handler.NewTemplateHandler(templates.NewLibrary(config.AppConfig.Templates.Dir))
+
+	// 单个实例的管理路由：挂在 /api 下作用于默认实例，挂在 /api/instances/:instance 下作用于指定实例
+	instanceRoutes := func(group *gin.RouterGroup) {
 		// nginx服务管理
-		nginx := api.Group("/nginx")
+		nginx := group.Group("/nginx")
 		{
 			nginx.GET("/status", nginxHandler.GetStatus)
 			nginx.POST("/start", nginxHandler.Start)
 			nginx.POST("/stop", nginxHandler.Stop)
+			nginx.POST("/fast-stop", nginxHandler.FastStop)
 			nginx.POST("/restart", nginxHandler.Restart)
 			nginx.POST("/reload", nginxHandler.Reload)
+			nginx.POST("/reopen", nginxHandler.Reopen)
+			nginx.POST("/workers/retire", nginxHandler.RetireWorkers)
+			nginx.POST("/workers/reload", nginxHandler.ReloadWorkers)
+			nginx.POST("/upgrade", nginxHandler.Upgrade)
+			nginx.GET("/supervisor", supervisorHandler.GetSupervisor)
 		}
 
 		// 配置文件管理
-		configRouter := api.Group("/config")
+		configRouter := group.Group("/config")
 		{
 			configRouter.GET("", configHandler.GetConfig)
 			configRouter.PUT("", configHandler.SaveConfig)
 			configRouter.POST("/validate", configHandler.ValidateConfig)
-			configRouter.GET("/template", configHandler.GetTemplate)
+			configRouter.POST("/format", configHandler.FormatConfig)
+			configRouter.POST("/lint", configHandler.LintConfig)
+			configRouter.GET("/security", configHandler.GetSecurityReport)
+			configRouter.POST("/resolve", configHandler.ResolveConfig)
+		}
+
+		// 站点（server块）管理
+		sites := group.Group("/sites")
+		{
+			sites.GET("", siteHandler.GetSites)
+			sites.POST("", siteHandler.CreateSite)
+			sites.GET("/:id", siteHandler.GetSite)
+			sites.PUT("/:id", siteHandler.UpdateSite)
+			sites.DELETE("/:id", siteHandler.DeleteSite)
+			sites.POST("/:id/enable", siteHandler.EnableSite)
+			sites.POST("/:id/disable", siteHandler.DisableSite)
+			sites.POST("/:id/locations", siteHandler.AddLocation)
+			sites.POST("/:id/locations/reorder", siteHandler.ReorderLocations)
+			sites.PUT("/:id/locations/:index", siteHandler.UpdateLocation)
+			sites.DELETE("/:id/locations/:index", siteHandler.DeleteLocation)
+		}
+
+		// upstream管理
+		upstreams := group.Group("/upstreams")
+		{
+			upstreams.GET("", upstreamHandler.GetUpstreams)
+			upstreams.GET("/health", upstreamHandler.GetHealth)
+			upstreams.GET("/:name", upstreamHandler.GetUpstream)
+			upstreams.POST("/:name/servers", upstreamHandler.AddServer)
+			upstreams.DELETE("/:name/servers", upstreamHandler.RemoveServer)
+			upstreams.POST("/:name/servers/up", upstreamHandler.ServerUp)
+			upstreams.POST("/:name/servers/down", upstreamHandler.ServerDown)
+			upstreams.POST("/:name/servers/drain", upstreamHandler.DrainServer)
 		}
 
 		// 备份管理
-		backup := api.Group("/backup")
+		backup := group.Group("/backup")
 		{
 			backup.GET("", configHandler.GetBackups)
 			backup.GET("/download/:id", configHandler.DownloadBackup)
 			backup.POST("/restore/:id", configHandler.RestoreBackup)
 			backup.DELETE("/:id", configHandler.DeleteBackup)
 		}
+
+		// 日志管理
+		logs := group.Group("/logs")
+		{
+			logs.GET("/archives", logHandler.GetArchives)
+			logs.POST("/rotate", logHandler.Rotate)
+			logs.GET("/:name/download", logHandler.Download)
+		}
+	}
+
+	// API路由
+	api := r.Group("/api")
+	{
+		instanceRoutes(api)
+
+		// 多实例管理
+		api.GET("/instances", instanceHandler.GetInstances)
+		instanceRoutes(api.Group("/instances/:instance"))
+
+		// 系统资源监控
+		api.GET("/system", systemHandler.GetSystem)
+
+		// 配置模板库
+		templatesRouter := api.Group("/templates")
+		{
+			templatesRouter.GET("", templateHandler.GetTemplates)
+			templatesRouter.GET("/:name", templateHandler.GetTemplate)
+			templatesRouter.POST("/:name/render", templateHandler.RenderTemplate)
+			templatesRouter.PUT("/:name", templateHandler.SaveTemplate)
+			templatesRouter.DELETE("/:name", templateHandler.DeleteTemplate)
+		}
+
+		// location预设
+		api.GET("/location-presets", siteHandler.GetLocationPresets)
+
+		// 静态检查规则
+		api.GET("/lint-rules", configHandler.GetLintRules)
+
+		// 配置修改审计日志
+		api.GET("/audit", auditHandler.GetAudit)
+
+		// 指标历史
+		metricsRouter := api.Group("/metrics")
+		{
+			metricsRouter.GET("/history", historyHandler.GetHistory)
+			metricsRouter.GET("/series", historyHandler.GetSeries)
+		}
+
+		// 告警
+		alerts := api.Group("/alerts")
+		{
+			alerts.GET("", alertHandler.GetAlerts)
+			alerts.GET("/history", alertHandler.GetHistory)
+			alerts.GET("/rules", alertHandler.GetRules)
+			alerts.GET("/certificates", alertHandler.GetCertificates)
+			alerts.GET("/notifiers", alertHandler.GetNotifiers)
+			alerts.POST("/notifiers/:name/test", alertHandler.TestNotifier)
+			alerts.GET("/silences", alertHandler.GetSilences)
+			alerts.POST("/silences", alertHandler.CreateSilence)
+			alerts.DELETE("/silences/:id", alertHandler.DeleteSilence)
+		}
 	}
 
 	// WebSocket端点
 	r.GET("/ws/status", wsHandler.HandleWebSocket)
 
-	// 静态文件服务 (生产环境中用于服务前端文件)
+	// Prometheus指标
+	r.GET("/metrics", metricsHandler.Prometheus)
+}
+
+// runAgent 以agent模式运行：不提供Web界面，API要求控制端令牌或客户端证书
+func runAgent(r *gin.Engine, addr string) {
+	cfg := config.AppConfig.Agent
+	if cfg.Token == "" && cfg.ClientCAFile == "" {
+		log.Fatal("Agent mode requires agent.token or agent.client_ca_file")
+	}
+	if cfg.ClientCAFile != "" && cfg.CertFile == "" {
+		log.Fatal("agent.client_ca_file requires agent.cert_file and agent.key_file")
+	}
+
+	registry := newRegistry()
+	r.Use(middleware.MetricsMiddleware(), middleware.AgentAuthMiddleware(cfg.Token))
+	setupNginx(r, registry)
+	r.GET("/api/agent", handler.NewAgentHandler(registry).GetInfo)
+
+	if cfg.CertFile == "" {
+		logrus.Warn("Agent is serving plain HTTP; configure agent.cert_file and agent.key_file to enable TLS")
+		logrus.Infof("Starting agent server on %s://%s", "http", addr)
+		if err := r.Run(addr); err != nil {
+			log.Fatal("Failed to start server: ", err)
+		}
+		return
+	}
+
+	tlsConfig, err := agent.ServerTLSConfig(cfg.CertFile, cfg.KeyFile, cfg.ClientCAFile)
+	if err != nil {
+		log.Fatal("Failed to configure agent TLS: ", err)
+	}
+	server := &http.Server{Addr: addr, Handler: r, TLSConfig: tlsConfig}
+	logrus.Infof("Starting agent server on %s://%s (client certificates required: %v)", "https", addr, cfg.ClientCAFile != "")
+	if err := server.ListenAndServeTLS("", ""); err != nil {
+		log.Fatal("Failed to start server: ", err)
+	}
+}
+
+// setupController 注册管理agent的API
+func setupController(r *gin.Engine) {
+	cfg := config.AppConfig.Controller
+	tlsConfig, err := agent.ClientTLSConfig(cfg.CertFile, cfg.KeyFile, cfg.CAFile)
+	if err != nil {
+		log.Fatal("Failed to configure controller TLS: ", err)
+	}
+
+	endpoints := make([]agent.Endpoint, 0, len(cfg.Agents))
+	for _, a := range cfg.Agents {
+		endpoints = append(endpoints, agent.Endpoint{Name: a.Name, URL: a.URL, Token: a.Token})
+	}
+	fleet, err := agent.NewFleet(endpoints, cfg.Token, tlsConfig, cfg.Timeout, cfg.DataFile)
+	if err != nil {
+		log.Fatal("Failed to load agents: ", err)
+	}
+	// 启动agent状态检查协程
+	go fleet.Run(cfg.CheckInterval)
+
+	fleetHandler := handler.NewFleetHandler(fleet)
+	rolloutHandler := handler.NewRolloutHandler(rollout.NewManager(fleet, cfg.RolloutFile))
+
+	agents := r.Group("/api/agents")
+	{
+		agents.GET("", fleetHandler.GetAgents)
+		agents.POST("", fleetHandler.RegisterAgent)
+		agents.GET("/:agent", fleetHandler.GetAgent)
+		agents.DELETE("/:agent", fleetHandler.DeleteAgent)
+		agents.Any("/:agent/proxy/*path", fleetHandler.Proxy)
+	}
+
+	// 分批发布配置
+	rollouts := r.Group("/api/rollouts")
+	{
+		rollouts.GET("", rolloutHandler.GetRollouts)
+		rollouts.POST("", rolloutHandler.CreateRollout)
+		rollouts.GET("/:id", rolloutHandler.GetRollout)
+		rollouts.POST("/:id/approve", rolloutHandler.Approve)
+		rollouts.POST("/:id/pause", rolloutHandler.Pause)
+		rollouts.POST("/:id/abort", rolloutHandler.Abort)
+	}
+}
+
+// setupUI 静态文件服务 (生产环境中用于服务前端文件)
+func setupUI(r *gin.Engine) {
 	r.Static("/assets", "static/assets")
 	r.StaticFile("/favicon.ico", "static/favicon.ico")
 	r.LoadHTMLFiles("static/index.html")
 	r.NoRoute(func(c *gin.Context) {
 		c.HTML(200, "index.html", nil)
 	})
-	// 启动服务器
-	addr := fmt.Sprintf("%s:%d", config.AppConfig.Server.Host, config.AppConfig.Server.Port)
-	logrus.Infof("Starting server on %s://%s", "http", addr)
-
-	if err := r.Run(addr); err != nil {
-		log.Fatal("Failed to start server: ", err)
-	}
 }